@@ -8,12 +8,15 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	// The runtime image has no zoneinfo; embed it for payroll time zones.
+	_ "time/tzdata"
 
 	"my-personal-budget/internal/config"
 	"my-personal-budget/internal/database"
 	"my-personal-budget/internal/payroll"
 	"my-personal-budget/internal/server"
 	"my-personal-budget/internal/store"
+	"my-personal-budget/internal/trash"
 )
 
 func main() {
@@ -33,7 +36,8 @@ func main() {
 
 	bgCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	payroll.StartScheduler(bgCtx, store, log.Default())
+	payroll.StartScheduler(bgCtx, store, cfg.InstanceID, log.Default())
+	trash.StartPurger(bgCtx, store, cfg.TrashRetention, log.Default())
 
 	router := server.NewRouter(cfg, store)
 	srv := &http.Server{
@@ -9,21 +9,21 @@ CREATE TABLE IF NOT EXISTS users (
   email VARCHAR NOT NULL DEFAULT '',
   encrypted_password VARCHAR NOT NULL DEFAULT '',
   reset_password_token VARCHAR,
-  reset_password_sent_at TIMESTAMP,
-  remember_created_at TIMESTAMP,
+  reset_password_sent_at TIMESTAMPTZ,
+  remember_created_at TIMESTAMPTZ,
   sign_in_count INTEGER NOT NULL DEFAULT 0,
-  current_sign_in_at TIMESTAMP,
-  last_sign_in_at TIMESTAMP,
+  current_sign_in_at TIMESTAMPTZ,
+  last_sign_in_at TIMESTAMPTZ,
   current_sign_in_ip INET,
   last_sign_in_ip INET,
-  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   failed_attempts INTEGER NOT NULL DEFAULT 0,
   unlock_token VARCHAR,
-  locked_at TIMESTAMP,
+  locked_at TIMESTAMPTZ,
   confirmation_token VARCHAR,
-  confirmed_at TIMESTAMP,
-  confirmation_sent_at TIMESTAMP,
+  confirmed_at TIMESTAMPTZ,
+  confirmation_sent_at TIMESTAMPTZ,
   unconfirmed_email VARCHAR
 );
 CREATE UNIQUE INDEX IF NOT EXISTS index_users_on_email ON users (email);
@@ -34,24 +34,29 @@ CREATE TABLE IF NOT EXISTS api_keys (
   name VARCHAR NOT NULL DEFAULT '',
   token_hash TEXT NOT NULL UNIQUE,
   token_prefix VARCHAR NOT NULL DEFAULT '',
-  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  last_used_at TIMESTAMP
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ
 );
 CREATE INDEX IF NOT EXISTS index_api_keys_on_user_id ON api_keys (user_id);
 
 CREATE TABLE IF NOT EXISTS budgets (
   id SERIAL PRIMARY KEY,
   name VARCHAR,
-  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  payroll DOUBLE PRECISION DEFAULT 0,
-  payroll_run_at TIMESTAMP,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  payroll_cents BIGINT NOT NULL DEFAULT 0,
+  payroll_run_at TIMESTAMPTZ,
   auto_balance_enabled BOOLEAN NOT NULL DEFAULT FALSE
 );
 
 ALTER TABLE budgets
   ADD COLUMN IF NOT EXISTS auto_balance_enabled BOOLEAN NOT NULL DEFAULT FALSE;
 
+-- auto_balance_trigger is 'payroll' to cover deficits at each payroll run, or
+-- 'immediate' to also cover them as soon as a transaction causes one.
+ALTER TABLE budgets
+  ADD COLUMN IF NOT EXISTS auto_balance_trigger VARCHAR NOT NULL DEFAULT 'payroll';
+
 CREATE TABLE IF NOT EXISTS budget_auto_balance_sources (
   budget_id INTEGER REFERENCES budgets(id) ON DELETE CASCADE,
   source_budget_id INTEGER REFERENCES budgets(id) ON DELETE CASCADE,
@@ -59,17 +64,104 @@ CREATE TABLE IF NOT EXISTS budget_auto_balance_sources (
   PRIMARY KEY (budget_id, source_budget_id)
 );
 
+-- Priority sources are drained in priority order before weighted sources
+-- share what's left.
+ALTER TABLE budget_auto_balance_sources
+  ADD COLUMN IF NOT EXISTS mode VARCHAR NOT NULL DEFAULT 'weighted',
+  ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+
+-- floor_cents is the balance auto-balance leaves in a source.
+ALTER TABLE budget_auto_balance_sources ADD COLUMN IF NOT EXISTS floor_cents BIGINT NOT NULL DEFAULT 0;
+
+-- Transfers tie a debit in one budget to a credit in another.
+CREATE TABLE IF NOT EXISTS transfers (
+  id SERIAL PRIMARY KEY,
+  from_budget_id INTEGER REFERENCES budgets(id) ON DELETE SET NULL,
+  to_budget_id INTEGER REFERENCES budgets(id) ON DELETE SET NULL,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Splits group the lines of an itemized receipt across budgets.
+CREATE TABLE IF NOT EXISTS splits (
+  id SERIAL PRIMARY KEY,
+  description VARCHAR NOT NULL DEFAULT '',
+  total_cents BIGINT NOT NULL DEFAULT 0,
+  occurred_on DATE NOT NULL DEFAULT CURRENT_DATE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 CREATE TABLE IF NOT EXISTS transacts (
   id SERIAL PRIMARY KEY,
   description VARCHAR,
   budget_id INTEGER REFERENCES budgets(id) ON DELETE CASCADE,
   user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
   credit BOOLEAN NOT NULL DEFAULT FALSE,
-  amount DOUBLE PRECISION,
-  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+  amount_cents BIGINT NOT NULL DEFAULT 0,
+  occurred_on DATE NOT NULL DEFAULT CURRENT_DATE,
+  transfer_id INTEGER REFERENCES transfers(id) ON DELETE SET NULL,
+  split_id INTEGER REFERENCES splits(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- Money is stored as integer cents. Legacy dumps carry DOUBLE PRECISION
+-- payroll/amount columns; convert them once and drop the float columns.
+DO $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = 'budgets' AND column_name = 'payroll'
+  ) THEN
+    ALTER TABLE budgets ADD COLUMN IF NOT EXISTS payroll_cents BIGINT NOT NULL DEFAULT 0;
+    UPDATE budgets SET payroll_cents = ROUND(COALESCE(payroll, 0)::NUMERIC * 100)::BIGINT;
+    ALTER TABLE budgets DROP COLUMN payroll;
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name = 'transacts' AND column_name = 'amount'
+  ) THEN
+    ALTER TABLE transacts ADD COLUMN IF NOT EXISTS amount_cents BIGINT NOT NULL DEFAULT 0;
+    UPDATE transacts SET amount_cents = ROUND(COALESCE(amount, 0)::NUMERIC * 100)::BIGINT;
+    ALTER TABLE transacts DROP COLUMN amount;
+  END IF;
+END$$;
+
+ALTER TABLE transacts
+  ADD COLUMN IF NOT EXISTS transfer_id INTEGER REFERENCES transfers(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS index_transacts_on_transfer_id ON transacts (transfer_id);
+
+ALTER TABLE transacts
+  ADD COLUMN IF NOT EXISTS split_id INTEGER REFERENCES splits(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS index_transacts_on_split_id ON transacts (split_id);
+
+-- occurred_on is the day a transaction happened, as opposed to when it was
+-- entered. Existing rows fall back to their entry date.
+ALTER TABLE transacts ADD COLUMN IF NOT EXISTS occurred_on DATE;
+UPDATE transacts SET occurred_on = created_at::DATE WHERE occurred_on IS NULL;
+ALTER TABLE transacts
+  ALTER COLUMN occurred_on SET DEFAULT CURRENT_DATE,
+  ALTER COLUMN occurred_on SET NOT NULL;
+CREATE INDEX IF NOT EXISTS index_transacts_on_budget_id_and_occurred_on ON transacts (budget_id, occurred_on);
+
+ALTER TABLE splits ADD COLUMN IF NOT EXISTS occurred_on DATE;
+UPDATE splits SET occurred_on = created_at::DATE WHERE occurred_on IS NULL;
+ALTER TABLE splits
+  ALTER COLUMN occurred_on SET DEFAULT CURRENT_DATE,
+  ALTER COLUMN occurred_on SET NOT NULL;
+
+-- Deletes are soft: rows stay in place with deleted_at set until the purge
+-- job removes them after the retention window.
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE transacts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE splits ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS index_budgets_on_deleted_at ON budgets (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS index_transacts_on_deleted_at ON transacts (deleted_at) WHERE deleted_at IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS users_budgets (
   user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
   budget_id INTEGER REFERENCES budgets(id) ON DELETE CASCADE
@@ -93,6 +185,252 @@ BEGIN
   END IF;
 END$$;
 
+-- Tags label transactions across budgets. Each user keeps their own set;
+-- names are unique per user regardless of case.
+CREATE TABLE IF NOT EXISTS tags (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS index_tags_on_user_id_and_lower_name ON tags (COALESCE(user_id, 0), LOWER(name));
+
+CREATE TABLE IF NOT EXISTS transacts_tags (
+  transact_id INTEGER NOT NULL REFERENCES transacts(id) ON DELETE CASCADE,
+  tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  PRIMARY KEY (transact_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS index_transacts_tags_on_tag_id ON transacts_tags (tag_id);
+
+-- Payees are the merchants behind transactions. name_key is the normalized
+-- name (lowercase alphanumerics separated by single spaces) used to match
+-- descriptions; aliases map other spellings, exactly or by prefix.
+CREATE TABLE IF NOT EXISTS payees (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR NOT NULL,
+  name_key VARCHAR NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS index_payees_on_user_id_and_name_key ON payees (COALESCE(user_id, 0), name_key);
+
+CREATE TABLE IF NOT EXISTS payee_aliases (
+  id SERIAL PRIMARY KEY,
+  payee_id INTEGER NOT NULL REFERENCES payees(id) ON DELETE CASCADE,
+  pattern VARCHAR NOT NULL,
+  match VARCHAR NOT NULL DEFAULT 'exact',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS index_payee_aliases_on_payee_id_and_pattern ON payee_aliases (payee_id, pattern, match);
+
+ALTER TABLE transacts
+  ADD COLUMN IF NOT EXISTS payee_id INTEGER REFERENCES payees(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS index_transacts_on_payee_id ON transacts (payee_id);
+
+-- Reconciliations check a budget's cleared transactions against a bank
+-- statement. Finishing one stamps the cleared rows with its id, which locks
+-- their amounts and dates. At most one session per budget is open at a time.
+CREATE TABLE IF NOT EXISTS reconciliations (
+  id SERIAL PRIMARY KEY,
+  budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  statement_date DATE NOT NULL,
+  statement_balance_cents BIGINT NOT NULL,
+  status VARCHAR NOT NULL DEFAULT 'open',
+  cleared_balance_cents BIGINT,
+  adjustment_id INTEGER,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS index_reconciliations_on_budget_id ON reconciliations (budget_id, id DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS index_reconciliations_one_open_per_budget ON reconciliations (budget_id) WHERE status = 'open';
+
+ALTER TABLE transacts ADD COLUMN IF NOT EXISTS cleared BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transacts
+  ADD COLUMN IF NOT EXISTS reconciliation_id INTEGER REFERENCES reconciliations(id) ON DELETE SET NULL;
+
+-- Payroll schedules. The defaults pay on the 1st of every month, which is how
+-- every budget was paid before schedules existed. payroll_days is a
+-- comma-separated day-of-month list for monthly and semimonthly schedules.
+ALTER TABLE budgets
+  ADD COLUMN IF NOT EXISTS payroll_frequency VARCHAR NOT NULL DEFAULT 'monthly',
+  ADD COLUMN IF NOT EXISTS payroll_anchor DATE,
+  ADD COLUMN IF NOT EXISTS payroll_days VARCHAR NOT NULL DEFAULT '1',
+  ADD COLUMN IF NOT EXISTS payroll_interval_days INTEGER NOT NULL DEFAULT 0;
+-- payroll_time_zone is the IANA zone pay dates fall in; empty means the
+-- server's zone.
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS payroll_time_zone VARCHAR NOT NULL DEFAULT '';
+
+-- payroll_paid_through is the latest pay date credited to a budget; each
+-- scheduled payroll credit records the pay date it covers in payroll_period,
+-- at most once per budget. Budgets paid before this existed were paid for the
+-- month of their last run.
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS payroll_paid_through DATE;
+ALTER TABLE transacts ADD COLUMN IF NOT EXISTS payroll_period DATE;
+CREATE UNIQUE INDEX IF NOT EXISTS index_transacts_on_budget_id_and_payroll_period
+  ON transacts (budget_id, payroll_period) WHERE payroll_period IS NOT NULL;
+UPDATE budgets
+SET payroll_paid_through = date_trunc('month', payroll_run_at)::DATE
+WHERE payroll_paid_through IS NULL AND payroll_run_at IS NOT NULL;
+
+-- Rollover policies decide what happens to a budget's balance at each payroll
+-- period boundary: carry it, reset it to zero, or sweep what exceeds
+-- rollover_cap_cents into rollover_target_id.
+ALTER TABLE budgets
+  ADD COLUMN IF NOT EXISTS rollover_policy VARCHAR NOT NULL DEFAULT 'carry',
+  ADD COLUMN IF NOT EXISTS rollover_cap_cents BIGINT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS rollover_target_id INTEGER REFERENCES budgets(id) ON DELETE SET NULL;
+
+-- payroll_runs records every payroll run that did something or failed, with
+-- one payroll_run_budgets row per credited or skipped pay period or failed
+-- budget. A scheduler failure that repeats the last scheduler run is only
+-- recorded once. Like audit_log they keep plain ids so history outlives
+-- purged budgets.
+CREATE TABLE IF NOT EXISTS payroll_runs (
+  id BIGSERIAL PRIMARY KEY,
+  triggered_by VARCHAR NOT NULL,
+  user_id INTEGER,
+  budget_id INTEGER,
+  as_of TIMESTAMPTZ NOT NULL,
+  status VARCHAR NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  credit_count INTEGER NOT NULL DEFAULT 0,
+  total_cents BIGINT NOT NULL DEFAULT 0,
+  started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS index_payroll_runs_on_started_at ON payroll_runs (started_at DESC, id DESC);
+
+CREATE TABLE IF NOT EXISTS payroll_run_budgets (
+  id BIGSERIAL PRIMARY KEY,
+  run_id BIGINT NOT NULL REFERENCES payroll_runs(id) ON DELETE CASCADE,
+  budget_id INTEGER NOT NULL,
+  budget_name VARCHAR NOT NULL DEFAULT '',
+  period DATE,
+  amount_cents BIGINT NOT NULL DEFAULT 0,
+  status VARCHAR NOT NULL,
+  credit JSONB,
+  auto_balance JSONB,
+  error TEXT NOT NULL DEFAULT ''
+);
+ALTER TABLE payroll_run_budgets ADD COLUMN IF NOT EXISTS rollover JSONB;
+ALTER TABLE payroll_run_budgets ADD COLUMN IF NOT EXISTS override JSONB;
+ALTER TABLE payroll_run_budgets ADD COLUMN IF NOT EXISTS prorated_from_cents BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payroll_run_budgets ADD COLUMN IF NOT EXISTS unfunded_cents BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS index_payroll_run_budgets_on_run_id ON payroll_run_budgets (run_id);
+CREATE INDEX IF NOT EXISTS index_payroll_run_budgets_on_budget_id ON payroll_run_budgets (budget_id);
+
+-- Incomes are recurring paychecks with a plan distributing each deposit
+-- across budgets: fixed amounts first, then percentages of the paycheck
+-- (percent_bp is hundredths of a percent), then the remainder budget. The
+-- schedule columns mirror the budgets' payroll schedule.
+CREATE TABLE IF NOT EXISTS incomes (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+  name VARCHAR NOT NULL,
+  amount_cents BIGINT NOT NULL,
+  frequency VARCHAR NOT NULL DEFAULT 'monthly',
+  anchor DATE,
+  days VARCHAR NOT NULL DEFAULT '1',
+  interval_days INTEGER NOT NULL DEFAULT 0,
+  time_zone VARCHAR NOT NULL DEFAULT '',
+  auto_post BOOLEAN NOT NULL DEFAULT TRUE,
+  remainder_budget_id INTEGER REFERENCES budgets(id) ON DELETE SET NULL,
+  paid_through DATE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS index_incomes_on_user_id ON incomes (user_id);
+
+CREATE TABLE IF NOT EXISTS income_allocations (
+  income_id INTEGER NOT NULL REFERENCES incomes(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+  amount_cents BIGINT NOT NULL DEFAULT 0,
+  percent_bp INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (income_id, position)
+);
+
+-- income_deposits records each paycheck received, at most one per pay date;
+-- the credits that distributed it carry its id.
+CREATE TABLE IF NOT EXISTS income_deposits (
+  id SERIAL PRIMARY KEY,
+  income_id INTEGER NOT NULL REFERENCES incomes(id) ON DELETE CASCADE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  period DATE NOT NULL,
+  amount_cents BIGINT NOT NULL,
+  scheduled BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS index_income_deposits_on_income_id_and_period ON income_deposits (income_id, period);
+
+ALTER TABLE transacts
+  ADD COLUMN IF NOT EXISTS income_deposit_id INTEGER REFERENCES income_deposits(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS index_transacts_on_income_deposit_id ON transacts (income_deposit_id);
+
+-- payroll_business_day moves pay dates that fall on weekends or holidays to
+-- the 'previous' or 'next' business day; payroll_prorate scales a budget's
+-- first credit to the part of the period after it was created.
+ALTER TABLE budgets
+  ADD COLUMN IF NOT EXISTS payroll_business_day VARCHAR NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS payroll_prorate BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- holidays are the days, besides weekends, that business-day payroll rules
+-- skip.
+CREATE TABLE IF NOT EXISTS holidays (
+  day DATE PRIMARY KEY,
+  name VARCHAR NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- payroll_amounts is each budget's payroll history: amount_cents is credited
+-- on every pay date from effective_on until a later row takes over. A NULL
+-- effective_on is the amount the budget started with.
+CREATE TABLE IF NOT EXISTS payroll_amounts (
+  id SERIAL PRIMARY KEY,
+  budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+  amount_cents BIGINT NOT NULL,
+  effective_on DATE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS index_payroll_amounts_on_budget_id_and_effective_on ON payroll_amounts (budget_id, effective_on);
+INSERT INTO payroll_amounts (budget_id, amount_cents)
+SELECT b.id, b.payroll_cents
+FROM budgets b
+WHERE NOT EXISTS (SELECT 1 FROM payroll_amounts a WHERE a.budget_id = b.id);
+
+-- payroll_overrides change a budget's scheduled payroll for chosen pay dates:
+-- a skip or amount override covers the single pay date starts_on, a pause
+-- covers every pay date from starts_on through ends_on.
+CREATE TABLE IF NOT EXISTS payroll_overrides (
+  id SERIAL PRIMARY KEY,
+  budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+  kind VARCHAR NOT NULL,
+  starts_on DATE NOT NULL,
+  ends_on DATE NOT NULL,
+  amount_cents BIGINT NOT NULL DEFAULT 0,
+  note VARCHAR NOT NULL DEFAULT '',
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS index_payroll_overrides_on_budget_id ON payroll_overrides (budget_id, starts_on);
+CREATE UNIQUE INDEX IF NOT EXISTS index_payroll_overrides_on_budget_id_and_pay_date
+  ON payroll_overrides (budget_id, starts_on) WHERE kind IN ('skip', 'amount');
+
+-- scheduler_leases lets one API replica at a time run a background job. A
+-- lease is held until expires_at and renewed by its holder while it runs.
+CREATE TABLE IF NOT EXISTS scheduler_leases (
+  name VARCHAR PRIMARY KEY,
+  holder VARCHAR NOT NULL,
+  acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  renewed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
 -- Passkeys persist WebAuthn credentials per user (one credential per user for now).
 CREATE TABLE IF NOT EXISTS passkeys (
   id SERIAL PRIMARY KEY,
@@ -102,6 +440,50 @@ CREATE TABLE IF NOT EXISTS passkeys (
   sign_count INTEGER NOT NULL DEFAULT 0,
   backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
   backup_state BOOLEAN NOT NULL DEFAULT FALSE,
-  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-  updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- audit_log is an append-only history of changes to budgets, transactions,
+-- shares and auto-balance settings. It keeps plain ids rather than foreign
+-- keys so entries outlive the rows, users and API keys they mention.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  budget_id INTEGER NOT NULL,
+  entity VARCHAR NOT NULL,
+  entity_id BIGINT NOT NULL,
+  action VARCHAR NOT NULL,
+  actor_user_id INTEGER,
+  actor_api_key_id INTEGER,
+  before JSONB,
+  after JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
+CREATE INDEX IF NOT EXISTS index_audit_log_on_budget_id_and_created_at ON audit_log (budget_id, created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+-- Timestamps are TIMESTAMPTZ. Older databases stored TIMESTAMP values written
+-- by NOW() in the session time zone; converting reads them in that same zone,
+-- so the instants they record don't change.
+DO $$
+DECLARE
+  col RECORD;
+BEGIN
+  FOR col IN
+    SELECT table_name, column_name
+    FROM information_schema.columns
+    WHERE table_schema = current_schema() AND data_type = 'timestamp without time zone'
+  LOOP
+    EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ', col.table_name, col.column_name);
+  END LOOP;
+END$$;
@@ -13,6 +13,18 @@ type Budget = {
   id: number;
   name: string;
   payroll: number;
+  payroll_schedule?: {
+    frequency: 'monthly' | 'semimonthly' | 'weekly' | 'biweekly' | 'custom';
+    anchor?: string;
+    days?: number[];
+    interval_days?: number;
+    time_zone?: string;
+  };
+  rollover?: {
+    mode: 'carry' | 'reset' | 'sweep';
+    cap?: number;
+    target_budget_id?: number;
+  };
   balance: number;
   credits: number;
   debits: number;
@@ -23,16 +35,27 @@ type Transaction = {
   description: string;
   credit: boolean;
   amount: number;
+  transfer_id?: number;
+  split_id?: number;
+  occurred_on: string;
+  payee?: string;
+  tags?: string[];
+  cleared: boolean;
+  reconciliation_id?: number;
   created_at: string;
 };
 
 type AutoBalanceSource = {
   source_budget_id: number;
   weight: number;
+  mode: string;
+  priority: number;
+  floor: number;
 };
 
 type AutoBalanceConfig = {
   enabled: boolean;
+  trigger: string;
   sources: AutoBalanceSource[];
 };
 
@@ -48,10 +71,26 @@ type TransactionsResponse = {
 
 type Share = { id: number; email: string };
 
+type BalanceMove = {
+  budget_id: number;
+  credit: boolean;
+  amount: number;
+};
+
+type BalanceResult = {
+  dry_run: boolean;
+  deficit: number;
+  funded: number;
+  unfunded: number;
+  moves: BalanceMove[] | null;
+};
+
 type NewTxnState = {
   description: string;
   credit: boolean;
   amount: number;
+  occurredOn: string;
+  tags: string;
   transfer: boolean;
   transferBudgetId: number | null;
 };
@@ -67,6 +106,8 @@ const INITIAL_TXN: NewTxnState = {
   description: '',
   credit: false,
   amount: 0,
+  occurredOn: '',
+  tags: '',
   transfer: false,
   transferBudgetId: null
 };
@@ -86,19 +127,6 @@ const newLine = (): ItemizedLine => ({
   description: '',
   amount: 0
 });
-const splitEvenly = (total: number, buckets: number) => {
-  if (buckets <= 0) return [];
-  const cents = Math.round(total * 100);
-  const base = Math.floor(cents / buckets);
-  let remainder = cents - base * buckets;
-  const allocations: number[] = [];
-  for (let i = 0; i < buckets; i += 1) {
-    const extra = remainder > 0 ? 1 : 0;
-    allocations.push((base + extra) / 100);
-    if (remainder > 0) remainder -= 1;
-  }
-  return allocations;
-};
 
 const ModalPortal = ({ children }: { children: ReactNode }) => {
   if (typeof document === 'undefined') {
@@ -189,7 +217,7 @@ const Dashboard = () => {
     setAutoBalanceEnabled(autoBalanceQuery.data.enabled);
     const selections: Record<number, boolean> = {};
     (autoBalanceQuery.data.sources || []).forEach((source) => {
-      selections[source.source_budget_id] = source.weight > 0;
+      selections[source.source_budget_id] = source.weight > 0 || source.mode === 'priority';
     });
     setAutoBalanceSelections(selections);
   }, [settingsBudget, autoBalanceQuery.data]);
@@ -263,12 +291,24 @@ const Dashboard = () => {
       ),
     [selectedPositives, budgets]
   );
+  const balancePreviewQuery = useQuery({
+    queryKey: ['balance-preview', selectedNegatives, selectedPositives, totalDeficit],
+    enabled: balanceWizardOpen && selectedNegatives.length > 0 && selectedPositives.length > 0 && totalDeficit > 0,
+    queryFn: () =>
+      request<BalanceResult>('/api/v1/balance', {
+        method: 'POST',
+        body: { negative_budget_ids: selectedNegatives, positive_budget_ids: selectedPositives, dry_run: true }
+      })
+  });
   const positiveAllocation = useMemo(
-    () => splitEvenly(totalDeficit, selectedPositives.length),
-    [totalDeficit, selectedPositives.length]
+    () =>
+      selectedPositives.map(
+        (id) => balancePreviewQuery.data?.moves?.find((move) => !move.credit && move.budget_id === id)?.amount ?? 0
+      ),
+    [selectedPositives, balancePreviewQuery.data]
   );
   const wizardReady =
-    selectedNegatives.length > 0 && selectedPositives.length > 0 && totalDeficit > 0 && positiveAllocation.length > 0;
+    selectedNegatives.length > 0 && selectedPositives.length > 0 && totalDeficit > 0 && Boolean(balancePreviewQuery.data);
   const coverageShortfall = wizardReady && positiveCoverage + 1e-6 < totalDeficit;
   const allocatedTotal = useMemo(
     () =>
@@ -354,22 +394,33 @@ const Dashboard = () => {
     mutationFn: async (payload: { sourceBudgetId: number; txn: NewTxnState }) => {
       const { sourceBudgetId, txn } = payload;
       const isTransfer = txn.transfer && txn.transferBudgetId && txn.transferBudgetId !== sourceBudgetId;
+      const occurredOn = txn.occurredOn || undefined;
 
       if (isTransfer) {
-        await request(`/api/v1/budgets/${sourceBudgetId}/transactions`, {
-          method: 'POST',
-          body: { description: txn.description, credit: false, amount: txn.amount }
-        });
-        await request(`/api/v1/budgets/${txn.transferBudgetId}/transactions`, {
+        await request(`/api/v1/budgets/${sourceBudgetId}/transfers`, {
           method: 'POST',
-          body: { description: txn.description, credit: true, amount: txn.amount }
+          body: {
+            to_budget_id: txn.transferBudgetId,
+            description: txn.description,
+            amount: txn.amount,
+            occurred_on: occurredOn
+          }
         });
         return { transferTargetId: txn.transferBudgetId };
       }
 
       await request(`/api/v1/budgets/${sourceBudgetId}/transactions`, {
         method: 'POST',
-        body: { description: txn.description, credit: txn.credit, amount: txn.amount }
+        body: {
+          description: txn.description,
+          credit: txn.credit,
+          amount: txn.amount,
+          occurred_on: occurredOn,
+          tags: txn.tags
+            .split(',')
+            .map((tag) => tag.trim())
+            .filter(Boolean)
+        }
       });
       return { transferTargetId: null };
     },
@@ -407,22 +458,23 @@ const Dashboard = () => {
         throw new Error('Allocations exceed the receipt total.');
       }
 
-      const touched = new Set<number>();
-      for (const line of lines) {
-        const desc = line.description ? `${baseDescription} - ${line.description}` : baseDescription;
-        await request(`/api/v1/budgets/${line.budgetId}/transactions`, {
-          method: 'POST',
-          body: { description: desc, credit: false, amount: line.amount }
-        });
-        touched.add(line.budgetId);
-      }
+      const touched = new Set<number>(lines.map((line) => line.budgetId));
       if (remainder > 0.009) {
-        await request(`/api/v1/budgets/${payload.catchAllBudgetId}/transactions`, {
-          method: 'POST',
-          body: { description: `${baseDescription} - catch-all`, credit: false, amount: remainder }
-        });
         touched.add(payload.catchAllBudgetId);
       }
+      await request('/api/v1/splits', {
+        method: 'POST',
+        body: {
+          description: baseDescription,
+          total: payload.total,
+          remainder_budget_id: payload.catchAllBudgetId,
+          lines: lines.map((line) => ({
+            budget_id: line.budgetId,
+            description: line.description ? `${baseDescription} - ${line.description}` : baseDescription,
+            amount: line.amount
+          }))
+        }
+      });
       return { budgetIds: Array.from(touched) };
     },
     onSuccess: (result) => {
@@ -443,7 +495,13 @@ const Dashboard = () => {
     }) => {
       const sources = Object.entries(payload.autoBalanceSelections)
         .filter(([, enabled]) => enabled)
-        .map(([id]) => ({ source_budget_id: Number(id), weight: 1 }));
+        .map(
+          ([id]) =>
+            (autoBalanceQuery.data?.sources || []).find((source) => source.source_budget_id === Number(id)) ?? {
+              source_budget_id: Number(id),
+              weight: 1
+            }
+        );
       const budget = await request<Budget>(`/api/v1/budgets/${payload.budgetId}`, {
         method: 'PUT',
         body: { name: payload.name, payroll: payload.payroll }
@@ -567,33 +625,14 @@ const Dashboard = () => {
       if (!negatives.length || !positives.length) {
         throw new Error('Select at least one negative and one positive budget.');
       }
-      const total = round2(
-        negatives.reduce((sum, b) => {
-          if (b.balance < 0) return sum + Math.abs(b.balance);
-          return sum;
-        }, 0)
-      );
-      if (total <= 0) {
-        throw new Error('Nothing to balance.');
-      }
-      const allocations = splitEvenly(total, positives.length);
-      const description = `Balance wizard ${new Date().toLocaleDateString()}`;
-      for (let i = 0; i < positives.length; i += 1) {
-        const amount = allocations[i];
-        if (amount <= 0) continue;
-        await request(`/api/v1/budgets/${positives[i].id}/transactions`, {
-          method: 'POST',
-          body: { description, credit: false, amount }
-        });
-      }
-      for (const budget of negatives) {
-        const amount = round2(Math.abs(budget.balance));
-        if (amount <= 0) continue;
-        await request(`/api/v1/budgets/${budget.id}/transactions`, {
-          method: 'POST',
-          body: { description, credit: true, amount }
-        });
-      }
+      await request<BalanceResult>('/api/v1/balance', {
+        method: 'POST',
+        body: {
+          negative_budget_ids: negatives.map((b) => b.id),
+          positive_budget_ids: positives.map((b) => b.id),
+          description: `Balance wizard ${new Date().toLocaleDateString()}`
+        }
+      });
       return {
         negatives: negatives.map((b) => b.id),
         positives: positives.map((b) => b.id)
@@ -918,7 +957,9 @@ const Dashboard = () => {
                               <div>
                                 <p className="eyebrow">{txn.credit ? 'Credit' : 'Debit'}</p>
                                 <p>{txn.description}</p>
-                                <p className="muted">{new Date(txn.created_at).toLocaleString()}</p>
+                                {txn.payee && txn.payee !== txn.description && <p className="muted">{txn.payee}</p>}
+                                <p className="muted">{new Date(`${txn.occurred_on}T00:00:00`).toLocaleDateString()}</p>
+                                {txn.tags && txn.tags.length > 0 && <p className="muted">{txn.tags.join(', ')}</p>}
                               </div>
                               <div className={`amount ${txn.credit ? 'positive' : 'negative'}`}>
                                 {txn.credit ? '+' : '-'}
@@ -1191,6 +1232,22 @@ const Dashboard = () => {
                   required
                 />
               </label>
+              <label>
+                Date
+                <input
+                  type="date"
+                  value={newTxn.occurredOn}
+                  onChange={(e) => setNewTxn((prev) => ({ ...prev, occurredOn: e.target.value }))}
+                />
+              </label>
+              <label>
+                Tags
+                <input
+                  value={newTxn.tags}
+                  placeholder="Dining, Travel"
+                  onChange={(e) => setNewTxn((prev) => ({ ...prev, tags: e.target.value }))}
+                />
+              </label>
               <label className={`toggle ${transferDisabled ? 'toggle--disabled' : ''}`}>
                 <div className="toggle__text">
                   <span className="toggle__label">Transfer</span>
@@ -6,7 +6,10 @@ import (
 
 type contextKey string
 
-const userIDKey contextKey = "userID"
+const (
+	userIDKey   contextKey = "userID"
+	apiKeyIDKey contextKey = "apiKeyID"
+)
 
 // WithUserID attaches the authenticated user ID to the context.
 func WithUserID(ctx context.Context, userID int64) context.Context {
@@ -23,3 +26,19 @@ func UserIDFromContext(ctx context.Context) *int64 {
 	}
 	return nil
 }
+
+// WithAPIKeyID records which API key authenticated the request.
+func WithAPIKeyID(ctx context.Context, keyID int64) context.Context {
+	return context.WithValue(ctx, apiKeyIDKey, keyID)
+}
+
+// APIKeyIDFromContext returns the API key ID if the request used one.
+func APIKeyIDFromContext(ctx context.Context) *int64 {
+	if ctx == nil {
+		return nil
+	}
+	if val, ok := ctx.Value(apiKeyIDKey).(int64); ok {
+		return &val
+	}
+	return nil
+}
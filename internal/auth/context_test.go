@@ -21,3 +21,23 @@ func TestUserIDContext(t *testing.T) {
 		t.Fatalf("expected user id 42, got %v", userID)
 	}
 }
+
+func TestAPIKeyIDContext(t *testing.T) {
+	if APIKeyIDFromContext(nil) != nil {
+		t.Fatalf("expected nil for nil context")
+	}
+
+	ctx := WithUserID(context.Background(), 42)
+	if APIKeyIDFromContext(ctx) != nil {
+		t.Fatalf("expected nil without an api key")
+	}
+
+	ctx = WithAPIKeyID(ctx, 7)
+	keyID := APIKeyIDFromContext(ctx)
+	if keyID == nil || *keyID != 7 {
+		t.Fatalf("expected api key id 7, got %v", keyID)
+	}
+	if userID := UserIDFromContext(ctx); userID == nil || *userID != 42 {
+		t.Fatalf("expected user id to survive, got %v", userID)
+	}
+}
@@ -20,6 +20,15 @@ type Config struct {
 	StaticDir         string
 	RelyingPartyID    string
 	RelyingPartyName  string
+	// TrashRetention is how long deleted budgets and transactions stay
+	// restorable. Zero disables the purge.
+	TrashRetention time.Duration
+	// InstanceID names this process when replicas compete for the payroll
+	// scheduler lease.
+	InstanceID string
+	// AdminUserIDs lists the users allowed to run payroll across every budget
+	// and edit the holiday list.
+	AdminUserIDs []int64
 }
 
 // FromEnv reads configuration from environment variables with sensible defaults.
@@ -35,6 +44,12 @@ func FromEnv() Config {
 	dbInterval := envDuration("DB_CONNECT_INTERVAL_MS", 500*time.Millisecond)
 	rpID := envDefault("RELYING_PARTY_ID", "localhost")
 	rpName := envDefault("RELYING_PARTY_NAME", "My Personal Budget")
+	instanceID := envDefault("INSTANCE_ID", defaultInstanceID())
+	adminUserIDs := splitInts(os.Getenv("ADMIN_USER_IDS"))
+	trashDays := envInt("TRASH_RETENTION_DAYS", 30)
+	if trashDays < 0 {
+		trashDays = 0
+	}
 
 	return Config{
 		Host:              host,
@@ -48,9 +63,22 @@ func FromEnv() Config {
 		StaticDir:         staticDir,
 		RelyingPartyID:    rpID,
 		RelyingPartyName:  rpName,
+		TrashRetention:    time.Duration(trashDays) * 24 * time.Hour,
+		InstanceID:        instanceID,
+		AdminUserIDs:      adminUserIDs,
 	}
 }
 
+// defaultInstanceID is the host name and process id, which tells replicas
+// apart in containers where the host name is the container id.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "api"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
 func envDefault(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -90,3 +118,15 @@ func splitAndTrim(value string) []string {
 	}
 	return out
 }
+
+// splitInts parses a comma-separated list of ids, skipping entries that
+// aren't positive integers.
+func splitInts(value string) []int64 {
+	var out []int64
+	for _, part := range splitAndTrim(value) {
+		if id, err := strconv.ParseInt(part, 10, 64); err == nil && id > 0 {
+			out = append(out, id)
+		}
+	}
+	return out
+}
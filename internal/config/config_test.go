@@ -17,6 +17,9 @@ func TestFromEnv(t *testing.T) {
 	t.Setenv("DB_CONNECT_INTERVAL_MS", "250")
 	t.Setenv("RELYING_PARTY_ID", "example.com")
 	t.Setenv("RELYING_PARTY_NAME", "Budget")
+	t.Setenv("TRASH_RETENTION_DAYS", "7")
+	t.Setenv("INSTANCE_ID", "api-1")
+	t.Setenv("ADMIN_USER_IDS", "7, nope, 12")
 
 	cfg := FromEnv()
 	if cfg.Host != "127.0.0.1" || cfg.Port != "9999" {
@@ -37,6 +40,15 @@ func TestFromEnv(t *testing.T) {
 	if cfg.RelyingPartyID != "example.com" || cfg.RelyingPartyName != "Budget" {
 		t.Fatalf("unexpected relying party: %s/%s", cfg.RelyingPartyID, cfg.RelyingPartyName)
 	}
+	if cfg.TrashRetention != 7*24*time.Hour {
+		t.Fatalf("unexpected trash retention: %s", cfg.TrashRetention)
+	}
+	if cfg.InstanceID != "api-1" {
+		t.Fatalf("unexpected instance id: %s", cfg.InstanceID)
+	}
+	if len(cfg.AdminUserIDs) != 2 || cfg.AdminUserIDs[0] != 7 || cfg.AdminUserIDs[1] != 12 {
+		t.Fatalf("unexpected admin user ids: %v", cfg.AdminUserIDs)
+	}
 }
 
 func TestFromEnv_Defaults(t *testing.T) {
@@ -51,6 +63,9 @@ func TestFromEnv_Defaults(t *testing.T) {
 	t.Setenv("DB_CONNECT_INTERVAL_MS", "")
 	t.Setenv("RELYING_PARTY_ID", "")
 	t.Setenv("RELYING_PARTY_NAME", "")
+	t.Setenv("TRASH_RETENTION_DAYS", "")
+	t.Setenv("INSTANCE_ID", "")
+	t.Setenv("ADMIN_USER_IDS", "")
 
 	cfg := FromEnv()
 	if cfg.Host == "" || cfg.Port == "" {
@@ -62,4 +77,13 @@ func TestFromEnv_Defaults(t *testing.T) {
 	if cfg.RelyingPartyID == "" || cfg.RelyingPartyName == "" {
 		t.Fatalf("expected defaults for relying party")
 	}
+	if cfg.TrashRetention != 30*24*time.Hour {
+		t.Fatalf("expected 30 day trash retention, got %s", cfg.TrashRetention)
+	}
+	if cfg.InstanceID == "" {
+		t.Fatalf("expected a default instance id")
+	}
+	if len(cfg.AdminUserIDs) != 0 {
+		t.Fatalf("expected no admins, got %v", cfg.AdminUserIDs)
+	}
 }
@@ -12,18 +12,32 @@ import (
 	"my-personal-budget/internal/store"
 )
 
-// StartScheduler kicks off a background loop that ensures payroll transactions
-// are created once per month. It runs immediately on startup, then schedules
-// the next run for the first moment of the next month. The provided context
-// cancels the loop.
-func StartScheduler(ctx context.Context, s *store.Store, logger *log.Logger) {
+// StartScheduler kicks off a background loop that creates payroll
+// transactions as each budget's payroll schedule comes due, and posts
+// auto-posted incomes on their pay dates. When several API replicas share a
+// database, only the one holding the payroll lease runs payroll; the others
+// poll the lease and take over if the leader stops renewing it. The leader
+// runs immediately on gaining the lease, then sleeps until the earliest next
+// pay date across budgets and incomes, waking at least every maxSleep so
+// schedule edits are picked up. The provided context cancels the loop and
+// releases the lease.
+func StartScheduler(ctx context.Context, s *store.Store, instanceID string, logger *log.Logger) {
 	if logger == nil {
 		logger = log.Default()
 	}
-	go run(ctx, s, logger)
+	go run(ctx, s, instanceID, logger)
 }
 
-func run(ctx context.Context, s *store.Store, logger *log.Logger) {
+const (
+	// leaseTTL is how long a leader keeps the payroll lease without renewing
+	// it, and so how long a crashed leader delays payroll on other replicas.
+	leaseTTL = 90 * time.Second
+	// renewInterval is how often the leader renews the lease and followers
+	// try to claim it.
+	renewInterval = 30 * time.Second
+)
+
+func run(ctx context.Context, s *store.Store, instanceID string, logger *log.Logger) {
 	// Small delay to let the DB warm up after process start.
 	select {
 	case <-ctx.Done():
@@ -31,9 +45,12 @@ func run(ctx context.Context, s *store.Store, logger *log.Logger) {
 	case <-time.After(2 * time.Second):
 	}
 
+	leader := false
+	failures := 0
 	next := time.Now()
+	wake := time.Now()
 	for {
-		wait := time.Until(next)
+		wait := time.Until(wake)
 		if wait < 0 {
 			wait = 0
 		}
@@ -41,20 +58,97 @@ func run(ctx context.Context, s *store.Store, logger *log.Logger) {
 		select {
 		case <-ctx.Done():
 			timer.Stop()
+			if leader {
+				releaseLease(s, instanceID, logger)
+			}
 			return
 		case <-timer.C:
+		}
+
+		was := leader
+		leader = claimLease(ctx, s, instanceID, logger)
+		switch {
+		case leader && !was:
+			logger.Printf("payroll: %s acquired the scheduler lease", instanceID)
+			next = time.Now()
+		case was && !leader:
+			logger.Printf("payroll: %s lost the scheduler lease", instanceID)
+		}
+
+		if leader && !time.Now().Before(next) {
 			count, err := runWithRetry(ctx, s, logger)
-			if err != nil {
-				logger.Printf("payroll: failed to run monthly payroll: %v", err)
-				next = time.Now().Add(15 * time.Second)
-				continue
+			switch {
+			case err != nil:
+				failures++
+				logger.Printf("payroll: failed to run payroll: %v", err)
+				next = time.Now().Add(retryDelay(failures))
+			default:
+				failures = 0
+				if count > 0 {
+					logger.Printf("payroll: created %d payroll transaction(s)", count)
+				}
+				next = nextWake(ctx, s, logger, time.Now())
 			}
-			logger.Printf("payroll: created %d payroll transaction(s) for %s", count, time.Now().Format("2006-01"))
-			next = nextMonthStart(time.Now())
 		}
+		wake = leaseWake(time.Now(), next, leader)
 	}
 }
 
+// claimLease acquires or renews the payroll lease and reports whether this
+// instance holds it. Errors count as not holding it, since the lease may
+// expire before the database is reachable again.
+func claimLease(ctx context.Context, s *store.Store, instanceID string, logger *log.Logger) bool {
+	leaseCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, ok, err := s.AcquireLease(leaseCtx, store.PayrollLease, instanceID, leaseTTL)
+	if err != nil {
+		logger.Printf("payroll: failed to acquire scheduler lease: %v", err)
+		return false
+	}
+	return ok
+}
+
+// releaseLease hands the lease back on shutdown so another replica can take
+// over without waiting for it to expire.
+func releaseLease(s *store.Store, instanceID string, logger *log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.ReleaseLease(ctx, store.PayrollLease, instanceID); err != nil {
+		logger.Printf("payroll: failed to release scheduler lease: %v", err)
+	}
+}
+
+// Failed runs are retried after minRetry, doubling with each consecutive
+// failure up to maxRetry, so a budget that keeps failing isn't retried every
+// few seconds until someone fixes it.
+const (
+	minRetry = 15 * time.Second
+	maxRetry = 10 * time.Minute
+)
+
+// retryDelay returns how long to wait after the given number of consecutive
+// failed runs.
+func retryDelay(failures int) time.Duration {
+	delay := minRetry
+	for i := 1; i < failures && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	if delay > maxRetry {
+		return maxRetry
+	}
+	return delay
+}
+
+// leaseWake returns when to wake next: in time to renew or claim the lease,
+// or sooner if this instance leads and payroll is due first.
+func leaseWake(now, next time.Time, leader bool) time.Time {
+	renew := now.Add(renewInterval)
+	if leader && next.Before(renew) {
+		return next
+	}
+	return renew
+}
+
 func runWithRetry(ctx context.Context, s *store.Store, logger *log.Logger) (int, error) {
 	backoffs := []time.Duration{0, 750 * time.Millisecond, 2 * time.Second}
 	var lastErr error
@@ -80,10 +174,27 @@ func runWithRetry(ctx context.Context, s *store.Store, logger *log.Logger) (int,
 		}
 
 		runCtx, cancelRun := context.WithTimeout(ctx, 10*time.Second)
-		count, err := s.RunMonthlyPayroll(runCtx, time.Now())
+		run, err := s.RunPayroll(runCtx, store.PayrollTriggerScheduler, nil, time.Now())
 		cancelRun()
 		if err == nil {
-			return count, nil
+			// Incomes post whatever happened to payroll, so one budget that
+			// keeps failing doesn't hold up everyone's deposits.
+			var errs []error
+			if run.Status != store.PayrollRunSucceeded {
+				// Budgets that failed were rolled back on their own; retry them
+				// soon rather than at the next pay date.
+				errs = append(errs, fmt.Errorf("run %s after %d credit(s): %s", run.Status, run.CreditCount, run.Error))
+			}
+			incomeCtx, cancelIncome := context.WithTimeout(ctx, 10*time.Second)
+			deposits, err := s.PostScheduledIncomes(incomeCtx, time.Now())
+			cancelIncome()
+			if deposits > 0 {
+				logger.Printf("payroll: posted %d income deposit(s)", deposits)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("post incomes: %w", err))
+			}
+			return run.CreditCount, errors.Join(errs...)
 		}
 		lastErr = err
 		logger.Printf("payroll attempt %d/%d failed: %v", i+1, len(backoffs), err)
@@ -104,7 +215,25 @@ func isBadConn(err error) bool {
 	return strings.Contains(strings.ToLower(err.Error()), "bad connection")
 }
 
-func nextMonthStart(now time.Time) time.Time {
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-	return startOfMonth.AddDate(0, 1, 0)
+// maxSleep bounds how long the scheduler sleeps between runs.
+const maxSleep = time.Hour
+
+func nextWake(ctx context.Context, s *store.Store, logger *log.Logger, now time.Time) time.Time {
+	dueCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	due, ok, err := s.NextPayrollDue(dueCtx, now)
+	if err != nil {
+		logger.Printf("payroll: failed to compute next pay date: %v", err)
+	}
+	return wakeAt(now, due, ok && err == nil)
+}
+
+// wakeAt returns when to run next: at the next pay date, or after maxSleep if
+// that comes first or nothing is scheduled.
+func wakeAt(now, due time.Time, ok bool) time.Time {
+	latest := now.Add(maxSleep)
+	if !ok || due.After(latest) {
+		return latest
+	}
+	return due
 }
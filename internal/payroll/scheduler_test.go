@@ -22,11 +22,47 @@ func TestIsBadConn(t *testing.T) {
 	}
 }
 
-func TestNextMonthStart(t *testing.T) {
+func TestWakeAt(t *testing.T) {
 	now := time.Date(2024, time.March, 15, 12, 30, 0, 0, time.UTC)
-	next := nextMonthStart(now)
-	expected := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
-	if !next.Equal(expected) {
-		t.Fatalf("expected %s, got %s", expected, next)
+	soon := time.Date(2024, time.March, 15, 13, 0, 0, 0, time.UTC)
+	if got := wakeAt(now, soon, true); !got.Equal(soon) {
+		t.Fatalf("expected %s, got %s", soon, got)
+	}
+	later := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if got := wakeAt(now, later, true); !got.Equal(now.Add(maxSleep)) {
+		t.Fatalf("expected wake after %s, got %s", maxSleep, got)
+	}
+	if got := wakeAt(now, time.Time{}, false); !got.Equal(now.Add(maxSleep)) {
+		t.Fatalf("expected wake after %s with nothing due, got %s", maxSleep, got)
+	}
+}
+
+func TestLeaseWake(t *testing.T) {
+	now := time.Date(2024, time.March, 15, 12, 30, 0, 0, time.UTC)
+	soon := now.Add(5 * time.Second)
+	if got := leaseWake(now, soon, true); !got.Equal(soon) {
+		t.Fatalf("expected leader to wake for payroll at %s, got %s", soon, got)
+	}
+	if got := leaseWake(now, soon, false); !got.Equal(now.Add(renewInterval)) {
+		t.Fatalf("expected follower to wake after %s, got %s", renewInterval, got)
+	}
+	later := now.Add(maxSleep)
+	if got := leaseWake(now, later, true); !got.Equal(now.Add(renewInterval)) {
+		t.Fatalf("expected leader to wake to renew after %s, got %s", renewInterval, got)
+	}
+	if renewInterval*2 >= leaseTTL {
+		t.Fatalf("lease must survive a missed renewal")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if got := retryDelay(1); got != minRetry {
+		t.Fatalf("expected first retry after %s, got %s", minRetry, got)
+	}
+	if got := retryDelay(3); got != 4*minRetry {
+		t.Fatalf("expected third retry after %s, got %s", 4*minRetry, got)
+	}
+	if got := retryDelay(100); got != maxRetry {
+		t.Fatalf("expected retries to cap at %s, got %s", maxRetry, got)
 	}
 }
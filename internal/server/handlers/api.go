@@ -33,18 +33,65 @@ type APIHandler struct {
 type BudgetStore interface {
 	ListBudgets(ctx context.Context, userID *int64) ([]store.Budget, error)
 	GetBudget(ctx context.Context, id int64, userID *int64) (store.Budget, error)
-	CreateBudget(ctx context.Context, userID *int64, name string, payroll float64) (store.Budget, error)
-	UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll float64) (store.Budget, error)
+	CreateBudget(ctx context.Context, userID *int64, name string, payroll store.Cents) (store.Budget, error)
+	UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll store.Cents) (store.Budget, error)
 	DeleteBudget(ctx context.Context, id int64, userID *int64) error
-	GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (bool, []store.AutoBalanceSource, error)
-	UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, enabled bool, sources []store.AutoBalanceSource) error
-	RunMonthlyPayroll(ctx context.Context, now time.Time) (int, error)
+	GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (store.AutoBalanceConfig, error)
+	UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, cfg store.AutoBalanceConfig) error
+	RunPayroll(ctx context.Context, trigger string, userID *int64, now time.Time) (store.PayrollRun, error)
+	RunUserPayroll(ctx context.Context, userID int64, now time.Time) (store.PayrollRun, error)
 	RunBudgetPayroll(ctx context.Context, budgetID int64, userID *int64, now time.Time, force bool) (int, error)
+	PreviewPayroll(ctx context.Context, userID *int64, day *store.Date) ([]store.PayrollCredit, error)
+	ListPayrollRuns(ctx context.Context, userID *int64, query store.PayrollRunQuery) ([]store.PayrollRun, error)
+	GetPayrollRun(ctx context.Context, id int64, userID *int64) (store.PayrollRun, error)
+	GetLease(ctx context.Context, name string) (store.Lease, error)
+	UpdatePayrollSchedule(ctx context.Context, budgetID int64, userID *int64, sched store.PayrollSchedule) (store.Budget, error)
+	UpdateRolloverPolicy(ctx context.Context, budgetID int64, userID *int64, policy store.RolloverPolicy) (store.Budget, error)
+	ListPayrollOverrides(ctx context.Context, budgetID int64, userID *int64) ([]store.PayrollOverride, error)
+	CreatePayrollOverride(ctx context.Context, budgetID int64, userID *int64, in store.PayrollOverride) (store.PayrollOverride, error)
+	DeletePayrollOverride(ctx context.Context, budgetID, id int64, userID *int64) error
+	ListPayrollAmounts(ctx context.Context, budgetID int64, userID *int64) ([]store.PayrollAmount, error)
+	SetPayrollAmount(ctx context.Context, budgetID int64, userID *int64, in store.PayrollAmountInput) (store.PayrollAmount, error)
+	ListHolidays(ctx context.Context) ([]store.Holiday, error)
+	SetHoliday(ctx context.Context, h store.Holiday) (store.Holiday, error)
+	DeleteHoliday(ctx context.Context, day store.Date) error
+	ListIncomes(ctx context.Context, userID *int64) ([]store.Income, error)
+	GetIncome(ctx context.Context, id int64, userID *int64) (store.Income, error)
+	CreateIncome(ctx context.Context, userID *int64, in store.IncomeInput) (store.Income, error)
+	UpdateIncome(ctx context.Context, id int64, userID *int64, in store.IncomeInput) (store.Income, error)
+	DeleteIncome(ctx context.Context, id int64, userID *int64) error
+	ListIncomeDeposits(ctx context.Context, id int64, userID *int64) ([]store.IncomeDeposit, error)
+	RecordIncomeDeposit(ctx context.Context, id int64, userID *int64, period *store.Date, amount *store.Cents) (store.IncomeDeposit, error)
 	ListTransactions(ctx context.Context, budgetID int64, userID *int64, limit int) ([]store.Transaction, error)
-	ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, limit, offset int, search string) ([]store.Transaction, error)
-	CreateTransaction(ctx context.Context, budgetID int64, userID *int64, description string, credit bool, amount float64) (store.Transaction, error)
-	UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, description string, credit bool, amount float64) (store.Transaction, error)
+	ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, query store.TransactionQuery) ([]store.Transaction, error)
+	CreateTransaction(ctx context.Context, budgetID int64, userID *int64, in store.TransactionInput) (store.Transaction, error)
+	UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, in store.TransactionInput) (store.Transaction, error)
 	DeleteTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64) error
+	CreateTransfer(ctx context.Context, fromBudgetID, toBudgetID int64, userID *int64, description string, amount store.Cents, occurredOn *store.Date) (store.Transfer, error)
+	CreateSplit(ctx context.Context, userID *int64, description string, total store.Cents, occurredOn *store.Date, lines []store.SplitLine, remainderBudgetID *int64) (store.Split, error)
+	GetSplit(ctx context.Context, splitID int64, userID *int64) (store.Split, error)
+	UpdateSplit(ctx context.Context, splitID int64, userID *int64, description string, total store.Cents, occurredOn *store.Date, lines []store.SplitLine, remainderBudgetID *int64) (store.Split, error)
+	DeleteSplit(ctx context.Context, splitID int64, userID *int64) error
+	BalanceBudgets(ctx context.Context, userID *int64, req store.BalanceRequest) (store.BalanceResult, error)
+	ListBudgetHistory(ctx context.Context, budgetID int64, userID *int64, query store.AuditQuery) ([]store.AuditEntry, error)
+	ListTrash(ctx context.Context, userID *int64) (store.Trash, error)
+	RestoreBudget(ctx context.Context, id int64, userID *int64) (store.Budget, error)
+	RestoreTransaction(ctx context.Context, transactionID int64, userID *int64) (store.Transaction, error)
+	ListTags(ctx context.Context, userID *int64) ([]store.Tag, error)
+	CreateTag(ctx context.Context, userID *int64, name string) (store.Tag, error)
+	RenameTag(ctx context.Context, id int64, userID *int64, name string) (store.Tag, error)
+	DeleteTag(ctx context.Context, id int64, userID *int64) error
+	SearchPayees(ctx context.Context, userID *int64, q string, limit int) ([]store.Payee, error)
+	CreatePayee(ctx context.Context, userID *int64, name string, aliases []store.PayeeAlias) (store.Payee, error)
+	UpdatePayee(ctx context.Context, id int64, userID *int64, name string, aliases []store.PayeeAlias) (store.Payee, error)
+	DeletePayee(ctx context.Context, id int64, userID *int64) error
+	MergePayees(ctx context.Context, targetID, sourceID int64, userID *int64) (store.Payee, error)
+	ListReconciliations(ctx context.Context, budgetID int64, userID *int64) ([]store.Reconciliation, error)
+	GetReconciliation(ctx context.Context, budgetID, id int64, userID *int64) (store.Reconciliation, error)
+	StartReconciliation(ctx context.Context, budgetID int64, userID *int64, statementDate store.Date, statementBalance store.Cents) (store.Reconciliation, error)
+	ClearTransactions(ctx context.Context, budgetID, id int64, userID *int64, transactionIDs []int64, cleared bool) (store.Reconciliation, error)
+	FinishReconciliation(ctx context.Context, budgetID, id int64, userID *int64, adjust bool) (store.Reconciliation, error)
+	CancelReconciliation(ctx context.Context, budgetID, id int64, userID *int64) error
 	ListAPIKeys(ctx context.Context, userID int64) ([]store.APIKey, error)
 	CreateAPIKey(ctx context.Context, userID int64, name string) (store.APIKey, string, error)
 	DeleteAPIKey(ctx context.Context, userID, keyID int64) error
@@ -78,9 +125,26 @@ func (h *APIHandler) Router() http.Handler {
 	mux.HandleFunc("/", h.index)
 	mux.HandleFunc("/budgets", h.handleBudgets)
 	mux.HandleFunc("/budgets/", h.handleBudgetByID)
+	mux.HandleFunc("/splits", h.handleSplits)
+	mux.HandleFunc("/splits/", h.handleSplitByID)
 	mux.HandleFunc("/api-keys", h.handleAPIKeys)
 	mux.HandleFunc("/api-keys/", h.handleAPIKeyByID)
+	mux.HandleFunc("/balance", h.handleBalance)
+	mux.HandleFunc("/tags", h.handleTags)
+	mux.HandleFunc("/tags/", h.handleTagByID)
+	mux.HandleFunc("/payees", h.handlePayees)
+	mux.HandleFunc("/payees/", h.handlePayeeByID)
+	mux.HandleFunc("/trash", h.handleTrash)
+	mux.HandleFunc("/trash/", h.handleTrashRestore)
 	mux.HandleFunc("/payroll/run", h.handlePayrollRun)
+	mux.HandleFunc("/payroll/preview", h.handlePayrollPreview)
+	mux.HandleFunc("/payroll/runs", h.handlePayrollRuns)
+	mux.HandleFunc("/payroll/runs/", h.handlePayrollRunByID)
+	mux.HandleFunc("/payroll/scheduler", h.handlePayrollScheduler)
+	mux.HandleFunc("/payroll/holidays", h.handlePayrollHolidays)
+	mux.HandleFunc("/payroll/holidays/", h.handlePayrollHolidays)
+	mux.HandleFunc("/incomes", h.handleIncomes)
+	mux.HandleFunc("/incomes/", h.handleIncomeByID)
 	return mux
 }
 
@@ -114,19 +178,70 @@ func (h *APIHandler) index(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *APIHandler) handlePayrollRun(w http.ResponseWriter, r *http.Request) {
-	if _, ok := h.requireUser(w, r); !ok {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
 		return
 	}
 	if r.Method != http.MethodPost {
 		methodNotAllowed(w, http.MethodPost)
 		return
 	}
-	count, err := h.store.RunMonthlyPayroll(r.Context(), time.Now())
+	var req struct {
+		All bool `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+
+	var run store.PayrollRun
+	var err error
+	switch {
+	case req.All:
+		if !h.requireAdmin(w, r, userID, "only admins can run payroll for every budget") {
+			return
+		}
+		run, err = h.store.RunPayroll(r.Context(), store.PayrollTriggerAdmin, userID, time.Now())
+	case userID == nil:
+		// Without user auth every budget already belongs to the caller.
+		run, err = h.store.RunPayroll(r.Context(), store.PayrollTriggerManual, nil, time.Now())
+	default:
+		run, err = h.store.RunUserPayroll(r.Context(), *userID, time.Now())
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to run payroll")
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]any{"count": count})
+	if run.Budgets == nil {
+		run.Budgets = []store.PayrollCredit{}
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"count": run.CreditCount, "run": run})
+}
+
+// requireAdmin writes a 403 with message and returns false unless the caller
+// is an admin.
+func (h *APIHandler) requireAdmin(w http.ResponseWriter, r *http.Request, userID *int64, message string) bool {
+	if !h.isAdmin(userID) {
+		respondError(w, http.StatusForbidden, message)
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether the caller may act on every budget: a user whose id
+// is listed in ADMIN_USER_IDS, or any caller when user auth is off. Admin is
+// keyed on ids the operator sets rather than on emails, which anyone can
+// register a passkey for.
+func (h *APIHandler) isAdmin(userID *int64) bool {
+	if userID == nil {
+		return true
+	}
+	for _, id := range h.cfg.AdminUserIDs {
+		if id == *userID {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *APIHandler) runBudgetPayroll(w http.ResponseWriter, r *http.Request, id int64, userID *int64) {
@@ -142,6 +257,38 @@ func (h *APIHandler) runBudgetPayroll(w http.ResponseWriter, r *http.Request, id
 	respondJSON(w, http.StatusOK, map[string]any{"count": count})
 }
 
+// respondPayrollSchedule writes a budget's payroll schedule with its next pay
+// date.
+func respondPayrollSchedule(w http.ResponseWriter, budget store.Budget, err error, failure string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "budget not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, failure)
+	default:
+		respondJSON(w, http.StatusOK, map[string]any{
+			"schedule": budget.PayrollSchedule,
+			"next_due": budget.PayrollSchedule.NextAfter(time.Now()),
+		})
+	}
+}
+
+// respondRolloverPolicy writes a budget's rollover policy.
+func respondRolloverPolicy(w http.ResponseWriter, budget store.Budget, err error, failure string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "budget not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, failure)
+	default:
+		respondJSON(w, http.StatusOK, budget.Rollover)
+	}
+}
+
 func (h *APIHandler) requireUser(w http.ResponseWriter, r *http.Request) (*int64, bool) {
 	userID := auth.UserIDFromContext(r.Context())
 	if h.cfg.JWTSecret != "" && userID == nil {
@@ -627,8 +774,8 @@ func (h *APIHandler) listBudgets(w http.ResponseWriter, r *http.Request) {
 
 func (h *APIHandler) createBudget(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name    string  `json:"name"`
-		Payroll float64 `json:"payroll"`
+		Name    string      `json:"name"`
+		Payroll store.Cents `json:"payroll"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid JSON payload")
@@ -764,6 +911,15 @@ func (h *APIHandler) handleBudgetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 2 && parts[1] == "transfers" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.createTransfer(w, r, id, userID)
+		return
+	}
+
 	if len(parts) == 2 && parts[1] == "shares" {
 		switch r.Method {
 		case http.MethodGet:
@@ -790,6 +946,20 @@ func (h *APIHandler) handleBudgetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) >= 2 && len(parts) <= 4 && parts[1] == "reconciliations" {
+		h.handleReconciliations(w, r, id, userID, parts[2:])
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "history" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.listHistory(w, r, id, userID)
+		return
+	}
+
 	if len(parts) == 3 && parts[1] == "payroll" && parts[2] == "run" {
 		if r.Method != http.MethodPost {
 			methodNotAllowed(w, http.MethodPost)
@@ -799,6 +969,63 @@ func (h *APIHandler) handleBudgetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 3 && parts[1] == "payroll" && parts[2] == "runs" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		h.listPayrollRuns(w, r, userID, &id)
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "payroll" && parts[2] == "amounts" {
+		h.handlePayrollAmounts(w, r, id, userID)
+		return
+	}
+
+	if len(parts) >= 3 && len(parts) <= 4 && parts[1] == "payroll" && parts[2] == "overrides" {
+		h.handlePayrollOverrides(w, r, id, userID, parts[3:])
+		return
+	}
+
+	if len(parts) == 3 && parts[1] == "payroll" && parts[2] == "schedule" {
+		switch r.Method {
+		case http.MethodGet:
+			budget, err := h.store.GetBudget(r.Context(), id, userID)
+			respondPayrollSchedule(w, budget, err, "failed to load payroll schedule")
+		case http.MethodPut, http.MethodPatch:
+			var sched store.PayrollSchedule
+			if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid JSON payload")
+				return
+			}
+			budget, err := h.store.UpdatePayrollSchedule(r.Context(), id, userID, sched)
+			respondPayrollSchedule(w, budget, err, "failed to update payroll schedule")
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch)
+		}
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "rollover" {
+		switch r.Method {
+		case http.MethodGet:
+			budget, err := h.store.GetBudget(r.Context(), id, userID)
+			respondRolloverPolicy(w, budget, err, "failed to load rollover policy")
+		case http.MethodPut, http.MethodPatch:
+			var policy store.RolloverPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid JSON payload")
+				return
+			}
+			budget, err := h.store.UpdateRolloverPolicy(r.Context(), id, userID, policy)
+			respondRolloverPolicy(w, budget, err, "failed to update rollover policy")
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch)
+		}
+		return
+	}
+
 	respondError(w, http.StatusNotFound, "not found")
 }
 
@@ -817,8 +1044,8 @@ func (h *APIHandler) getBudget(w http.ResponseWriter, r *http.Request, id int64,
 
 func (h *APIHandler) updateBudget(w http.ResponseWriter, r *http.Request, id int64, userID *int64) {
 	var req struct {
-		Name    string  `json:"name"`
-		Payroll float64 `json:"payroll"`
+		Name    string      `json:"name"`
+		Payroll store.Cents `json:"payroll"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid JSON payload")
@@ -860,7 +1087,7 @@ func (h *APIHandler) deleteBudget(w http.ResponseWriter, r *http.Request, id int
 }
 
 func (h *APIHandler) getAutoBalanceConfig(w http.ResponseWriter, r *http.Request, id int64, userID *int64) {
-	enabled, sources, err := h.store.GetAutoBalanceConfig(r.Context(), id, userID)
+	cfg, err := h.store.GetAutoBalanceConfig(r.Context(), id, userID)
 	if errors.Is(err, store.ErrNotFound) {
 		respondError(w, http.StatusNotFound, "budget not found")
 		return
@@ -869,20 +1096,14 @@ func (h *APIHandler) getAutoBalanceConfig(w http.ResponseWriter, r *http.Request
 		respondError(w, http.StatusInternalServerError, "failed to load auto-balance config")
 		return
 	}
-	if sources == nil {
-		sources = []store.AutoBalanceSource{}
+	if cfg.Sources == nil {
+		cfg.Sources = []store.AutoBalanceSource{}
 	}
-	respondJSON(w, http.StatusOK, map[string]any{
-		"enabled": enabled,
-		"sources": sources,
-	})
+	respondJSON(w, http.StatusOK, cfg)
 }
 
 func (h *APIHandler) updateAutoBalanceConfig(w http.ResponseWriter, r *http.Request, id int64, userID *int64) {
-	var req struct {
-		Enabled bool                      `json:"enabled"`
-		Sources []store.AutoBalanceSource `json:"sources"`
-	}
+	var req store.AutoBalanceConfig
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "invalid JSON payload")
 		return
@@ -908,11 +1129,15 @@ func (h *APIHandler) updateAutoBalanceConfig(w http.ResponseWriter, r *http.Requ
 		seen[source.SourceBudgetID] = struct{}{}
 	}
 
-	if err := h.store.UpdateAutoBalanceConfig(r.Context(), id, userID, req.Enabled, req.Sources); err != nil {
+	if err := h.store.UpdateAutoBalanceConfig(r.Context(), id, userID, req); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			respondError(w, http.StatusNotFound, "budget not found")
 			return
 		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "failed to update auto-balance config")
 		return
 	}
@@ -933,9 +1158,37 @@ func (h *APIHandler) listTransactions(w http.ResponseWriter, r *http.Request, bu
 			offset = parsed
 		}
 	}
-	search := strings.TrimSpace(q.Get("q"))
+	query := store.TransactionQuery{
+		Limit:  limit,
+		Offset: offset,
+		Search: strings.TrimSpace(q.Get("q")),
+		Tag:    strings.TrimSpace(q.Get("tag")),
+	}
+	for _, bound := range []struct {
+		name string
+		dst  **store.Date
+	}{{"from", &query.From}, {"to", &query.To}} {
+		value := q.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := store.ParseDate(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, bound.name+" must be a YYYY-MM-DD date")
+			return
+		}
+		*bound.dst = &parsed
+	}
+	if p := q.Get("payee_id"); p != "" {
+		payeeID, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "payee_id must be an integer")
+			return
+		}
+		query.PayeeID = &payeeID
+	}
 
-	txns, err := h.store.ListTransactionsPaged(r.Context(), budgetID, userID, limit, offset, search)
+	txns, err := h.store.ListTransactionsPaged(r.Context(), budgetID, userID, query)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			respondError(w, http.StatusNotFound, "budget not found")
@@ -959,10 +1212,14 @@ func (h *APIHandler) listTransactions(w http.ResponseWriter, r *http.Request, bu
 
 func (h *APIHandler) createTransaction(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
 	var req struct {
-		Description string  `json:"description"`
-		Credit      bool    `json:"credit"`
-		Amount      float64 `json:"amount"`
-		UserID      *int64  `json:"user_id"`
+		Description string      `json:"description"`
+		Credit      bool        `json:"credit"`
+		Amount      store.Cents `json:"amount"`
+		OccurredOn  *store.Date `json:"occurred_on"`
+		Tags        []string    `json:"tags"`
+		Payee       *string     `json:"payee"`
+		Cleared     *bool       `json:"cleared"`
+		UserID      *int64      `json:"user_id"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -979,11 +1236,23 @@ func (h *APIHandler) createTransaction(w http.ResponseWriter, r *http.Request, b
 		return
 	}
 
-	txn, err := h.store.CreateTransaction(r.Context(), budgetID, userID, req.Description, req.Credit, req.Amount)
+	txn, err := h.store.CreateTransaction(r.Context(), budgetID, userID, store.TransactionInput{
+		Description: req.Description,
+		Credit:      req.Credit,
+		Amount:      req.Amount,
+		OccurredOn:  req.OccurredOn,
+		Tags:        req.Tags,
+		Payee:       req.Payee,
+		Cleared:     req.Cleared,
+	})
 	if errors.Is(err, store.ErrNotFound) {
 		respondError(w, http.StatusNotFound, "budget not found")
 		return
 	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to create transaction")
 		return
@@ -993,9 +1262,13 @@ func (h *APIHandler) createTransaction(w http.ResponseWriter, r *http.Request, b
 
 func (h *APIHandler) updateTransaction(w http.ResponseWriter, r *http.Request, budgetID, txnID int64, userID *int64) {
 	var req struct {
-		Description string  `json:"description"`
-		Credit      bool    `json:"credit"`
-		Amount      float64 `json:"amount"`
+		Description string      `json:"description"`
+		Credit      bool        `json:"credit"`
+		Amount      store.Cents `json:"amount"`
+		OccurredOn  *store.Date `json:"occurred_on"`
+		Tags        []string    `json:"tags"`
+		Payee       *string     `json:"payee"`
+		Cleared     *bool       `json:"cleared"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1012,11 +1285,23 @@ func (h *APIHandler) updateTransaction(w http.ResponseWriter, r *http.Request, b
 		return
 	}
 
-	txn, err := h.store.UpdateTransaction(r.Context(), budgetID, txnID, userID, req.Description, req.Credit, req.Amount)
+	txn, err := h.store.UpdateTransaction(r.Context(), budgetID, txnID, userID, store.TransactionInput{
+		Description: req.Description,
+		Credit:      req.Credit,
+		Amount:      req.Amount,
+		OccurredOn:  req.OccurredOn,
+		Tags:        req.Tags,
+		Payee:       req.Payee,
+		Cleared:     req.Cleared,
+	})
 	if errors.Is(err, store.ErrNotFound) {
 		respondError(w, http.StatusNotFound, "transaction not found")
 		return
 	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to update transaction")
 		return
@@ -1030,9 +1315,59 @@ func (h *APIHandler) deleteTransaction(w http.ResponseWriter, r *http.Request, b
 		respondError(w, http.StatusNotFound, "transaction not found")
 		return
 	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "failed to delete transaction")
 		return
 	}
 	respondJSON(w, http.StatusNoContent, nil)
 }
+
+func (h *APIHandler) createTransfer(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
+	var req struct {
+		ToBudgetID  int64       `json:"to_budget_id"`
+		Description string      `json:"description"`
+		Amount      store.Cents `json:"amount"`
+		OccurredOn  *store.Date `json:"occurred_on"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Description == "" {
+		respondError(w, http.StatusBadRequest, "description is required")
+		return
+	}
+	if req.ToBudgetID <= 0 {
+		respondError(w, http.StatusBadRequest, "to_budget_id must be provided")
+		return
+	}
+	if req.ToBudgetID == budgetID {
+		respondError(w, http.StatusBadRequest, "cannot transfer to the same budget")
+		return
+	}
+	if req.Amount <= 0 {
+		respondError(w, http.StatusBadRequest, "amount must be greater than 0")
+		return
+	}
+
+	transfer, err := h.store.CreateTransfer(r.Context(), budgetID, req.ToBudgetID, userID, req.Description, req.Amount, req.OccurredOn)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create transfer")
+		return
+	}
+	respondJSON(w, http.StatusCreated, transfer)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -30,6 +31,30 @@ type fakeStore struct {
 	removeErr     error
 	payrollCount  int
 	payrollErr    error
+	transfer      *store.Transfer
+	transferErr   error
+	split         *store.Split
+	balanceReq    *store.BalanceRequest
+	txnQuery      *store.TransactionQuery
+	txnInput      *store.TransactionInput
+	trash         store.Trash
+	historyQuery  *store.AuditQuery
+	tags          []store.Tag
+	payeeSearch   string
+	payees        []store.Payee
+	merged        [2]int64
+	recs          []store.Reconciliation
+	clearedIDs    []int64
+	previewDay    *store.Date
+	runs          []store.PayrollRun
+	runQuery      *store.PayrollRunQuery
+	overrides     []store.PayrollOverride
+	amounts       []store.PayrollAmount
+	holidays      []store.Holiday
+	autoBalance   store.AutoBalanceConfig
+	lease         *store.Lease
+	incomes       []store.Income
+	deposits      []store.IncomeDeposit
 }
 
 func (f *fakeStore) ListBudgets(ctx context.Context, userID *int64) ([]store.Budget, error) {
@@ -45,7 +70,7 @@ func (f *fakeStore) GetBudget(ctx context.Context, id int64, userID *int64) (sto
 	return store.Budget{}, store.ErrNotFound
 }
 
-func (f *fakeStore) CreateBudget(ctx context.Context, userID *int64, name string, payroll float64) (store.Budget, error) {
+func (f *fakeStore) CreateBudget(ctx context.Context, userID *int64, name string, payroll store.Cents) (store.Budget, error) {
 	b := store.Budget{
 		ID:        int64(len(f.budgets) + 1),
 		Name:      name,
@@ -57,7 +82,7 @@ func (f *fakeStore) CreateBudget(ctx context.Context, userID *int64, name string
 	return b, nil
 }
 
-func (f *fakeStore) UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll float64) (store.Budget, error) {
+func (f *fakeStore) UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll store.Cents) (store.Budget, error) {
 	for i, b := range f.budgets {
 		if b.ID == id {
 			f.budgets[i].Name = name
@@ -80,35 +105,277 @@ func (f *fakeStore) DeleteBudget(ctx context.Context, id int64, userID *int64) e
 	return store.ErrNotFound
 }
 
-func (f *fakeStore) GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (bool, []store.AutoBalanceSource, error) {
-	return false, nil, nil
+func (f *fakeStore) GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (store.AutoBalanceConfig, error) {
+	return f.autoBalance, nil
 }
 
-func (f *fakeStore) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, enabled bool, sources []store.AutoBalanceSource) error {
+func (f *fakeStore) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, cfg store.AutoBalanceConfig) error {
+	f.autoBalance = cfg
 	return nil
 }
 
-func (f *fakeStore) RunMonthlyPayroll(ctx context.Context, now time.Time) (int, error) {
-	return f.payrollCount, f.payrollErr
+func (f *fakeStore) RunPayroll(ctx context.Context, trigger string, userID *int64, now time.Time) (store.PayrollRun, error) {
+	return store.PayrollRun{Trigger: trigger, UserID: userID, AsOf: now, Status: store.PayrollRunSucceeded, CreditCount: f.payrollCount}, f.payrollErr
+}
+
+func (f *fakeStore) RunUserPayroll(ctx context.Context, userID int64, now time.Time) (store.PayrollRun, error) {
+	var credits []store.PayrollCredit
+	for _, b := range f.budgets {
+		credits = append(credits, store.PayrollCredit{BudgetID: b.ID, BudgetName: b.Name, Amount: b.Payroll, Status: store.PayrollCreditCredited})
+	}
+	count := len(credits)
+	if f.payrollCount > 0 {
+		count = f.payrollCount
+	}
+	return store.PayrollRun{Trigger: store.PayrollTriggerManual, UserID: &userID, AsOf: now, Status: store.PayrollRunSucceeded, CreditCount: count, Budgets: credits}, f.payrollErr
+}
+
+func (f *fakeStore) ListPayrollRuns(ctx context.Context, userID *int64, query store.PayrollRunQuery) ([]store.PayrollRun, error) {
+	f.runQuery = &query
+	var out []store.PayrollRun
+	for _, run := range f.runs {
+		if query.BudgetID != nil && (run.BudgetID == nil || *run.BudgetID != *query.BudgetID) {
+			continue
+		}
+		out = append(out, run)
+	}
+	return out, nil
+}
+
+func (f *fakeStore) GetLease(ctx context.Context, name string) (store.Lease, error) {
+	if f.lease == nil || f.lease.Name != name {
+		return store.Lease{}, store.ErrNotFound
+	}
+	return *f.lease, nil
+}
+
+func (f *fakeStore) GetPayrollRun(ctx context.Context, id int64, userID *int64) (store.PayrollRun, error) {
+	for _, run := range f.runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return store.PayrollRun{}, store.ErrNotFound
 }
 
 func (f *fakeStore) RunBudgetPayroll(ctx context.Context, budgetID int64, userID *int64, now time.Time, force bool) (int, error) {
 	return 0, nil
 }
 
+func (f *fakeStore) PreviewPayroll(ctx context.Context, userID *int64, day *store.Date) ([]store.PayrollCredit, error) {
+	f.previewDay = day
+	var out []store.PayrollCredit
+	period := store.DateOf(time.Now())
+	if day != nil {
+		period = *day
+	}
+	for _, b := range f.budgets {
+		if b.Payroll > 0 {
+			out = append(out, store.PayrollCredit{BudgetID: b.ID, BudgetName: b.Name, Period: &period, Amount: b.Payroll, Status: store.PayrollCreditCredited})
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) ListIncomes(ctx context.Context, userID *int64) ([]store.Income, error) {
+	return f.incomes, nil
+}
+
+func (f *fakeStore) GetIncome(ctx context.Context, id int64, userID *int64) (store.Income, error) {
+	for _, inc := range f.incomes {
+		if inc.ID == id {
+			return inc, nil
+		}
+	}
+	return store.Income{}, store.ErrNotFound
+}
+
+func (f *fakeStore) CreateIncome(ctx context.Context, userID *int64, in store.IncomeInput) (store.Income, error) {
+	if in.Amount <= 0 {
+		return store.Income{}, fmt.Errorf("%w: amount must be > 0", store.ErrInvalidInput)
+	}
+	inc := store.Income{ID: int64(len(f.incomes) + 1), Name: in.Name, Amount: in.Amount, Allocations: in.Allocations, RemainderBudgetID: in.RemainderBudgetID, AutoPost: in.AutoPost == nil || *in.AutoPost}
+	f.incomes = append(f.incomes, inc)
+	return inc, nil
+}
+
+func (f *fakeStore) UpdateIncome(ctx context.Context, id int64, userID *int64, in store.IncomeInput) (store.Income, error) {
+	for i := range f.incomes {
+		if f.incomes[i].ID == id {
+			f.incomes[i].Name, f.incomes[i].Amount, f.incomes[i].Allocations = in.Name, in.Amount, in.Allocations
+			return f.incomes[i], nil
+		}
+	}
+	return store.Income{}, store.ErrNotFound
+}
+
+func (f *fakeStore) DeleteIncome(ctx context.Context, id int64, userID *int64) error {
+	for i := range f.incomes {
+		if f.incomes[i].ID == id {
+			f.incomes = append(f.incomes[:i], f.incomes[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (f *fakeStore) ListIncomeDeposits(ctx context.Context, id int64, userID *int64) ([]store.IncomeDeposit, error) {
+	if _, err := f.GetIncome(ctx, id, userID); err != nil {
+		return nil, err
+	}
+	return f.deposits, nil
+}
+
+func (f *fakeStore) RecordIncomeDeposit(ctx context.Context, id int64, userID *int64, period *store.Date, amount *store.Cents) (store.IncomeDeposit, error) {
+	inc, err := f.GetIncome(ctx, id, userID)
+	if err != nil {
+		return store.IncomeDeposit{}, err
+	}
+	dep := store.IncomeDeposit{ID: int64(len(f.deposits) + 1), IncomeID: id, Amount: inc.Amount}
+	if period != nil {
+		dep.Period = *period
+	}
+	if amount != nil {
+		dep.Amount = *amount
+	}
+	f.deposits = append(f.deposits, dep)
+	return dep, nil
+}
+
+func (f *fakeStore) UpdateRolloverPolicy(ctx context.Context, budgetID int64, userID *int64, policy store.RolloverPolicy) (store.Budget, error) {
+	policy, err := policy.Normalize(budgetID)
+	if err != nil {
+		return store.Budget{}, err
+	}
+	for i := range f.budgets {
+		if f.budgets[i].ID == budgetID {
+			f.budgets[i].Rollover = policy
+			return f.budgets[i], nil
+		}
+	}
+	return store.Budget{}, store.ErrNotFound
+}
+
+func (f *fakeStore) ListPayrollOverrides(ctx context.Context, budgetID int64, userID *int64) ([]store.PayrollOverride, error) {
+	out := []store.PayrollOverride{}
+	for _, o := range f.overrides {
+		if o.BudgetID == budgetID {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) CreatePayrollOverride(ctx context.Context, budgetID int64, userID *int64, in store.PayrollOverride) (store.PayrollOverride, error) {
+	for _, b := range f.budgets {
+		if b.ID != budgetID {
+			continue
+		}
+		o, err := in.Normalize(b.PayrollSchedule, store.DateOf(time.Now()))
+		if err != nil {
+			return store.PayrollOverride{}, err
+		}
+		o.ID, o.BudgetID = int64(len(f.overrides)+1), budgetID
+		f.overrides = append(f.overrides, o)
+		return o, nil
+	}
+	return store.PayrollOverride{}, store.ErrNotFound
+}
+
+func (f *fakeStore) DeletePayrollOverride(ctx context.Context, budgetID, id int64, userID *int64) error {
+	for i, o := range f.overrides {
+		if o.ID == id && o.BudgetID == budgetID {
+			f.overrides = append(f.overrides[:i], f.overrides[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (f *fakeStore) ListPayrollAmounts(ctx context.Context, budgetID int64, userID *int64) ([]store.PayrollAmount, error) {
+	out := []store.PayrollAmount{}
+	for i := len(f.amounts) - 1; i >= 0; i-- {
+		if f.amounts[i].BudgetID == budgetID {
+			out = append(out, f.amounts[i])
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) SetPayrollAmount(ctx context.Context, budgetID int64, userID *int64, in store.PayrollAmountInput) (store.PayrollAmount, error) {
+	if in.Amount < 0 {
+		return store.PayrollAmount{}, fmt.Errorf("%w: amount must be >= 0", store.ErrInvalidInput)
+	}
+	for _, b := range f.budgets {
+		if b.ID != budgetID {
+			continue
+		}
+		var effective *store.Date
+		if in.Effective != "" && in.Effective != store.PayrollEffectiveNow && in.Effective != store.PayrollEffectiveNextPeriod {
+			day, err := store.ParseDate(in.Effective)
+			if err != nil {
+				return store.PayrollAmount{}, fmt.Errorf("%w: %v", store.ErrInvalidInput, err)
+			}
+			effective = &day
+		}
+		a := store.PayrollAmount{ID: int64(len(f.amounts) + 1), BudgetID: budgetID, Amount: in.Amount, EffectiveOn: effective, UserID: userID}
+		f.amounts = append(f.amounts, a)
+		return a, nil
+	}
+	return store.PayrollAmount{}, store.ErrNotFound
+}
+
+func (f *fakeStore) ListHolidays(ctx context.Context) ([]store.Holiday, error) {
+	return append([]store.Holiday{}, f.holidays...), nil
+}
+
+func (f *fakeStore) SetHoliday(ctx context.Context, h store.Holiday) (store.Holiday, error) {
+	if h.Date.IsZero() {
+		return store.Holiday{}, fmt.Errorf("%w: date is required", store.ErrInvalidInput)
+	}
+	f.holidays = append(f.holidays, h)
+	return h, nil
+}
+
+func (f *fakeStore) DeleteHoliday(ctx context.Context, day store.Date) error {
+	for i, h := range f.holidays {
+		if h.Date.Equal(day.Time) {
+			f.holidays = append(f.holidays[:i], f.holidays[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (f *fakeStore) UpdatePayrollSchedule(ctx context.Context, budgetID int64, userID *int64, sched store.PayrollSchedule) (store.Budget, error) {
+	sched, err := sched.Normalize()
+	if err != nil {
+		return store.Budget{}, err
+	}
+	for i := range f.budgets {
+		if f.budgets[i].ID == budgetID {
+			f.budgets[i].PayrollSchedule = sched
+			return f.budgets[i], nil
+		}
+	}
+	return store.Budget{}, store.ErrNotFound
+}
+
 func (f *fakeStore) ListTransactions(ctx context.Context, budgetID int64, userID *int64, limit int) ([]store.Transaction, error) {
 	return nil, nil
 }
 
-func (f *fakeStore) ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, limit, offset int, search string) ([]store.Transaction, error) {
+func (f *fakeStore) ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, query store.TransactionQuery) ([]store.Transaction, error) {
+	f.txnQuery = &query
 	return nil, nil
 }
 
-func (f *fakeStore) CreateTransaction(ctx context.Context, budgetID int64, userID *int64, description string, credit bool, amount float64) (store.Transaction, error) {
+func (f *fakeStore) CreateTransaction(ctx context.Context, budgetID int64, userID *int64, in store.TransactionInput) (store.Transaction, error) {
+	f.txnInput = &in
 	return store.Transaction{}, store.ErrNotFound
 }
 
-func (f *fakeStore) UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, description string, credit bool, amount float64) (store.Transaction, error) {
+func (f *fakeStore) UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, in store.TransactionInput) (store.Transaction, error) {
 	return store.Transaction{}, store.ErrNotFound
 }
 
@@ -116,6 +383,192 @@ func (f *fakeStore) DeleteTransaction(ctx context.Context, budgetID, transaction
 	return store.ErrNotFound
 }
 
+func (f *fakeStore) CreateTransfer(ctx context.Context, fromBudgetID, toBudgetID int64, userID *int64, description string, amount store.Cents, occurredOn *store.Date) (store.Transfer, error) {
+	if f.transferErr != nil {
+		return store.Transfer{}, f.transferErr
+	}
+	t := store.Transfer{ID: 1, FromBudgetID: fromBudgetID, ToBudgetID: toBudgetID, Description: description, Amount: amount}
+	f.transfer = &t
+	return t, nil
+}
+
+func (f *fakeStore) CreateSplit(ctx context.Context, userID *int64, description string, total store.Cents, occurredOn *store.Date, lines []store.SplitLine, remainderBudgetID *int64) (store.Split, error) {
+	sp := store.Split{ID: 1, Description: description, Total: total}
+	f.split = &sp
+	return sp, nil
+}
+
+func (f *fakeStore) GetSplit(ctx context.Context, splitID int64, userID *int64) (store.Split, error) {
+	if f.split != nil && f.split.ID == splitID {
+		return *f.split, nil
+	}
+	return store.Split{}, store.ErrNotFound
+}
+
+func (f *fakeStore) UpdateSplit(ctx context.Context, splitID int64, userID *int64, description string, total store.Cents, occurredOn *store.Date, lines []store.SplitLine, remainderBudgetID *int64) (store.Split, error) {
+	if f.split == nil || f.split.ID != splitID {
+		return store.Split{}, store.ErrNotFound
+	}
+	f.split.Description = description
+	f.split.Total = total
+	return *f.split, nil
+}
+
+func (f *fakeStore) DeleteSplit(ctx context.Context, splitID int64, userID *int64) error {
+	if f.split == nil || f.split.ID != splitID {
+		return store.ErrNotFound
+	}
+	f.split = nil
+	return nil
+}
+
+func (f *fakeStore) BalanceBudgets(ctx context.Context, userID *int64, req store.BalanceRequest) (store.BalanceResult, error) {
+	f.balanceReq = &req
+	return store.BalanceResult{DryRun: req.DryRun}, nil
+}
+
+func (f *fakeStore) ListBudgetHistory(ctx context.Context, budgetID int64, userID *int64, query store.AuditQuery) ([]store.AuditEntry, error) {
+	f.historyQuery = &query
+	return []store.AuditEntry{{ID: 1, BudgetID: budgetID, Entity: store.AuditTransaction, Action: store.AuditUpdate}}, nil
+}
+
+func (f *fakeStore) ListTrash(ctx context.Context, userID *int64) (store.Trash, error) {
+	return f.trash, nil
+}
+
+func (f *fakeStore) RestoreBudget(ctx context.Context, id int64, userID *int64) (store.Budget, error) {
+	for i, b := range f.trash.Budgets {
+		if b.ID == id {
+			f.trash.Budgets = append(f.trash.Budgets[:i], f.trash.Budgets[i+1:]...)
+			b.DeletedAt = nil
+			f.budgets = append(f.budgets, b)
+			return b, nil
+		}
+	}
+	return store.Budget{}, store.ErrNotFound
+}
+
+func (f *fakeStore) RestoreTransaction(ctx context.Context, transactionID int64, userID *int64) (store.Transaction, error) {
+	for i, t := range f.trash.Transactions {
+		if t.ID == transactionID {
+			f.trash.Transactions = append(f.trash.Transactions[:i], f.trash.Transactions[i+1:]...)
+			t.DeletedAt = nil
+			return t, nil
+		}
+	}
+	return store.Transaction{}, store.ErrNotFound
+}
+
+func (f *fakeStore) ListTags(ctx context.Context, userID *int64) ([]store.Tag, error) {
+	return f.tags, nil
+}
+
+func (f *fakeStore) CreateTag(ctx context.Context, userID *int64, name string) (store.Tag, error) {
+	for _, t := range f.tags {
+		if strings.EqualFold(t.Name, name) {
+			return store.Tag{}, fmt.Errorf("%w: tag %q already exists", store.ErrInvalidInput, name)
+		}
+	}
+	tag := store.Tag{ID: int64(len(f.tags) + 1), Name: name}
+	f.tags = append(f.tags, tag)
+	return tag, nil
+}
+
+func (f *fakeStore) RenameTag(ctx context.Context, id int64, userID *int64, name string) (store.Tag, error) {
+	for i, t := range f.tags {
+		if t.ID == id {
+			f.tags[i].Name = name
+			return f.tags[i], nil
+		}
+	}
+	return store.Tag{}, store.ErrNotFound
+}
+
+func (f *fakeStore) DeleteTag(ctx context.Context, id int64, userID *int64) error {
+	for i, t := range f.tags {
+		if t.ID == id {
+			f.tags = append(f.tags[:i], f.tags[i+1:]...)
+			return nil
+		}
+	}
+	return store.ErrNotFound
+}
+
+func (f *fakeStore) SearchPayees(ctx context.Context, userID *int64, q string, limit int) ([]store.Payee, error) {
+	f.payeeSearch = q
+	return f.payees, nil
+}
+
+func (f *fakeStore) CreatePayee(ctx context.Context, userID *int64, name string, aliases []store.PayeeAlias) (store.Payee, error) {
+	payee := store.Payee{ID: int64(len(f.payees) + 1), Name: name, Aliases: aliases}
+	f.payees = append(f.payees, payee)
+	return payee, nil
+}
+
+func (f *fakeStore) UpdatePayee(ctx context.Context, id int64, userID *int64, name string, aliases []store.PayeeAlias) (store.Payee, error) {
+	return store.Payee{}, store.ErrNotFound
+}
+
+func (f *fakeStore) DeletePayee(ctx context.Context, id int64, userID *int64) error {
+	return store.ErrNotFound
+}
+
+func (f *fakeStore) MergePayees(ctx context.Context, targetID, sourceID int64, userID *int64) (store.Payee, error) {
+	if targetID == sourceID {
+		return store.Payee{}, fmt.Errorf("%w: cannot merge a payee into itself", store.ErrInvalidInput)
+	}
+	f.merged = [2]int64{targetID, sourceID}
+	return store.Payee{ID: targetID}, nil
+}
+
+func (f *fakeStore) ListReconciliations(ctx context.Context, budgetID int64, userID *int64) ([]store.Reconciliation, error) {
+	return f.recs, nil
+}
+
+func (f *fakeStore) GetReconciliation(ctx context.Context, budgetID, id int64, userID *int64) (store.Reconciliation, error) {
+	for _, rec := range f.recs {
+		if rec.ID == id && rec.BudgetID == budgetID {
+			return rec, nil
+		}
+	}
+	return store.Reconciliation{}, store.ErrNotFound
+}
+
+func (f *fakeStore) StartReconciliation(ctx context.Context, budgetID int64, userID *int64, statementDate store.Date, statementBalance store.Cents) (store.Reconciliation, error) {
+	rec := store.Reconciliation{
+		ID:               int64(len(f.recs) + 1),
+		BudgetID:         budgetID,
+		StatementDate:    statementDate,
+		StatementBalance: statementBalance,
+		Status:           store.ReconciliationOpen,
+		Difference:       statementBalance,
+	}
+	f.recs = append(f.recs, rec)
+	return rec, nil
+}
+
+func (f *fakeStore) ClearTransactions(ctx context.Context, budgetID, id int64, userID *int64, transactionIDs []int64, cleared bool) (store.Reconciliation, error) {
+	f.clearedIDs = transactionIDs
+	return f.GetReconciliation(ctx, budgetID, id, userID)
+}
+
+func (f *fakeStore) FinishReconciliation(ctx context.Context, budgetID, id int64, userID *int64, adjust bool) (store.Reconciliation, error) {
+	rec, err := f.GetReconciliation(ctx, budgetID, id, userID)
+	if err != nil {
+		return rec, err
+	}
+	if rec.Difference != 0 && !adjust {
+		return store.Reconciliation{}, fmt.Errorf("%w: cleared balance differs from the statement by %s", store.ErrInvalidInput, rec.Difference)
+	}
+	rec.Status = store.ReconciliationFinished
+	return rec, nil
+}
+
+func (f *fakeStore) CancelReconciliation(ctx context.Context, budgetID, id int64, userID *int64) error {
+	_, err := f.GetReconciliation(ctx, budgetID, id, userID)
+	return err
+}
+
 func (f *fakeStore) ListAPIKeys(ctx context.Context, userID int64) ([]store.APIKey, error) {
 	return f.apiKeys, nil
 }
@@ -219,7 +672,7 @@ func (f *fakeStore) UpdatePasskeySignCount(ctx context.Context, credentialID str
 func TestListBudgets(t *testing.T) {
 	fs := &fakeStore{
 		budgets: []store.Budget{
-			{ID: 1, Name: "Household", Payroll: 1000, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			{ID: 1, Name: "Household", Payroll: 100000, CreatedAt: time.Now(), UpdatedAt: time.Now()},
 		},
 	}
 	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
@@ -275,7 +728,7 @@ func TestCreateBudget_Succeeds(t *testing.T) {
 	if w.Code != http.StatusCreated {
 		t.Fatalf("expected 201, got %d", w.Code)
 	}
-	if fs.createdBudget == nil || fs.createdBudget.Name != "Groceries" || fs.createdBudget.Payroll != 250 {
+	if fs.createdBudget == nil || fs.createdBudget.Name != "Groceries" || fs.createdBudget.Payroll != 25000 {
 		t.Fatalf("expected budget created, got %+v", fs.createdBudget)
 	}
 }
@@ -315,7 +768,7 @@ func TestGetBudget_NotFound(t *testing.T) {
 func TestUpdateBudget_Succeeds(t *testing.T) {
 	fs := &fakeStore{
 		budgets: []store.Budget{
-			{ID: 2, Name: "Rent", Payroll: 1000, CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			{ID: 2, Name: "Rent", Payroll: 100000, CreatedAt: time.Now(), UpdatedAt: time.Now()},
 		},
 	}
 	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
@@ -331,7 +784,7 @@ func TestUpdateBudget_Succeeds(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", w.Code)
 	}
-	if fs.updatedBudget == nil || fs.updatedBudget.Name != "Rent Updated" || fs.updatedBudget.Payroll != 1200 {
+	if fs.updatedBudget == nil || fs.updatedBudget.Name != "Rent Updated" || fs.updatedBudget.Payroll != 120000 {
 		t.Fatalf("expected updated budget, got %+v", fs.updatedBudget)
 	}
 }
@@ -411,3 +864,909 @@ func TestHandlePayrollRun_SucceedsForUser(t *testing.T) {
 		t.Fatalf("expected count 3, got %v", resp["count"])
 	}
 }
+
+func TestHandlePayrollRun_ScopesToCaller(t *testing.T) {
+	fs := &fakeStore{
+		budgets: []store.Budget{{ID: 1, Name: "Groceries", Payroll: 25000}},
+		user:    &store.User{ID: 7, Email: "pat@example.com"},
+	}
+	handler, err := NewAPIHandler(config.Config{JWTSecret: "secret", AdminUserIDs: []int64{1}}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	caller := int64(7)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payroll/run", strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), caller))
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var resp struct {
+		Count int              `json:"count"`
+		Run   store.PayrollRun `json:"run"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Run.Trigger != store.PayrollTriggerManual || resp.Count != 1 || len(resp.Run.Budgets) != 1 || resp.Run.Budgets[0].BudgetID != 1 {
+		t.Fatalf("expected a run over the caller's budget, got %+v", resp)
+	}
+
+	if w := post(`{"all":true}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin global run, got %d", w.Code)
+	}
+
+	fs.user.Email = "ops@example.com"
+	if w := post(`{"all":true}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an email that isn't an admin id, got %d", w.Code)
+	}
+
+	caller = 1
+	w = post(`{"all":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for an admin, got %d", w.Code)
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Run.Trigger != store.PayrollTriggerAdmin {
+		t.Fatalf("expected an admin run, got %+v", resp.Run)
+	}
+}
+
+func TestListTransactions_ParsesDateRange(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	bad := httptest.NewRequest(http.MethodGet, "/budgets/1/transactions?from=last-week", nil)
+	badW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(badW, bad)
+	if badW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", badW.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/budgets/1/transactions?from=2024-03-01&to=2024-03-31&q=milk", nil)
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	q := fs.txnQuery
+	if q == nil || q.From == nil || q.To == nil || q.Search != "milk" {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+	if q.From.String() != "2024-03-01" || q.To.String() != "2024-03-31" {
+		t.Fatalf("unexpected range: %s..%s", q.From, q.To)
+	}
+}
+
+func TestCreateTransaction_PassesOccurredOn(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"description":"Groceries","amount":42.1,"occurred_on":"2024-03-05"}`)
+	req := httptest.NewRequest(http.MethodPost, "/budgets/1/transactions", body)
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+
+	if fs.txnInput == nil || fs.txnInput.OccurredOn == nil || fs.txnInput.OccurredOn.String() != "2024-03-05" {
+		t.Fatalf("unexpected input: %+v", fs.txnInput)
+	}
+	if fs.txnInput.Amount != 4210 {
+		t.Fatalf("expected 4210 cents, got %d", fs.txnInput.Amount)
+	}
+}
+
+func TestTagsLifecycle(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	createW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(createW, httptest.NewRequest(http.MethodPost, "/tags", bytes.NewBufferString(`{"name":" Dining "}`)))
+	if createW.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createW.Code)
+	}
+	if len(fs.tags) != 1 || fs.tags[0].Name != "Dining" {
+		t.Fatalf("unexpected tags: %+v", fs.tags)
+	}
+
+	dupW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(dupW, httptest.NewRequest(http.MethodPost, "/tags", bytes.NewBufferString(`{"name":"dining"}`)))
+	if dupW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for duplicate, got %d", dupW.Code)
+	}
+
+	renameW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(renameW, httptest.NewRequest(http.MethodPatch, "/tags/1", bytes.NewBufferString(`{"name":"Eating out"}`)))
+	if renameW.Code != http.StatusOK || fs.tags[0].Name != "Eating out" {
+		t.Fatalf("expected rename, got %d %+v", renameW.Code, fs.tags)
+	}
+
+	listW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/tags", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", listW.Code)
+	}
+
+	deleteW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(deleteW, httptest.NewRequest(http.MethodDelete, "/tags/1", nil))
+	if deleteW.Code != http.StatusNoContent || len(fs.tags) != 0 {
+		t.Fatalf("expected delete, got %d %+v", deleteW.Code, fs.tags)
+	}
+
+	missingW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(missingW, httptest.NewRequest(http.MethodDelete, "/tags/1", nil))
+	if missingW.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", missingW.Code)
+	}
+}
+
+func TestTransactionsPassTagsAndPayee(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"description":"Tacos","amount":12,"tags":["Dining","Fun"],"payee":"Taqueria"}`)
+	handler.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/budgets/1/transactions", body))
+	if fs.txnInput == nil || len(fs.txnInput.Tags) != 2 || fs.txnInput.Tags[0] != "Dining" {
+		t.Fatalf("unexpected input: %+v", fs.txnInput)
+	}
+	if fs.txnInput.Payee == nil || *fs.txnInput.Payee != "Taqueria" {
+		t.Fatalf("expected payee to pass through, got %v", fs.txnInput.Payee)
+	}
+
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/budgets/1/transactions?tag=Dining", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if fs.txnQuery == nil || fs.txnQuery.Tag != "Dining" {
+		t.Fatalf("unexpected query: %+v", fs.txnQuery)
+	}
+}
+
+func TestPayeesAutocompleteAndMerge(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"name":"Costco","aliases":[{"pattern":"COSTCO WHOLESALE","match":"prefix"}]}`)
+	createW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(createW, httptest.NewRequest(http.MethodPost, "/payees", body))
+	if createW.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createW.Code)
+	}
+	if len(fs.payees) != 1 || len(fs.payees[0].Aliases) != 1 || fs.payees[0].Aliases[0].Match != store.PayeeMatchPrefix {
+		t.Fatalf("unexpected payees: %+v", fs.payees)
+	}
+
+	searchW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(searchW, httptest.NewRequest(http.MethodGet, "/payees?q=cost", nil))
+	if searchW.Code != http.StatusOK || fs.payeeSearch != "cost" {
+		t.Fatalf("expected search for cost, got %d %q", searchW.Code, fs.payeeSearch)
+	}
+
+	mergeW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(mergeW, httptest.NewRequest(http.MethodPost, "/payees/1/merge", bytes.NewBufferString(`{"source_payee_id":2}`)))
+	if mergeW.Code != http.StatusOK || fs.merged != [2]int64{1, 2} {
+		t.Fatalf("expected merge of 2 into 1, got %d %v", mergeW.Code, fs.merged)
+	}
+
+	selfW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(selfW, httptest.NewRequest(http.MethodPost, "/payees/1/merge", bytes.NewBufferString(`{"source_payee_id":1}`)))
+	if selfW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", selfW.Code)
+	}
+
+	getW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(getW, httptest.NewRequest(http.MethodGet, "/payees/1/merge", nil))
+	if getW.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", getW.Code)
+	}
+}
+
+func TestPayrollSchedule(t *testing.T) {
+	fs := &fakeStore{budgets: []store.Budget{{ID: 1, Name: "Groceries", PayrollSchedule: store.DefaultPayrollSchedule()}}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	getW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(getW, httptest.NewRequest(http.MethodGet, "/budgets/1/payroll/schedule", nil))
+	if getW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", getW.Code)
+	}
+	var got struct {
+		Schedule store.PayrollSchedule `json:"schedule"`
+		NextDue  time.Time             `json:"next_due"`
+	}
+	if err := json.NewDecoder(getW.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Schedule.Frequency != store.PayMonthly || got.NextDue.Day() != 1 {
+		t.Fatalf("unexpected default schedule: %+v", got)
+	}
+
+	putW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(putW, httptest.NewRequest(http.MethodPut, "/budgets/1/payroll/schedule", bytes.NewBufferString(`{"frequency":"biweekly","anchor":"2024-01-05"}`)))
+	if putW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", putW.Code, putW.Body.String())
+	}
+	if sched := fs.budgets[0].PayrollSchedule; sched.Frequency != store.PayBiweekly || sched.IntervalDays != 14 {
+		t.Fatalf("unexpected schedule: %+v", sched)
+	}
+
+	badW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(badW, httptest.NewRequest(http.MethodPut, "/budgets/1/payroll/schedule", bytes.NewBufferString(`{"frequency":"semimonthly","days":[1,10,20]}`)))
+	if badW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", badW.Code)
+	}
+
+	missingW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(missingW, httptest.NewRequest(http.MethodGet, "/budgets/9/payroll/schedule", nil))
+	if missingW.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", missingW.Code)
+	}
+}
+
+func TestPayrollPreview(t *testing.T) {
+	fs := &fakeStore{budgets: []store.Budget{{ID: 1, Name: "Groceries", Payroll: 40000}, {ID: 2, Name: "Fun", Payroll: 2500}, {ID: 3, Name: "Idle"}}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payroll/preview?at=2024-11-01", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if fs.previewDay == nil || fs.previewDay.String() != "2024-11-01" {
+		t.Fatalf("expected preview on 2024-11-01, got %v", fs.previewDay)
+	}
+	var resp struct {
+		Data []store.PayrollCredit `json:"data"`
+		Meta struct {
+			Count int         `json:"count"`
+			Total store.Cents `json:"total"`
+		} `json:"meta"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Meta.Count != 2 || resp.Meta.Total != 42500 || resp.Data[0].BudgetName != "Groceries" {
+		t.Fatalf("unexpected preview: %+v", resp)
+	}
+
+	badW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(badW, httptest.NewRequest(http.MethodGet, "/payroll/preview?at=soon", nil))
+	if badW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", badW.Code)
+	}
+
+	postW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(postW, httptest.NewRequest(http.MethodPost, "/payroll/preview", nil))
+	if postW.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", postW.Code)
+	}
+}
+
+func TestPayrollRunHistory(t *testing.T) {
+	budgetID := int64(4)
+	period := store.DateOf(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC))
+	fs := &fakeStore{runs: []store.PayrollRun{
+		{ID: 1, Trigger: store.PayrollTriggerScheduler, Status: store.PayrollRunSucceeded, CreditCount: 1, Budgets: []store.PayrollCredit{{BudgetID: 4, Period: &period, Amount: 1000, Status: store.PayrollCreditCredited}}},
+		{ID: 2, Trigger: store.PayrollTriggerBudget, BudgetID: &budgetID, Status: store.PayrollRunFailed, Error: "budget 4: boom"},
+	}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	listW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/payroll/runs?from=2024-03-01&to=2024-03-31", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", listW.Code)
+	}
+	if fs.runQuery == nil || fs.runQuery.From == nil || fs.runQuery.To == nil || fs.runQuery.To.Format("2006-01-02") != "2024-04-01" || fs.runQuery.BudgetID != nil {
+		t.Fatalf("unexpected query: %+v", fs.runQuery)
+	}
+	var list struct {
+		Data []store.PayrollRun `json:"data"`
+	}
+	if err := json.NewDecoder(listW.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list.Data) != 2 || list.Data[0].Budgets[0].Period.String() != "2024-03-01" {
+		t.Fatalf("unexpected runs: %+v", list.Data)
+	}
+
+	budgetW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(budgetW, httptest.NewRequest(http.MethodGet, "/budgets/4/payroll/runs", nil))
+	if budgetW.Code != http.StatusOK || fs.runQuery.BudgetID == nil || *fs.runQuery.BudgetID != 4 {
+		t.Fatalf("expected budget-scoped query, got %d %+v", budgetW.Code, fs.runQuery)
+	}
+
+	getW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(getW, httptest.NewRequest(http.MethodGet, "/payroll/runs/2", nil))
+	if getW.Code != http.StatusOK || !strings.Contains(getW.Body.String(), "boom") {
+		t.Fatalf("expected failed run, got %d %s", getW.Code, getW.Body.String())
+	}
+
+	missingW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(missingW, httptest.NewRequest(http.MethodGet, "/payroll/runs/9", nil))
+	if missingW.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", missingW.Code)
+	}
+
+	badW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(badW, httptest.NewRequest(http.MethodGet, "/payroll/runs?from=march", nil))
+	if badW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", badW.Code)
+	}
+}
+
+func TestPayrollSchedulerStatus(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{InstanceID: "api-1"}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	var status struct {
+		InstanceID string       `json:"instance_id"`
+		Lease      *store.Lease `json:"lease"`
+		Leader     bool         `json:"leader"`
+	}
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payroll/scheduler", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.InstanceID != "api-1" || status.Lease != nil || status.Leader {
+		t.Fatalf("expected no lease, got %+v", status)
+	}
+
+	fs.lease = &store.Lease{Name: store.PayrollLease, Holder: "api-2", Active: true}
+	w = httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payroll/scheduler", nil))
+	status.Lease = nil
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if status.Lease == nil || status.Lease.Holder != "api-2" || status.Leader {
+		t.Fatalf("expected api-2 to lead, got %+v", status)
+	}
+
+	fs.lease.Holder = "api-1"
+	w = httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payroll/scheduler", nil))
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !status.Leader {
+		t.Fatalf("expected api-1 to lead, got %+v", status)
+	}
+}
+
+func TestRolloverPolicy(t *testing.T) {
+	fs := &fakeStore{budgets: []store.Budget{{ID: 1, Name: "Fun"}, {ID: 2, Name: "Savings"}}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, httptest.NewRequest(method, "/budgets/1/rollover", strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodPut, `{"mode":"sweep","cap":100}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a sweep without target, got %d", w.Code)
+	}
+	if w := serve(http.MethodPut, `{"mode":"sweep","cap":100,"target_budget_id":1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for sweeping into itself, got %d", w.Code)
+	}
+	w := serve(http.MethodPut, `{"mode":"sweep","cap":100,"target_budget_id":2}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	var policy store.RolloverPolicy
+	if err := json.NewDecoder(w.Body).Decode(&policy); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if policy.Mode != store.RolloverSweep || policy.Cap != 10000 || policy.TargetBudgetID == nil || *policy.TargetBudgetID != 2 {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	if w := serve(http.MethodGet, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"mode":"sweep"`) {
+		t.Fatalf("expected stored policy, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPayrollOverrides(t *testing.T) {
+	fs := &fakeStore{budgets: []store.Budget{{ID: 1, Name: "Groceries", PayrollSchedule: store.PayrollSchedule{Frequency: store.PaySemimonthly, Days: []int{1, 15}}}}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/budgets/1/payroll/overrides", `{"kind":"skip","period":"2026-03-02"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a date that isn't a pay date, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/budgets/1/payroll/overrides", `{"kind":"amount","period":"2026-03-15"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an amount override without an amount, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/budgets/1/payroll/overrides", `{"kind":"pause","from":"2026-04-01","until":"2026-03-01"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a pause ending before it starts, got %d", w.Code)
+	}
+	w := serve(http.MethodPost, "/budgets/1/payroll/overrides", `{"kind":"amount","period":"2026-03-15","amount":42.5,"note":" bonus "}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var override store.PayrollOverride
+	if err := json.NewDecoder(w.Body).Decode(&override); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if override.Amount != 4250 || override.Period == nil || override.Period.String() != "2026-03-15" || override.Note != "bonus" {
+		t.Fatalf("unexpected override: %+v", override)
+	}
+	if w := serve(http.MethodPost, "/budgets/1/payroll/overrides", `{"kind":"pause","from":"2026-04-01","until":"2026-05-31"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a pause, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/budgets/1/payroll/overrides", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Fatalf("expected two overrides, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, fmt.Sprintf("/budgets/1/payroll/overrides/%d", override.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, fmt.Sprintf("/budgets/1/payroll/overrides/%d", override.ID), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted override, got %d", w.Code)
+	}
+}
+
+func TestPayrollAmounts(t *testing.T) {
+	fs := &fakeStore{budgets: []store.Budget{{ID: 1, Name: "Groceries", Payroll: 40000}}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/budgets/1/payroll/amounts", `{"amount":-5}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative amount, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/budgets/9/payroll/amounts", `{"amount":5}`); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown budget, got %d", w.Code)
+	}
+	w := serve(http.MethodPost, "/budgets/1/payroll/amounts", `{"amount":450.25,"effective":"2026-11-01"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var amount store.PayrollAmount
+	if err := json.NewDecoder(w.Body).Decode(&amount); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if amount.Amount != 45025 || amount.EffectiveOn == nil || amount.EffectiveOn.String() != "2026-11-01" {
+		t.Fatalf("unexpected payroll amount: %+v", amount)
+	}
+	if w := serve(http.MethodGet, "/budgets/1/payroll/amounts", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"effective_on":"2026-11-01"`) {
+		t.Fatalf("expected the dated change in the history, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, "/budgets/1/payroll/amounts", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+}
+
+func TestPayrollHolidays_AdminOnly(t *testing.T) {
+	fs := &fakeStore{user: &store.User{ID: 7, Email: "pat@example.com"}}
+	handler, err := NewAPIHandler(config.Config{JWTSecret: "secret", AdminUserIDs: []int64{1}}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	caller := int64(7)
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(auth.WithUserID(req.Context(), caller))
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/payroll/holidays", `{"date":"2026-12-25","name":"Christmas"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin, got %d", w.Code)
+	}
+	caller = 1
+	if w := serve(http.MethodPost, "/payroll/holidays", `{"name":"Someday"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a date, got %d", w.Code)
+	}
+	if w := serve(http.MethodPost, "/payroll/holidays", `{"date":"2026-12-25","name":"Christmas"}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	caller = 7
+	w := serve(http.MethodGet, "/payroll/holidays", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"date":"2026-12-25"`) {
+		t.Fatalf("expected the holiday list, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, "/payroll/holidays/2026-12-25", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-admin delete, got %d", w.Code)
+	}
+	caller = 1
+	if w := serve(http.MethodDelete, "/payroll/holidays/12-25", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad date, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/payroll/holidays/2026-12-25", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if len(fs.holidays) != 0 {
+		t.Fatalf("expected the holiday to be removed, got %+v", fs.holidays)
+	}
+}
+
+func TestAutoBalanceConfig_PrioritySources(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	body := `{"enabled":true,"trigger":"immediate","sources":[{"source_budget_id":2,"mode":"priority","priority":1},{"source_budget_id":3,"mode":"priority","priority":2},{"source_budget_id":4,"weight":1}]}`
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/budgets/1/auto-balance", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if fs.autoBalance.Trigger != store.AutoBalanceImmediate {
+		t.Fatalf("expected the immediate trigger, got %+v", fs.autoBalance)
+	}
+	if sources := fs.autoBalance.Sources; len(sources) != 3 || sources[1].Mode != store.AutoBalancePriority || sources[1].Priority != 2 {
+		t.Fatalf("unexpected sources: %+v", sources)
+	}
+
+	w = httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/budgets/1/auto-balance", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"mode":"priority","priority":1`) || !strings.Contains(w.Body.String(), `"trigger":"immediate"`) {
+		t.Fatalf("expected mode and priority in the payload, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIncomeWorkflow(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/incomes", `{"name":"Paycheck","amount":0}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a zero paycheck, got %d", w.Code)
+	}
+	w := serve(http.MethodPost, "/incomes", `{"name":"Paycheck","amount":3000,"allocations":[{"budget_id":1,"amount":1200},{"budget_id":2,"percent":12.5}],"remainder_budget_id":3}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	var income store.Income
+	if err := json.NewDecoder(w.Body).Decode(&income); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if income.Amount != 300000 || len(income.Allocations) != 2 || income.Allocations[1].Percent != 12.5 || !income.AutoPost {
+		t.Fatalf("unexpected income: %+v", income)
+	}
+
+	if w := serve(http.MethodPost, "/incomes/1/deposits", `{"period":"2024-03-15","amount":3100.50}`); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d %s", w.Code, w.Body.String())
+	}
+	if len(fs.deposits) != 1 || fs.deposits[0].Amount != 310050 || fs.deposits[0].Period.String() != "2024-03-15" {
+		t.Fatalf("unexpected deposit: %+v", fs.deposits)
+	}
+	if w := serve(http.MethodPost, "/incomes/1/deposits", ""); w.Code != http.StatusCreated || fs.deposits[1].Amount != 300000 {
+		t.Fatalf("expected a deposit of the usual amount, got %d %+v", w.Code, fs.deposits)
+	}
+	if w := serve(http.MethodGet, "/incomes/1/deposits", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Fatalf("expected two deposits, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/incomes/9/deposits", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown income, got %d", w.Code)
+	}
+	if w := serve(http.MethodDelete, "/incomes/1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if w := serve(http.MethodGet, "/incomes/1", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestReconciliationWorkflow(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	missingW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(missingW, httptest.NewRequest(http.MethodPost, "/budgets/1/reconciliations", bytes.NewBufferString(`{"statement_date":"2024-03-31"}`)))
+	if missingW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without balance, got %d", missingW.Code)
+	}
+
+	startW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(startW, httptest.NewRequest(http.MethodPost, "/budgets/1/reconciliations", bytes.NewBufferString(`{"statement_date":"2024-03-31","statement_balance":125.5}`)))
+	if startW.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", startW.Code)
+	}
+	if len(fs.recs) != 1 || fs.recs[0].StatementBalance != 12550 || fs.recs[0].StatementDate.String() != "2024-03-31" {
+		t.Fatalf("unexpected session: %+v", fs.recs)
+	}
+
+	clearW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(clearW, httptest.NewRequest(http.MethodPost, "/budgets/1/reconciliations/1/clear", bytes.NewBufferString(`{"transaction_ids":[4,5]}`)))
+	if clearW.Code != http.StatusOK || len(fs.clearedIDs) != 2 {
+		t.Fatalf("expected clear of 2 transactions, got %d %v", clearW.Code, fs.clearedIDs)
+	}
+
+	offW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(offW, httptest.NewRequest(http.MethodPost, "/budgets/1/reconciliations/1/finish", nil))
+	if offW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 while out of balance, got %d", offW.Code)
+	}
+
+	finishW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(finishW, httptest.NewRequest(http.MethodPost, "/budgets/1/reconciliations/1/finish", bytes.NewBufferString(`{"adjust":true}`)))
+	if finishW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", finishW.Code)
+	}
+
+	notFoundW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(notFoundW, httptest.NewRequest(http.MethodDelete, "/budgets/1/reconciliations/9", nil))
+	if notFoundW.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", notFoundW.Code)
+	}
+}
+
+func TestTrashListAndRestore(t *testing.T) {
+	deletedAt := time.Now().Add(-time.Hour)
+	fs := &fakeStore{trash: store.Trash{
+		Budgets:      []store.Budget{{ID: 3, Name: "Old", DeletedAt: &deletedAt}},
+		Transactions: []store.Transaction{{ID: 9, BudgetID: 1, DeletedAt: &deletedAt}},
+	}}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	listW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(listW, httptest.NewRequest(http.MethodGet, "/trash", nil))
+	if listW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", listW.Code)
+	}
+	var listed store.Trash
+	if err := json.NewDecoder(listW.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode trash: %v", err)
+	}
+	if len(listed.Budgets) != 1 || len(listed.Transactions) != 1 {
+		t.Fatalf("unexpected trash: %+v", listed)
+	}
+
+	restoreW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(restoreW, httptest.NewRequest(http.MethodPost, "/trash/budgets/3/restore", nil))
+	if restoreW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", restoreW.Code)
+	}
+	if len(fs.budgets) != 1 || fs.budgets[0].ID != 3 {
+		t.Fatalf("expected budget 3 restored, got %+v", fs.budgets)
+	}
+
+	txnW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(txnW, httptest.NewRequest(http.MethodPost, "/trash/transactions/9/restore", nil))
+	if txnW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", txnW.Code)
+	}
+
+	missingW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(missingW, httptest.NewRequest(http.MethodPost, "/trash/transactions/9/restore", nil))
+	if missingW.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", missingW.Code)
+	}
+
+	getW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(getW, httptest.NewRequest(http.MethodGet, "/trash/budgets/3/restore", nil))
+	if getW.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", getW.Code)
+	}
+}
+
+func TestListHistory_ParsesFilters(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	bad := httptest.NewRequest(http.MethodGet, "/budgets/1/history?actor_user_id=me", nil)
+	badW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(badW, bad)
+	if badW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", badW.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/budgets/1/history?entity=transaction&action=update&entity_id=5&actor_user_id=2&from=2024-03-01&to=2024-03-31&limit=10", nil)
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	q := fs.historyQuery
+	if q == nil || q.Entity != "transaction" || q.Action != "update" || q.Limit != 10 {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+	if q.EntityID == nil || *q.EntityID != 5 || q.ActorUserID == nil || *q.ActorUserID != 2 {
+		t.Fatalf("unexpected id filters: %+v", q)
+	}
+	wantTo := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	if q.From == nil || q.To == nil || !q.To.Equal(wantTo) {
+		t.Fatalf("expected to bound to cover March 31, got %v", q.To)
+	}
+}
+
+func TestCreateTransfer_ValidatesInput(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	bodies := []string{
+		`{"to_budget_id":1,"description":"Move","amount":5}`,
+		`{"to_budget_id":2,"description":"","amount":5}`,
+		`{"to_budget_id":2,"description":"Move","amount":0}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest(http.MethodPost, "/budgets/1/transfers", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if fs.transfer != nil {
+		t.Fatalf("expected no transfer to be created")
+	}
+}
+
+func TestCreateTransfer_Succeeds(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"to_budget_id":2,"description":"Move","amount":12.5}`)
+	req := httptest.NewRequest(http.MethodPost, "/budgets/1/transfers", body)
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	if fs.transfer == nil || fs.transfer.FromBudgetID != 1 || fs.transfer.ToBudgetID != 2 || fs.transfer.Amount != 1250 {
+		t.Fatalf("unexpected transfer: %+v", fs.transfer)
+	}
+}
+
+func TestSplitsLifecycle(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	invalid := httptest.NewRequest(http.MethodPost, "/splits", bytes.NewBufferString(`{"description":"Costco","total":50,"lines":[]}`))
+	invalidW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(invalidW, invalid)
+	if invalidW.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", invalidW.Code)
+	}
+
+	body := `{"description":"Costco","total":50,"lines":[{"budget_id":1,"amount":20}],"remainder_budget_id":2}`
+	createReq := httptest.NewRequest(http.MethodPost, "/splits", bytes.NewBufferString(body))
+	createW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(createW, createReq)
+	if createW.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", createW.Code)
+	}
+	if fs.split == nil || fs.split.Total != 5000 {
+		t.Fatalf("unexpected split: %+v", fs.split)
+	}
+
+	getReq := httptest.NewRequest(http.MethodGet, "/splits/1", nil)
+	getW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(getW, getReq)
+	if getW.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", getW.Code)
+	}
+
+	deleteReq := httptest.NewRequest(http.MethodDelete, "/splits/1", nil)
+	deleteW := httptest.NewRecorder()
+	handler.Router().ServeHTTP(deleteW, deleteReq)
+	if deleteW.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", deleteW.Code)
+	}
+}
+
+func TestBalance_DryRunPassesWeightsAndCaps(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"negative_budget_ids":[1],"positive_budget_ids":[2,3],"weights":{"2":3},"caps":{"3":10.5},"dry_run":true}`)
+	req := httptest.NewRequest(http.MethodPost, "/balance", body)
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if fs.balanceReq == nil || !fs.balanceReq.DryRun || len(fs.balanceReq.Sources) != 2 {
+		t.Fatalf("unexpected balance request: %+v", fs.balanceReq)
+	}
+	first, second := fs.balanceReq.Sources[0], fs.balanceReq.Sources[1]
+	if first.BudgetID != 2 || first.Weight != 3 || first.Cap != nil {
+		t.Fatalf("unexpected first source: %+v", first)
+	}
+	if second.BudgetID != 3 || second.Cap == nil || *second.Cap != 1050 {
+		t.Fatalf("unexpected second source: %+v", second)
+	}
+}
+
+func TestBalance_RequiresBothSides(t *testing.T) {
+	fs := &fakeStore{}
+	handler, err := NewAPIHandler(config.Config{}, fs, passkey.NewChallengeStore())
+	if err != nil {
+		t.Fatalf("NewAPIHandler error: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/balance", bytes.NewBufferString(`{"negative_budget_ids":[1]}`))
+	w := httptest.NewRecorder()
+	handler.Router().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
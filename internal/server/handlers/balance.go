@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+// balancePayload is the request body shared by POST /balance and the
+// balance_budgets MCP tool.
+type balancePayload struct {
+	NegativeBudgetIDs []int64               `json:"negative_budget_ids"`
+	PositiveBudgetIDs []int64               `json:"positive_budget_ids"`
+	Weights           map[int64]int         `json:"weights"`
+	Caps              map[int64]store.Cents `json:"caps"`
+	Description       string                `json:"description"`
+	DryRun            bool                  `json:"dry_run"`
+}
+
+func (p balancePayload) validate() string {
+	if len(p.NegativeBudgetIDs) == 0 || len(p.PositiveBudgetIDs) == 0 {
+		return "negative_budget_ids and positive_budget_ids are required"
+	}
+	for _, weight := range p.Weights {
+		if weight < 0 {
+			return "weights must be >= 0"
+		}
+	}
+	for _, limit := range p.Caps {
+		if limit < 0 {
+			return "caps must be >= 0"
+		}
+	}
+	return ""
+}
+
+func (p balancePayload) request() store.BalanceRequest {
+	sources := make([]store.BalanceSource, 0, len(p.PositiveBudgetIDs))
+	for _, id := range p.PositiveBudgetIDs {
+		source := store.BalanceSource{BudgetID: id, Weight: p.Weights[id]}
+		if limit, ok := p.Caps[id]; ok {
+			source.Cap = &limit
+		}
+		sources = append(sources, source)
+	}
+	return store.BalanceRequest{
+		NegativeBudgetIDs: p.NegativeBudgetIDs,
+		Sources:           sources,
+		Description:       strings.TrimSpace(p.Description),
+		DryRun:            p.DryRun,
+	}
+}
+
+func (h *APIHandler) handleBalance(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req balancePayload
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := h.store.BalanceBudgets(r.Context(), userID, req.request())
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to balance budgets")
+		return
+	}
+	status := http.StatusCreated
+	if result.DryRun {
+		status = http.StatusOK
+	}
+	respondJSON(w, status, result)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"my-personal-budget/internal/store"
+)
+
+// listHistory serves GET /budgets/{id}/history. Filters: entity, action,
+// entity_id, actor_user_id, and from/to as YYYY-MM-DD days (to inclusive) or
+// RFC 3339 timestamps.
+func (h *APIHandler) listHistory(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
+	q := r.URL.Query()
+	query := store.AuditQuery{
+		Limit:  50,
+		Entity: q.Get("entity"),
+		Action: q.Get("action"),
+	}
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			query.Limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			query.Offset = parsed
+		}
+	}
+	for _, param := range []struct {
+		name string
+		dst  **int64
+	}{{"entity_id", &query.EntityID}, {"actor_user_id", &query.ActorUserID}} {
+		value := q.Get(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid "+param.name)
+			return
+		}
+		*param.dst = &parsed
+	}
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+		end  bool
+	}{{"from", &query.From, false}, {"to", &query.To, true}} {
+		value := q.Get(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseHistoryBound(value, param.end)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, param.name+" must be a YYYY-MM-DD date or RFC 3339 timestamp")
+			return
+		}
+		*param.dst = &parsed
+	}
+
+	entries, err := h.store.ListBudgetHistory(r.Context(), budgetID, userID, query)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load history")
+		return
+	}
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"data": entries,
+		"meta": map[string]any{
+			"count":      len(entries),
+			"offset":     offset,
+			"nextOffset": offset + len(entries),
+			"hasMore":    len(entries) == query.Limit,
+		},
+	})
+}
+
+// parseHistoryBound reads a from/to filter. A bare date used as the upper
+// bound covers that whole day.
+func parseHistoryBound(value string, end bool) (time.Time, error) {
+	if day, err := store.ParseDate(value); err == nil {
+		if end {
+			return day.AddDate(0, 0, 1), nil
+		}
+		return day.Time, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
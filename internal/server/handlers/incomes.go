@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+// handleIncomes serves GET/POST /incomes.
+func (h *APIHandler) handleIncomes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		incomes, err := h.store.ListIncomes(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to list incomes")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"data": incomes,
+			"meta": map[string]any{"count": len(incomes)},
+		})
+	case http.MethodPost:
+		var in store.IncomeInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		income, err := h.store.CreateIncome(r.Context(), userID, in)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "budget not found")
+			return
+		}
+		respondIncome(w, income, err, http.StatusCreated, "failed to create income")
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleIncomeByID serves GET/PUT/PATCH/DELETE /incomes/{id} and
+// GET/POST /incomes/{id}/deposits.
+func (h *APIHandler) handleIncomeByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/incomes/"), "/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "deposits") {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid income id")
+		return
+	}
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			deposits, err := h.store.ListIncomeDeposits(r.Context(), id, userID)
+			if errors.Is(err, store.ErrNotFound) {
+				respondError(w, http.StatusNotFound, "income not found")
+				return
+			}
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to list deposits")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{
+				"data": deposits,
+				"meta": map[string]any{"count": len(deposits)},
+			})
+		case http.MethodPost:
+			h.recordIncomeDeposit(w, r, id, userID)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		income, err := h.store.GetIncome(r.Context(), id, userID)
+		respondIncome(w, income, err, http.StatusOK, "failed to load income")
+	case http.MethodPut, http.MethodPatch:
+		var in store.IncomeInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		income, err := h.store.UpdateIncome(r.Context(), id, userID, in)
+		respondIncome(w, income, err, http.StatusOK, "failed to update income")
+	case http.MethodDelete:
+		if err := h.store.DeleteIncome(r.Context(), id, userID); err != nil {
+			respondIncome(w, store.Income{}, err, 0, "failed to delete income")
+			return
+		}
+		respondJSON(w, http.StatusNoContent, nil)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// recordIncomeDeposit records a paycheck: {"period": "YYYY-MM-DD", "amount": n},
+// both optional.
+func (h *APIHandler) recordIncomeDeposit(w http.ResponseWriter, r *http.Request, id int64, userID *int64) {
+	var req struct {
+		Period *store.Date  `json:"period"`
+		Amount *store.Cents `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	deposit, err := h.store.RecordIncomeDeposit(r.Context(), id, userID, req.Period, req.Amount)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "income not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "failed to record deposit")
+	default:
+		respondJSON(w, http.StatusCreated, deposit)
+	}
+}
+
+func respondIncome(w http.ResponseWriter, income store.Income, err error, status int, failure string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "income not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, failure)
+	default:
+		respondJSON(w, status, income)
+	}
+}
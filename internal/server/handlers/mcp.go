@@ -18,7 +18,8 @@ type MCPHandler struct {
 
 type MCPStore interface {
 	ListBudgets(ctx context.Context, userID *int64) ([]store.Budget, error)
-	CreateTransaction(ctx context.Context, budgetID int64, userID *int64, description string, credit bool, amount float64) (store.Transaction, error)
+	CreateTransaction(ctx context.Context, budgetID int64, userID *int64, in store.TransactionInput) (store.Transaction, error)
+	BalanceBudgets(ctx context.Context, userID *int64, req store.BalanceRequest) (store.BalanceResult, error)
 }
 
 func NewMCPHandler(store MCPStore) http.Handler {
@@ -109,11 +110,50 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, id any) {
 					},
 					"amount": map[string]any{"type": "number"},
 					"credit": map[string]any{"type": "boolean"},
+					"occurred_on": map[string]any{
+						"type":        "string",
+						"format":      "date",
+						"description": "Day the transaction happened (YYYY-MM-DD). Defaults to today.",
+					},
+					"tags": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Tag names such as \"Dining\". Unknown tags are created.",
+					},
+					"payee": map[string]any{
+						"type":        "string",
+						"description": "Merchant name. Matched against your payee aliases; defaults to matching the description.",
+					},
 				},
 				"required":             []string{"budget_id", "description", "amount", "credit"},
 				"additionalProperties": false,
 			},
 		},
+		{
+			"name":        "balance_budgets",
+			"description": "Cover negative budgets from positive ones. Use dry_run to preview the moves.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"negative_budget_ids": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+					"positive_budget_ids": map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+					"weights": map[string]any{
+						"type":                 "object",
+						"description":          "Relative weight per positive budget id (default 1).",
+						"additionalProperties": map[string]any{"type": "integer"},
+					},
+					"caps": map[string]any{
+						"type":                 "object",
+						"description":          "Maximum amount to take from a positive budget id.",
+						"additionalProperties": map[string]any{"type": "number"},
+					},
+					"description": map[string]any{"type": "string"},
+					"dry_run":     map[string]any{"type": "boolean"},
+				},
+				"required":             []string{"negative_budget_ids", "positive_budget_ids"},
+				"additionalProperties": false,
+			},
+		},
 	}
 	writeMCPResult(w, id, map[string]any{"tools": tools})
 }
@@ -133,6 +173,8 @@ func (h *MCPHandler) handleToolsCall(w http.ResponseWriter, r *http.Request, id
 		h.callListBudgets(w, r, id)
 	case "add_transaction":
 		h.callAddTransaction(w, r, id, payload.Arguments)
+	case "balance_budgets":
+		h.callBalanceBudgets(w, r, id, payload.Arguments)
 	default:
 		writeMCPError(w, id, -32601, "unknown tool")
 	}
@@ -150,10 +192,10 @@ func (h *MCPHandler) callListBudgets(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 	type budgetOut struct {
-		ID      int64   `json:"id"`
-		Name    string  `json:"name"`
-		Balance float64 `json:"balance"`
-		Payroll float64 `json:"payroll"`
+		ID      int64       `json:"id"`
+		Name    string      `json:"name"`
+		Balance store.Cents `json:"balance"`
+		Payroll store.Cents `json:"payroll"`
 	}
 	out := make([]budgetOut, 0, len(budgets))
 	for _, b := range budgets {
@@ -181,10 +223,13 @@ func (h *MCPHandler) callAddTransaction(w http.ResponseWriter, r *http.Request,
 		return
 	}
 	var req struct {
-		BudgetID    int64   `json:"budget_id"`
-		Description string  `json:"description"`
-		Amount      float64 `json:"amount"`
-		Credit      bool    `json:"credit"`
+		BudgetID    int64       `json:"budget_id"`
+		Description string      `json:"description"`
+		Amount      store.Cents `json:"amount"`
+		Credit      bool        `json:"credit"`
+		OccurredOn  *store.Date `json:"occurred_on"`
+		Tags        []string    `json:"tags"`
+		Payee       *string     `json:"payee"`
 	}
 	if err := json.Unmarshal(args, &req); err != nil {
 		writeMCPError(w, id, -32602, "invalid arguments")
@@ -195,11 +240,22 @@ func (h *MCPHandler) callAddTransaction(w http.ResponseWriter, r *http.Request,
 		writeMCPError(w, id, -32602, "budget_id, description, and amount must be provided")
 		return
 	}
-	txn, err := h.store.CreateTransaction(r.Context(), req.BudgetID, userID, req.Description, req.Credit, req.Amount)
+	txn, err := h.store.CreateTransaction(r.Context(), req.BudgetID, userID, store.TransactionInput{
+		Description: req.Description,
+		Credit:      req.Credit,
+		Amount:      req.Amount,
+		OccurredOn:  req.OccurredOn,
+		Tags:        req.Tags,
+		Payee:       req.Payee,
+	})
 	if errors.Is(err, store.ErrNotFound) {
 		writeMCPError(w, id, -32004, "budget not found")
 		return
 	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		writeMCPError(w, id, -32602, err.Error())
+		return
+	}
 	if err != nil {
 		writeMCPError(w, id, -32000, "failed to create transaction")
 		return
@@ -210,6 +266,9 @@ func (h *MCPHandler) callAddTransaction(w http.ResponseWriter, r *http.Request,
 		"description": txn.Description,
 		"credit":      txn.Credit,
 		"amount":      txn.Amount,
+		"occurred_on": txn.OccurredOn,
+		"payee":       txn.Payee,
+		"tags":        txn.Tags,
 		"created_at":  txn.CreatedAt,
 	}
 	writeMCPResult(w, id, map[string]any{
@@ -222,6 +281,44 @@ func (h *MCPHandler) callAddTransaction(w http.ResponseWriter, r *http.Request,
 	})
 }
 
+func (h *MCPHandler) callBalanceBudgets(w http.ResponseWriter, r *http.Request, id any, args json.RawMessage) {
+	userID := auth.UserIDFromContext(r.Context())
+	if userID == nil {
+		writeMCPError(w, id, -32001, "unauthorized")
+		return
+	}
+	var req balancePayload
+	if err := json.Unmarshal(args, &req); err != nil {
+		writeMCPError(w, id, -32602, "invalid arguments")
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeMCPError(w, id, -32602, msg)
+		return
+	}
+	result, err := h.store.BalanceBudgets(r.Context(), userID, req.request())
+	if errors.Is(err, store.ErrNotFound) {
+		writeMCPError(w, id, -32004, "budget not found")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		writeMCPError(w, id, -32602, err.Error())
+		return
+	}
+	if err != nil {
+		writeMCPError(w, id, -32000, "failed to balance budgets")
+		return
+	}
+	writeMCPResult(w, id, map[string]any{
+		"content": []map[string]any{
+			{
+				"type": "text",
+				"text": mustJSON(result),
+			},
+		},
+	})
+}
+
 func writeMCPResult(w http.ResponseWriter, id any, result any) {
 	writeMCPResponse(w, mcpResponse{JSONRPC: "2.0", ID: id, Result: result})
 }
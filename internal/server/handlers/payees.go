@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+type payeeRequest struct {
+	Name    string             `json:"name"`
+	Aliases []store.PayeeAlias `json:"aliases"`
+}
+
+// handlePayees serves GET /payees?q=&limit= for autocomplete and POST /payees.
+func (h *APIHandler) handlePayees(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		limit := 0
+		if l := q.Get("limit"); l != "" {
+			if parsed, err := strconv.Atoi(l); err == nil {
+				limit = parsed
+			}
+		}
+		payees, err := h.store.SearchPayees(r.Context(), userID, strings.TrimSpace(q.Get("q")), limit)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to list payees")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"data": payees,
+			"meta": map[string]any{"count": len(payees)},
+		})
+	case http.MethodPost:
+		req, ok := decodePayeeRequest(w, r)
+		if !ok {
+			return
+		}
+		payee, err := h.store.CreatePayee(r.Context(), userID, req.Name, req.Aliases)
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create payee")
+			return
+		}
+		respondJSON(w, http.StatusCreated, payee)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handlePayeeByID serves PUT/PATCH/DELETE /payees/{id} and
+// POST /payees/{id}/merge.
+func (h *APIHandler) handlePayeeByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/payees/"), "/"), "/")
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "merge") {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payee id")
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.mergePayees(w, r, id, userID)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		req, ok := decodePayeeRequest(w, r)
+		if !ok {
+			return
+		}
+		payee, err := h.store.UpdatePayee(r.Context(), id, userID, req.Name, req.Aliases)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "payee not found")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to update payee")
+			return
+		}
+		respondJSON(w, http.StatusOK, payee)
+	case http.MethodDelete:
+		err := h.store.DeletePayee(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "payee not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to delete payee")
+			return
+		}
+		respondJSON(w, http.StatusNoContent, nil)
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// mergePayees folds {"source_payee_id": n} into the payee in the path.
+func (h *APIHandler) mergePayees(w http.ResponseWriter, r *http.Request, targetID int64, userID *int64) {
+	var req struct {
+		SourcePayeeID int64 `json:"source_payee_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if req.SourcePayeeID <= 0 {
+		respondError(w, http.StatusBadRequest, "source_payee_id is required")
+		return
+	}
+	payee, err := h.store.MergePayees(r.Context(), targetID, req.SourcePayeeID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "payee not found")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to merge payees")
+		return
+	}
+	respondJSON(w, http.StatusOK, payee)
+}
+
+func decodePayeeRequest(w http.ResponseWriter, r *http.Request) (payeeRequest, bool) {
+	var req payeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return req, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return req, false
+	}
+	return req, true
+}
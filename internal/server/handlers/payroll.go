@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-personal-budget/internal/store"
+)
+
+// handlePayrollPreview serves GET /payroll/preview?at=YYYY-MM-DD: the credits
+// and auto-balance moves a payroll run on that day would post to the caller's
+// budgets, without writing them. Each budget is evaluated on that day in its
+// own payroll time zone; without at, as of now.
+func (h *APIHandler) handlePayrollPreview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var day *store.Date
+	var at any = time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		parsed, err := store.ParseDate(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "at must be YYYY-MM-DD")
+			return
+		}
+		day, at = &parsed, parsed
+	}
+	credits, err := h.store.PreviewPayroll(r.Context(), userID, day)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to preview payroll")
+		return
+	}
+	var total store.Cents
+	for _, c := range credits {
+		total += c.Amount
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"at":   at,
+		"data": credits,
+		"meta": map[string]any{"count": len(credits), "total": total},
+	})
+}
+
+// handlePayrollRuns serves GET /payroll/runs?limit=&offset=&from=&to=; from
+// and to bound when runs started, like the history filters.
+func (h *APIHandler) handlePayrollRuns(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	h.listPayrollRuns(w, r, userID, nil)
+}
+
+// listPayrollRuns lists payroll runs, limited to one budget's runs and
+// results when budgetID is set.
+func (h *APIHandler) listPayrollRuns(w http.ResponseWriter, r *http.Request, userID, budgetID *int64) {
+	q := r.URL.Query()
+	query := store.PayrollRunQuery{Limit: 50, BudgetID: budgetID}
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			query.Limit = parsed
+		}
+	}
+	if o := q.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			query.Offset = parsed
+		}
+	}
+	for _, param := range []struct {
+		name string
+		dst  **time.Time
+		end  bool
+	}{{"from", &query.From, false}, {"to", &query.To, true}} {
+		value := q.Get(param.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseHistoryBound(value, param.end)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, param.name+" must be a YYYY-MM-DD date or RFC 3339 timestamp")
+			return
+		}
+		*param.dst = &parsed
+	}
+
+	runs, err := h.store.ListPayrollRuns(r.Context(), userID, query)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list payroll runs")
+		return
+	}
+	offset := query.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"data": runs,
+		"meta": map[string]any{
+			"count":      len(runs),
+			"offset":     offset,
+			"nextOffset": offset + len(runs),
+			"hasMore":    len(runs) == query.Limit,
+		},
+	})
+}
+
+// handlePayrollRunByID serves GET /payroll/runs/{id}.
+func (h *APIHandler) handlePayrollRunByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	id, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(r.URL.Path, "/payroll/runs/"), "/"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid payroll run id")
+		return
+	}
+	run, err := h.store.GetPayrollRun(r.Context(), id, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "payroll run not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to load payroll run")
+		return
+	}
+	respondJSON(w, http.StatusOK, run)
+}
+
+// handlePayrollScheduler serves GET /payroll/scheduler: which API instance
+// holds the payroll scheduler lease, and whether it is the one answering.
+func (h *APIHandler) handlePayrollScheduler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireUser(w, r); !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var lease *store.Lease
+	current, err := h.store.GetLease(r.Context(), store.PayrollLease)
+	switch {
+	case err == nil:
+		lease = &current
+	case !errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusInternalServerError, "failed to load scheduler lease")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"instance_id": h.cfg.InstanceID,
+		"lease":       lease,
+		"leader":      lease != nil && lease.Active && lease.Holder == h.cfg.InstanceID,
+	})
+}
+
+// handlePayrollOverrides serves /budgets/{id}/payroll/overrides and
+// /budgets/{id}/payroll/overrides/{overrideID}.
+func (h *APIHandler) handlePayrollOverrides(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			overrides, err := h.store.ListPayrollOverrides(r.Context(), budgetID, userID)
+			if errors.Is(err, store.ErrNotFound) {
+				respondError(w, http.StatusNotFound, "budget not found")
+				return
+			}
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "failed to list payroll overrides")
+				return
+			}
+			respondJSON(w, http.StatusOK, map[string]any{
+				"data": overrides,
+				"meta": map[string]any{"count": len(overrides)},
+			})
+		case http.MethodPost:
+			var in store.PayrollOverride
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				respondError(w, http.StatusBadRequest, "invalid JSON payload")
+				return
+			}
+			override, err := h.store.CreatePayrollOverride(r.Context(), budgetID, userID, in)
+			respondPayrollOverride(w, override, err, http.StatusCreated, "failed to create payroll override")
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil || len(rest) > 1 {
+		respondError(w, http.StatusBadRequest, "invalid payroll override id")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	if err := h.store.DeletePayrollOverride(r.Context(), budgetID, id, userID); err != nil {
+		respondPayrollOverride(w, store.PayrollOverride{}, err, 0, "failed to delete payroll override")
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+func respondPayrollOverride(w http.ResponseWriter, override store.PayrollOverride, err error, status int, failure string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "payroll override not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, failure)
+	default:
+		respondJSON(w, status, override)
+	}
+}
+
+// handlePayrollAmounts serves /budgets/{id}/payroll/amounts: the budget's
+// payroll history, and dated changes to it.
+func (h *APIHandler) handlePayrollAmounts(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
+	switch r.Method {
+	case http.MethodGet:
+		amounts, err := h.store.ListPayrollAmounts(r.Context(), budgetID, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "budget not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to list payroll amounts")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"data": amounts,
+			"meta": map[string]any{"count": len(amounts)},
+		})
+	case http.MethodPost:
+		var in store.PayrollAmountInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		amount, err := h.store.SetPayrollAmount(r.Context(), budgetID, userID, in)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			respondError(w, http.StatusNotFound, "budget not found")
+		case errors.Is(err, store.ErrInvalidInput):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case err != nil:
+			respondError(w, http.StatusInternalServerError, "failed to set payroll amount")
+		default:
+			respondJSON(w, http.StatusCreated, amount)
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handlePayrollHolidays serves /payroll/holidays and
+// /payroll/holidays/{YYYY-MM-DD}. Anyone may read the holiday list; only
+// admins change it, since it applies to every budget.
+func (h *APIHandler) handlePayrollHolidays(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/payroll/holidays"), "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		holidays, err := h.store.ListHolidays(r.Context())
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to list holidays")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"data": holidays,
+			"meta": map[string]any{"count": len(holidays)},
+		})
+	case rest == "" && r.Method == http.MethodPost:
+		if !h.requireAdmin(w, r, userID, "only admins can change holidays") {
+			return
+		}
+		var in store.Holiday
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		holiday, err := h.store.SetHoliday(r.Context(), in)
+		switch {
+		case errors.Is(err, store.ErrInvalidInput):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case err != nil:
+			respondError(w, http.StatusInternalServerError, "failed to save holiday")
+		default:
+			respondJSON(w, http.StatusCreated, holiday)
+		}
+	case rest == "":
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	case r.Method == http.MethodDelete:
+		day, err := store.ParseDate(rest)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "holiday must be YYYY-MM-DD")
+			return
+		}
+		if !h.requireAdmin(w, r, userID, "only admins can change holidays") {
+			return
+		}
+		err = h.store.DeleteHoliday(r.Context(), day)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "holiday not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to delete holiday")
+			return
+		}
+		respondJSON(w, http.StatusNoContent, nil)
+	default:
+		methodNotAllowed(w, http.MethodDelete)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"my-personal-budget/internal/store"
+)
+
+// handleReconciliations serves /budgets/{id}/reconciliations and its
+// subroutes; rest holds the path segments after "reconciliations".
+func (h *APIHandler) handleReconciliations(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			h.listReconciliations(w, r, budgetID, userID)
+		case http.MethodPost:
+			h.startReconciliation(w, r, budgetID, userID)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(rest[0], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid reconciliation id")
+		return
+	}
+	switch {
+	case len(rest) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			rec, err := h.store.GetReconciliation(r.Context(), budgetID, id, userID)
+			respondReconciliation(w, rec, err, http.StatusOK, "failed to load reconciliation")
+		case http.MethodDelete:
+			if err := h.store.CancelReconciliation(r.Context(), budgetID, id, userID); err != nil {
+				respondReconciliation(w, store.Reconciliation{}, err, 0, "failed to cancel reconciliation")
+				return
+			}
+			respondJSON(w, http.StatusNoContent, nil)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case len(rest) == 2 && rest[1] == "clear":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		h.clearTransactions(w, r, budgetID, id, userID)
+	case len(rest) == 2 && rest[1] == "finish":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var req struct {
+			Adjust bool `json:"adjust"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			respondError(w, http.StatusBadRequest, "invalid JSON payload")
+			return
+		}
+		rec, err := h.store.FinishReconciliation(r.Context(), budgetID, id, userID, req.Adjust)
+		respondReconciliation(w, rec, err, http.StatusOK, "failed to finish reconciliation")
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *APIHandler) listReconciliations(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
+	recs, err := h.store.ListReconciliations(r.Context(), budgetID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list reconciliations")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{
+		"data": recs,
+		"meta": map[string]any{"count": len(recs)},
+	})
+}
+
+func (h *APIHandler) startReconciliation(w http.ResponseWriter, r *http.Request, budgetID int64, userID *int64) {
+	var req struct {
+		StatementDate    *store.Date  `json:"statement_date"`
+		StatementBalance *store.Cents `json:"statement_balance"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if req.StatementDate == nil || req.StatementBalance == nil {
+		respondError(w, http.StatusBadRequest, "statement_date and statement_balance are required")
+		return
+	}
+	rec, err := h.store.StartReconciliation(r.Context(), budgetID, userID, *req.StatementDate, *req.StatementBalance)
+	respondReconciliation(w, rec, err, http.StatusCreated, "failed to start reconciliation")
+}
+
+func (h *APIHandler) clearTransactions(w http.ResponseWriter, r *http.Request, budgetID, id int64, userID *int64) {
+	var req struct {
+		TransactionIDs []int64 `json:"transaction_ids"`
+		Cleared        *bool   `json:"cleared"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
+	if len(req.TransactionIDs) == 0 {
+		respondError(w, http.StatusBadRequest, "transaction_ids is required")
+		return
+	}
+	cleared := req.Cleared == nil || *req.Cleared
+	rec, err := h.store.ClearTransactions(r.Context(), budgetID, id, userID, req.TransactionIDs, cleared)
+	respondReconciliation(w, rec, err, http.StatusOK, "failed to update cleared transactions")
+}
+
+func respondReconciliation(w http.ResponseWriter, rec store.Reconciliation, err error, status int, failure string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(w, http.StatusNotFound, "reconciliation not found")
+	case errors.Is(err, store.ErrInvalidInput):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, failure)
+	default:
+		respondJSON(w, status, rec)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+type splitRequest struct {
+	Description       string            `json:"description"`
+	Total             store.Cents       `json:"total"`
+	OccurredOn        *store.Date       `json:"occurred_on"`
+	Lines             []store.SplitLine `json:"lines"`
+	RemainderBudgetID *int64            `json:"remainder_budget_id"`
+}
+
+func (h *APIHandler) handleSplits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	req, ok := decodeSplitRequest(w, r)
+	if !ok {
+		return
+	}
+	split, err := h.store.CreateSplit(r.Context(), userID, req.Description, req.Total, req.OccurredOn, req.Lines, req.RemainderBudgetID)
+	if errors.Is(err, store.ErrNotFound) {
+		respondError(w, http.StatusNotFound, "budget not found")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidInput) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to create split")
+		return
+	}
+	respondJSON(w, http.StatusCreated, split)
+}
+
+func (h *APIHandler) handleSplitByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/splits/")
+	if path == "" {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid split id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		split, err := h.store.GetSplit(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "split not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to load split")
+			return
+		}
+		respondJSON(w, http.StatusOK, split)
+	case http.MethodPut, http.MethodPatch:
+		req, ok := decodeSplitRequest(w, r)
+		if !ok {
+			return
+		}
+		split, err := h.store.UpdateSplit(r.Context(), id, userID, req.Description, req.Total, req.OccurredOn, req.Lines, req.RemainderBudgetID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "split not found")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to update split")
+			return
+		}
+		respondJSON(w, http.StatusOK, split)
+	case http.MethodDelete:
+		err := h.store.DeleteSplit(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "split not found")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to delete split")
+			return
+		}
+		respondJSON(w, http.StatusNoContent, nil)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func decodeSplitRequest(w http.ResponseWriter, r *http.Request) (splitRequest, bool) {
+	var req splitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return req, false
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Description == "" {
+		respondError(w, http.StatusBadRequest, "description is required")
+		return req, false
+	}
+	if req.Total <= 0 {
+		respondError(w, http.StatusBadRequest, "total must be greater than 0")
+		return req, false
+	}
+	if len(req.Lines) == 0 {
+		respondError(w, http.StatusBadRequest, "at least one line is required")
+		return req, false
+	}
+	for i := range req.Lines {
+		req.Lines[i].Description = strings.TrimSpace(req.Lines[i].Description)
+		if req.Lines[i].BudgetID <= 0 {
+			respondError(w, http.StatusBadRequest, "every line needs a budget_id")
+			return req, false
+		}
+		if req.Lines[i].Amount <= 0 {
+			respondError(w, http.StatusBadRequest, "line amounts must be greater than 0")
+			return req, false
+		}
+	}
+	return req, true
+}
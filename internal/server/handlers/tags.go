@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+func (h *APIHandler) handleTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		tags, err := h.store.ListTags(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to list tags")
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]any{
+			"data": tags,
+			"meta": map[string]any{"count": len(tags)},
+		})
+	case http.MethodPost:
+		name, ok := decodeTagName(w, r)
+		if !ok {
+			return
+		}
+		tag, err := h.store.CreateTag(r.Context(), userID, name)
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to create tag")
+			return
+		}
+		respondJSON(w, http.StatusCreated, tag)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (h *APIHandler) handleTagByID(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tags/"), "/")
+	if path == "" {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+	id, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid tag id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch:
+		name, ok := decodeTagName(w, r)
+		if !ok {
+			return
+		}
+		tag, err := h.store.RenameTag(r.Context(), id, userID, name)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "tag not found")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to update tag")
+			return
+		}
+		respondJSON(w, http.StatusOK, tag)
+	case http.MethodDelete:
+		err := h.store.DeleteTag(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "tag not found")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to delete tag")
+			return
+		}
+		respondJSON(w, http.StatusNoContent, nil)
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+func decodeTagName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid JSON payload")
+		return "", false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return "", false
+	}
+	return req.Name, true
+}
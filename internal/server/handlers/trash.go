@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-personal-budget/internal/store"
+)
+
+func (h *APIHandler) handleTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	trash, err := h.store.ListTrash(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to list trash")
+		return
+	}
+	respondJSON(w, http.StatusOK, trash)
+}
+
+// handleTrashRestore serves POST /trash/budgets/{id}/restore and
+// POST /trash/transactions/{id}/restore.
+func (h *APIHandler) handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.requireUser(w, r)
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/trash/"), "/"), "/")
+	if len(parts) != 3 || parts[2] != "restore" {
+		respondError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	switch parts[0] {
+	case "budgets":
+		budget, err := h.store.RestoreBudget(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "budget not found in trash")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to restore budget")
+			return
+		}
+		respondJSON(w, http.StatusOK, budget)
+	case "transactions":
+		txn, err := h.store.RestoreTransaction(r.Context(), id, userID)
+		if errors.Is(err, store.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "transaction not found in trash")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidInput) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to restore transaction")
+			return
+		}
+		respondJSON(w, http.StatusOK, txn)
+	default:
+		respondError(w, http.StatusNotFound, "not found")
+	}
+}
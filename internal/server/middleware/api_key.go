@@ -33,6 +33,7 @@ func APIKeyAuth(store APIKeyStore, next http.Handler) http.Handler {
 			return
 		}
 		ctx := auth.WithUserID(r.Context(), key.UserID)
+		ctx = auth.WithAPIKeyID(ctx, key.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
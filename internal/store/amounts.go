@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// When a payroll amount change takes effect, besides a YYYY-MM-DD date.
+const (
+	PayrollEffectiveNow        = "now"
+	PayrollEffectiveNextPeriod = "next_period"
+)
+
+// PayrollAmount is one entry in a budget's payroll history: Amount is
+// credited on every pay date from EffectiveOn until the next entry takes
+// over. A nil EffectiveOn marks the amount the budget started with.
+type PayrollAmount struct {
+	ID          int64     `json:"id"`
+	BudgetID    int64     `json:"budget_id"`
+	Amount      Cents     `json:"amount"`
+	EffectiveOn *Date     `json:"effective_on,omitempty"`
+	UserID      *int64    `json:"user_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PayrollAmountInput changes a budget's payroll amount. Effective is "now"
+// (the default), "next_period" for the first pay date after today, or a date
+// that isn't in the past.
+type PayrollAmountInput struct {
+	Amount    Cents  `json:"amount"`
+	Effective string `json:"effective"`
+}
+
+// effectiveOn resolves when the change takes effect. now is in the
+// schedule's time zone.
+func (in PayrollAmountInput) effectiveOn(sched PayrollSchedule, now time.Time) (Date, error) {
+	today := DateOf(now)
+	switch effective := strings.TrimSpace(in.Effective); effective {
+	case "", PayrollEffectiveNow:
+		return today, nil
+	case PayrollEffectiveNextPeriod:
+		return DateOf(sched.Next(now)), nil
+	default:
+		day, err := ParseDate(effective)
+		if err != nil {
+			return Date{}, invalidf("effective must be %q, %q or a YYYY-MM-DD date", PayrollEffectiveNow, PayrollEffectiveNextPeriod)
+		}
+		if day.Before(today.Time) {
+			return Date{}, invalidf("effective must not be before %s", today.String())
+		}
+		return day, nil
+	}
+}
+
+const payrollAmountColumns = `id, budget_id, amount_cents, effective_on, user_id, created_at`
+
+func scanPayrollAmount(row rowScanner) (PayrollAmount, error) {
+	var a PayrollAmount
+	err := row.Scan(&a.ID, &a.BudgetID, &a.Amount, &a.EffectiveOn, &a.UserID, &a.CreatedAt)
+	return a, err
+}
+
+// ListPayrollAmounts returns a budget's payroll history, latest effective
+// date first.
+func (s *Store) ListPayrollAmounts(ctx context.Context, budgetID int64, userID *int64) ([]PayrollAmount, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+payrollAmountColumns+`
+		FROM payroll_amounts
+		WHERE budget_id = $1
+		ORDER BY effective_on DESC NULLS LAST, id DESC
+	`, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	amounts := []PayrollAmount{}
+	for rows.Next() {
+		a, err := scanPayrollAmount(rows)
+		if err != nil {
+			return nil, err
+		}
+		amounts = append(amounts, a)
+	}
+	return amounts, rows.Err()
+}
+
+// SetPayrollAmount records a payroll amount change for a budget. A change
+// effective today also becomes the budget's payroll right away; later ones
+// take over on the first pay date they cover. A second change on the same
+// date replaces the first.
+func (s *Store) SetPayrollAmount(ctx context.Context, budgetID int64, userID *int64, in PayrollAmountInput) (PayrollAmount, error) {
+	if in.Amount < 0 {
+		return PayrollAmount{}, invalidf("amount must be >= 0")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PayrollAmount{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return PayrollAmount{}, err
+	}
+	before, err := lockBudgetRowTx(ctx, tx, budgetID)
+	if err != nil {
+		return PayrollAmount{}, err
+	}
+	now := time.Now().In(before.PayrollSchedule.Location())
+	effective, err := in.effectiveOn(before.PayrollSchedule, now)
+	if err != nil {
+		return PayrollAmount{}, err
+	}
+	a, err := setPayrollAmountTx(ctx, tx, budgetID, userID, in.Amount, effective)
+	if err != nil {
+		return PayrollAmount{}, err
+	}
+	if effective.Equal(DateOf(now).Time) && in.Amount != before.Payroll {
+		after, err := scanBudgetRow(tx.QueryRowContext(ctx, `
+			UPDATE budgets
+			SET payroll_cents = $2, updated_at = NOW()
+			WHERE id = $1
+			RETURNING `+budgetColumns+`;
+		`, budgetID, in.Amount))
+		if err != nil {
+			return PayrollAmount{}, err
+		}
+		if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditBudget, entityID: budgetID, action: AuditUpdate, before: before, after: after}); err != nil {
+			return PayrollAmount{}, err
+		}
+	}
+	return a, tx.Commit()
+}
+
+// setPayrollAmountTx records that amount is a budget's payroll from
+// effective on, replacing any change already dated then.
+func setPayrollAmountTx(ctx context.Context, tx *sql.Tx, budgetID int64, userID *int64, amount Cents, effective Date) (PayrollAmount, error) {
+	a, err := scanPayrollAmount(tx.QueryRowContext(ctx, `
+		INSERT INTO payroll_amounts (budget_id, amount_cents, effective_on, user_id, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (budget_id, effective_on) DO UPDATE
+		SET amount_cents = EXCLUDED.amount_cents, user_id = EXCLUDED.user_id, created_at = NOW()
+		RETURNING `+payrollAmountColumns+`;
+	`, budgetID, amount, effective, userID))
+	if err != nil {
+		return PayrollAmount{}, fmt.Errorf("insert payroll amount: %w", err)
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditPayrollAmount, entityID: a.ID, action: AuditCreate, after: a}); err != nil {
+		return PayrollAmount{}, err
+	}
+	return a, nil
+}
+
+// payrollAmountTx returns the payroll amount in effect on a budget's pay
+// date. Budgets without a history use their current payroll.
+func payrollAmountTx(ctx context.Context, q queryer, pb payrollBudget, day Date) (Cents, error) {
+	var amount Cents
+	err := q.QueryRowContext(ctx, `
+		SELECT amount_cents
+		FROM payroll_amounts
+		WHERE budget_id = $1 AND (effective_on IS NULL OR effective_on <= $2)
+		ORDER BY effective_on DESC NULLS LAST, id DESC
+		LIMIT 1
+	`, pb.id, day).Scan(&amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pb.payroll, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("select payroll amount: %w", err)
+	}
+	return amount, nil
+}
+
+// syncPayrollAmountTx brings a budget's payroll up to the amount in effect
+// on today, once a dated change has taken over.
+func syncPayrollAmountTx(ctx context.Context, tx *sql.Tx, pb payrollBudget, today Date) error {
+	amount, err := payrollAmountTx(ctx, tx, pb, today)
+	if err != nil || amount == pb.payroll {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE budgets SET payroll_cents = $2, updated_at = NOW() WHERE id = $1
+	`, pb.id, amount); err != nil {
+		return fmt.Errorf("update payroll_cents: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPayrollAmountEffectiveOn(t *testing.T) {
+	sched := PayrollSchedule{Frequency: PaySemimonthly, Days: []int{1, 15}}
+	now := time.Date(2026, time.March, 10, 18, 30, 0, 0, time.UTC)
+	cases := []struct {
+		effective string
+		want      string
+	}{
+		{"", "2026-03-10"},
+		{PayrollEffectiveNow, "2026-03-10"},
+		{PayrollEffectiveNextPeriod, "2026-03-15"},
+		{"2026-03-10", "2026-03-10"},
+		{" 2026-04-20 ", "2026-04-20"},
+	}
+	for _, tc := range cases {
+		got, err := PayrollAmountInput{Effective: tc.effective}.effectiveOn(sched, now)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.effective, err)
+		}
+		if got.String() != tc.want {
+			t.Fatalf("%q: expected %s, got %s", tc.effective, tc.want, got)
+		}
+	}
+	for _, effective := range []string{"2026-03-09", "later", "03/20/2026"} {
+		if _, err := (PayrollAmountInput{Effective: effective}).effectiveOn(sched, now); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%q: expected invalid input, got %v", effective, err)
+		}
+	}
+}
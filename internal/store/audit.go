@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"my-personal-budget/internal/auth"
+)
+
+// Audit entities and actions recorded in audit_log.
+const (
+	AuditBudget          = "budget"
+	AuditTransaction     = "transaction"
+	AuditShare           = "share"
+	AuditAutoBalance     = "auto_balance"
+	AuditReconciliation  = "reconciliation"
+	AuditPayrollOverride = "payroll_override"
+	AuditPayrollAmount   = "payroll_amount"
+	AuditIncome          = "income"
+
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditEntry is one row of a budget's history. Before and After hold the
+// JSON form of the entity on either side of the change; a nil actor means
+// the change came from the server itself (payroll, purge).
+type AuditEntry struct {
+	ID            int64           `json:"id"`
+	BudgetID      int64           `json:"budget_id"`
+	Entity        string          `json:"entity"`
+	EntityID      int64           `json:"entity_id"`
+	Action        string          `json:"action"`
+	ActorUserID   *int64          `json:"actor_user_id,omitempty"`
+	ActorAPIKeyID *int64          `json:"actor_api_key_id,omitempty"`
+	Before        json.RawMessage `json:"before,omitempty"`
+	After         json.RawMessage `json:"after,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// AuditQuery filters and pages a budget's history. Empty fields match
+// everything; From and To bound created_at.
+type AuditQuery struct {
+	Limit       int
+	Offset      int
+	Entity      string
+	Action      string
+	EntityID    *int64
+	ActorUserID *int64
+	From        *time.Time
+	To          *time.Time
+}
+
+// auditEvent describes one change for recordAuditTx. Before and After are
+// marshalled as-is; leave them nil when there is no such side.
+type auditEvent struct {
+	budgetID int64
+	entity   string
+	entityID int64
+	action   string
+	before   any
+	after    any
+}
+
+// recordAuditTx appends an event to audit_log in the caller's transaction so
+// the history commits or rolls back with the change itself. The actor is the
+// acting user, falling back to the request's user, plus the API key when the
+// request used one.
+func recordAuditTx(ctx context.Context, q queryer, userID *int64, ev auditEvent) error {
+	if userID == nil {
+		userID = auth.UserIDFromContext(ctx)
+	}
+	before, err := auditJSON(ev.before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(ev.after)
+	if err != nil {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, `
+		INSERT INTO audit_log (budget_id, entity, entity_id, action, actor_user_id, actor_api_key_id, before, after, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::JSONB, $8::JSONB, NOW())
+	`, ev.budgetID, ev.entity, ev.entityID, ev.action, userID, auth.APIKeyIDFromContext(ctx), before, after); err != nil {
+		return fmt.Errorf("record audit: %w", err)
+	}
+	return nil
+}
+
+// transactionAudit builds the event for a change to one transaction; pass nil
+// for the side that doesn't exist, such as before a create.
+func transactionAudit(action string, before, after *Transaction) auditEvent {
+	ev := auditEvent{entity: AuditTransaction, action: action}
+	if before != nil {
+		ev.budgetID, ev.entityID, ev.before = before.BudgetID, before.ID, *before
+	}
+	if after != nil {
+		ev.budgetID, ev.entityID, ev.after = after.BudgetID, after.ID, *after
+	}
+	return ev
+}
+
+// auditIncomeTx records ev in the history of every budget the plans pay,
+// since an income belongs to no single budget.
+func auditIncomeTx(ctx context.Context, q queryer, userID *int64, ev auditEvent, plans ...*Income) error {
+	seen := make(map[int64]struct{})
+	record := func(budgetID int64) error {
+		if _, ok := seen[budgetID]; ok {
+			return nil
+		}
+		seen[budgetID] = struct{}{}
+		ev.budgetID = budgetID
+		return recordAuditTx(ctx, q, userID, ev)
+	}
+	for _, inc := range plans {
+		for _, a := range inc.Allocations {
+			if err := record(a.BudgetID); err != nil {
+				return err
+			}
+		}
+		if inc.RemainderBudgetID != nil {
+			if err := record(*inc.RemainderBudgetID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// auditTransactionPairsTx records one event per row of after, matching each
+// to its previous state in before by ID.
+func auditTransactionPairsTx(ctx context.Context, q queryer, userID *int64, action string, before, after []Transaction) error {
+	previous := make(map[int64]Transaction, len(before))
+	for _, t := range before {
+		previous[t.ID] = t
+	}
+	for i := range after {
+		var prior *Transaction
+		if t, ok := previous[after[i].ID]; ok {
+			prior = &t
+		}
+		if err := recordAuditTx(ctx, q, userID, transactionAudit(action, prior, &after[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func auditJSON(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal audit: %w", err)
+	}
+	out := string(raw)
+	return &out, nil
+}
+
+// ListBudgetHistory returns a budget's audit entries, newest first.
+func (s *Store) ListBudgetHistory(ctx context.Context, budgetID int64, userID *int64, query AuditQuery) ([]AuditEntry, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return nil, err
+	}
+	limit, offset := query.Limit, query.Offset
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	args := []any{budgetID}
+	where := "budget_id = $1"
+	add := func(clause string, value any) {
+		args = append(args, value)
+		where += fmt.Sprintf(" AND "+clause, len(args))
+	}
+	if query.Entity != "" {
+		add("entity = $%d", query.Entity)
+	}
+	if query.Action != "" {
+		add("action = $%d", query.Action)
+	}
+	if query.EntityID != nil {
+		add("entity_id = $%d", *query.EntityID)
+	}
+	if query.ActorUserID != nil {
+		add("actor_user_id = $%d", *query.ActorUserID)
+	}
+	if query.From != nil {
+		add("created_at >= $%d", *query.From)
+	}
+	if query.To != nil {
+		add("created_at < $%d", *query.To)
+	}
+	args = append(args, limit, offset)
+
+	q := fmt.Sprintf(`
+		SELECT id, budget_id, entity, entity_id, action, actor_user_id, actor_api_key_id, before, after, created_at
+		FROM audit_log
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d;
+	`, where, len(args)-1, len(args))
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.BudgetID, &e.Entity, &e.EntityID, &e.Action, &e.ActorUserID, &e.ActorAPIKeyID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
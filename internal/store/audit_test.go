@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestTransactionAuditPicksBudgetFromEitherSide(t *testing.T) {
+	created := transactionAudit(AuditCreate, nil, &Transaction{ID: 4, BudgetID: 2})
+	if created.budgetID != 2 || created.entityID != 4 || created.before != nil || created.after == nil {
+		t.Fatalf("unexpected create event: %+v", created)
+	}
+
+	removed := transactionAudit(AuditDelete, &Transaction{ID: 5, BudgetID: 3}, nil)
+	if removed.budgetID != 3 || removed.entityID != 5 || removed.before == nil || removed.after != nil {
+		t.Fatalf("unexpected delete event: %+v", removed)
+	}
+}
+
+func TestAuditJSONLeavesMissingSidesNull(t *testing.T) {
+	out, err := auditJSON(nil)
+	if err != nil || out != nil {
+		t.Fatalf("expected nil, got %v (%v)", out, err)
+	}
+	out, err = auditJSON(shareAudit{UserID: 1, Email: "a@example.com"})
+	if err != nil || out == nil || *out != `{"user_id":1,"email":"a@example.com"}` {
+		t.Fatalf("unexpected json: %v (%v)", out, err)
+	}
+}
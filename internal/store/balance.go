@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// BalanceSource is a positive budget that funds a balance run. Weight
+// defaults to 1; Cap, when set, limits how much the source gives.
+type BalanceSource struct {
+	BudgetID int64  `json:"budget_id"`
+	Weight   int    `json:"weight"`
+	Cap      *Cents `json:"cap,omitempty"`
+}
+
+type BalanceRequest struct {
+	NegativeBudgetIDs []int64
+	Sources           []BalanceSource
+	Description       string
+	DryRun            bool
+}
+
+// BalanceMove is one planned (or posted) debit or credit of a balance run.
+type BalanceMove struct {
+	BudgetID      int64        `json:"budget_id"`
+	Credit        bool         `json:"credit"`
+	Amount        Cents        `json:"amount"`
+	BalanceBefore Cents        `json:"balance_before"`
+	BalanceAfter  Cents        `json:"balance_after"`
+	Transaction   *Transaction `json:"transaction,omitempty"`
+}
+
+type BalanceResult struct {
+	DryRun      bool          `json:"dry_run"`
+	Description string        `json:"description"`
+	Deficit     Cents         `json:"deficit"`
+	Funded      Cents         `json:"funded"`
+	Unfunded    Cents         `json:"unfunded"`
+	Moves       []BalanceMove `json:"moves"`
+}
+
+// BalanceBudgets brings the given negative budgets back to zero by debiting
+// the sources, splitting the deficit by weight with the same cent rounding as
+// auto-balance. Everything happens in one database transaction; with DryRun
+// the plan is returned without writing it.
+func (s *Store) BalanceBudgets(ctx context.Context, userID *int64, req BalanceRequest) (BalanceResult, error) {
+	if len(req.NegativeBudgetIDs) == 0 || len(req.Sources) == 0 {
+		return BalanceResult{}, invalidf("select at least one negative and one positive budget")
+	}
+	ids := make([]int64, 0, len(req.NegativeBudgetIDs)+len(req.Sources))
+	seen := make(map[int64]struct{}, cap(ids))
+	for _, id := range req.NegativeBudgetIDs {
+		if _, ok := seen[id]; ok {
+			return BalanceResult{}, invalidf("budget %d selected twice", id)
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	for _, source := range req.Sources {
+		if _, ok := seen[source.BudgetID]; ok {
+			return BalanceResult{}, invalidf("budget %d selected twice", source.BudgetID)
+		}
+		if source.Weight < 0 {
+			return BalanceResult{}, invalidf("weights must be >= 0")
+		}
+		if source.Cap != nil && *source.Cap < 0 {
+			return BalanceResult{}, invalidf("caps must be >= 0")
+		}
+		seen[source.BudgetID] = struct{}{}
+		ids = append(ids, source.BudgetID)
+	}
+	description := req.Description
+	if description == "" {
+		description = fmt.Sprintf("Balance wizard %s", time.Now().Format("2006-01-02"))
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return BalanceResult{}, err
+	}
+	defer tx.Rollback()
+
+	for _, id := range ids {
+		if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
+			return BalanceResult{}, err
+		}
+	}
+	balances, err := lockBudgetBalancesTx(ctx, tx, ids)
+	if err != nil {
+		return BalanceResult{}, err
+	}
+
+	result := BalanceResult{DryRun: req.DryRun, Description: description}
+
+	var negatives []AutoBalanceSource
+	var deficits []int64
+	for _, id := range req.NegativeBudgetIDs {
+		if balances[id] >= 0 {
+			continue
+		}
+		deficit := -int64(balances[id])
+		negatives = append(negatives, AutoBalanceSource{SourceBudgetID: id, Weight: weightFromCents(deficit)})
+		deficits = append(deficits, deficit)
+		result.Deficit += Cents(deficit)
+	}
+	if result.Deficit == 0 {
+		return BalanceResult{}, invalidf("nothing to balance")
+	}
+
+	sources := make([]AutoBalanceSource, len(req.Sources))
+	caps := make([]int64, len(req.Sources))
+	var capacity int64
+	for i, source := range req.Sources {
+		weight := source.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		sources[i] = AutoBalanceSource{SourceBudgetID: source.BudgetID, Weight: weight}
+		caps[i] = math.MaxInt64
+		if source.Cap != nil {
+			caps[i] = int64(*source.Cap)
+		}
+		capacity = addCapped(capacity, caps[i])
+	}
+
+	funded := int64(result.Deficit)
+	if capacity < funded {
+		funded = capacity
+	}
+	debits := allocateCappedCents(funded, sources, caps)
+	credits := allocateCappedCents(funded, negatives, deficits)
+	result.Funded = Cents(funded)
+	result.Unfunded = result.Deficit - result.Funded
+
+	for i, source := range sources {
+		if debits[i] > 0 {
+			before := balances[source.SourceBudgetID]
+			result.Moves = append(result.Moves, BalanceMove{
+				BudgetID:      source.SourceBudgetID,
+				Amount:        Cents(debits[i]),
+				BalanceBefore: before,
+				BalanceAfter:  before - Cents(debits[i]),
+			})
+		}
+	}
+	for i, negative := range negatives {
+		if credits[i] > 0 {
+			before := balances[negative.SourceBudgetID]
+			result.Moves = append(result.Moves, BalanceMove{
+				BudgetID:      negative.SourceBudgetID,
+				Credit:        true,
+				Amount:        Cents(credits[i]),
+				BalanceBefore: before,
+				BalanceAfter:  before + Cents(credits[i]),
+			})
+		}
+	}
+
+	if req.DryRun {
+		return result, nil
+	}
+
+	q := `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING ` + transactionColumns + `;
+	`
+	for i := range result.Moves {
+		move := &result.Moves[i]
+		t, err := scanTransaction(tx.QueryRowContext(ctx, q, move.BudgetID, userID, description, move.Credit, move.Amount))
+		if err != nil {
+			return BalanceResult{}, fmt.Errorf("insert balance move: %w", err)
+		}
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &t)); err != nil {
+			return BalanceResult{}, err
+		}
+		move.Transaction = &t
+	}
+	if err := tx.Commit(); err != nil {
+		return BalanceResult{}, err
+	}
+	return result, nil
+}
+
+// lockBudgetBalancesTx locks the given budgets in id order and returns their
+// current balances.
+func lockBudgetBalancesTx(ctx context.Context, tx *sql.Tx, ids []int64) (map[int64]Cents, error) {
+	if err := lockBudgetsTx(ctx, tx, ids); err != nil {
+		return nil, err
+	}
+	balances := make(map[int64]Cents, len(ids))
+	for _, id := range ids {
+		balance, err := budgetBalanceTx(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		balances[id] = balance
+	}
+	return balances, nil
+}
+
+// lockBudgetsTx locks the given budgets in id order, so transactions locking
+// overlapping sets of budgets can't deadlock on each other.
+func lockBudgetsTx(ctx context.Context, tx *sql.Tx, ids []int64) error {
+	sorted := append([]int64(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for i, id := range sorted {
+		if i > 0 && id == sorted[i-1] {
+			continue
+		}
+		var locked int64
+		if err := tx.QueryRowContext(ctx, `SELECT id FROM budgets WHERE id = $1 FOR UPDATE`, id).Scan(&locked); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func budgetBalanceTx(ctx context.Context, q queryer, budgetID int64) (Cents, error) {
+	var balance Cents
+	if err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE WHEN credit THEN amount_cents ELSE -amount_cents END), 0)::BIGINT
+		FROM transacts
+		WHERE budget_id = $1 AND deleted_at IS NULL;
+	`, budgetID).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("select balance: %w", err)
+	}
+	return balance, nil
+}
+
+// allocateCappedCents splits totalCents by weight like allocateWeightedCents,
+// but never gives a source more than its cap. Whatever a capped source can't
+// take is shared among the others, so the result only falls short of
+// totalCents when every source is full.
+func allocateCappedCents(totalCents int64, sources []AutoBalanceSource, caps []int64) []int64 {
+	allocations := make([]int64, len(sources))
+	active := make([]int, 0, len(sources))
+	for i, source := range sources {
+		if source.Weight > 0 && caps[i] > 0 {
+			active = append(active, i)
+		}
+	}
+	remaining := totalCents
+	for remaining > 0 && len(active) > 0 {
+		subset := make([]AutoBalanceSource, len(active))
+		for k, idx := range active {
+			subset[k] = sources[idx]
+		}
+		shares := allocateWeightedCents(remaining, subset)
+		next := active[:0]
+		for k, idx := range active {
+			give := shares[k]
+			if room := caps[idx] - allocations[idx]; give > room {
+				give = room
+			}
+			allocations[idx] += give
+			remaining -= give
+			if allocations[idx] < caps[idx] {
+				next = append(next, idx)
+			}
+		}
+		if len(next) == len(active) {
+			break
+		}
+		active = next
+	}
+	return allocations
+}
+
+// weightFromCents turns an amount into an allocation weight so deficits can
+// be shared proportionally through allocateWeightedCents.
+func weightFromCents(cents int64) int {
+	if cents > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(cents)
+}
+
+func addCapped(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestAllocateCappedCents(t *testing.T) {
+	sources := []AutoBalanceSource{
+		{SourceBudgetID: 1, Weight: 1},
+		{SourceBudgetID: 2, Weight: 1},
+		{SourceBudgetID: 3, Weight: 2},
+	}
+
+	uncapped := allocateCappedCents(1001, sources, []int64{math.MaxInt64, math.MaxInt64, math.MaxInt64})
+	weighted := allocateWeightedCents(1001, sources)
+	for i := range uncapped {
+		if uncapped[i] != weighted[i] {
+			t.Fatalf("expected uncapped allocation to match weighted, got %v vs %v", uncapped, weighted)
+		}
+	}
+
+	capped := allocateCappedCents(1000, sources, []int64{100, math.MaxInt64, math.MaxInt64})
+	if capped[0] != 100 {
+		t.Fatalf("expected first source capped at 100, got %v", capped)
+	}
+	if capped[0]+capped[1]+capped[2] != 1000 {
+		t.Fatalf("expected full allocation, got %v", capped)
+	}
+	if capped[2] != 2*capped[1] {
+		t.Fatalf("expected overflow shared by weight, got %v", capped)
+	}
+
+	short := allocateCappedCents(1000, sources, []int64{100, 200, 300})
+	if short[0] != 100 || short[1] != 200 || short[2] != 300 {
+		t.Fatalf("expected every source at its cap, got %v", short)
+	}
+}
+
+func TestAllocateAutoBalanceCents(t *testing.T) {
+	sources := []AutoBalanceSource{
+		{SourceBudgetID: 1, Mode: AutoBalancePriority, Priority: 1},
+		{SourceBudgetID: 2, Mode: AutoBalancePriority, Priority: 2},
+		{SourceBudgetID: 3, Mode: AutoBalancePriority, Priority: 3},
+	}
+	got := allocateAutoBalanceCents(1000, sources, []int64{300, -50, 10000})
+	if got[0] != 300 || got[1] != 0 || got[2] != 700 {
+		t.Fatalf("expected the waterfall to skip an overdrawn source, got %v", got)
+	}
+	got = allocateAutoBalanceCents(1000, sources, []int64{300, 500, 100})
+	if got[0] != 300 || got[1] != 500 || got[2] != 100 {
+		t.Fatalf("expected every source drained and the rest left uncovered, got %v", got)
+	}
+
+	tied := []AutoBalanceSource{
+		{SourceBudgetID: 1, Mode: AutoBalancePriority, Priority: 1},
+		{SourceBudgetID: 2, Mode: AutoBalancePriority, Priority: 1},
+		{SourceBudgetID: 3, Mode: AutoBalanceWeighted, Weight: 1},
+		{SourceBudgetID: 4, Mode: AutoBalanceWeighted, Weight: 3},
+	}
+	got = allocateAutoBalanceCents(1000, tied, []int64{200, 1000, 0, 0})
+	if got[0] != 200 || got[1] != 800 || got[2] != 0 || got[3] != 0 {
+		t.Fatalf("expected a tier to cover the deficit before weighted sources, got %v", got)
+	}
+	got = allocateAutoBalanceCents(1000, tied, []int64{100, 100, 5000, 5000})
+	if got[0] != 100 || got[1] != 100 || got[2] != 200 || got[3] != 600 {
+		t.Fatalf("expected weighted sources to share the rest, got %v", got)
+	}
+	got = allocateAutoBalanceCents(1000, tied, []int64{0, 0, 100, 5000})
+	if got[2] != 100 || got[3] != 900 {
+		t.Fatalf("expected a short weighted source's share to move to the other, got %v", got)
+	}
+	got = allocateAutoBalanceCents(1000, tied, []int64{0, 0, 100, 200})
+	if got[2] != 100 || got[3] != 200 {
+		t.Fatalf("expected weighted sources to stop at their floors, got %v", got)
+	}
+}
+
+func TestAutoBalanceSourceNormalize(t *testing.T) {
+	s, err := AutoBalanceSource{SourceBudgetID: 2, Weight: 1}.normalize()
+	if err != nil || s.Mode != AutoBalanceWeighted {
+		t.Fatalf("expected weighted default, got %+v, %v", s, err)
+	}
+	invalid := []AutoBalanceSource{
+		{Weight: 101},
+		{Mode: "random"},
+		{Mode: AutoBalancePriority, Priority: -1},
+		{Mode: AutoBalanceWeighted, Priority: 2},
+		{Floor: -1},
+	}
+	for _, s := range invalid {
+		if _, err := s.normalize(); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("expected %+v to be invalid, got %v", s, err)
+		}
+	}
+}
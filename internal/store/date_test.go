@@ -0,0 +1,38 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDateJSONRoundTrip(t *testing.T) {
+	var d Date
+	if err := json.Unmarshal([]byte(`"2024-02-29"`), &d); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(out) != `"2024-02-29"` {
+		t.Fatalf("got %s", out)
+	}
+}
+
+func TestDateRejectsTimestamps(t *testing.T) {
+	var d Date
+	for _, input := range []string{`"2024-02-30"`, `"2024-02-01T10:00:00Z"`, `20240201`} {
+		if err := json.Unmarshal([]byte(input), &d); err == nil {
+			t.Fatalf("expected %s to be rejected", input)
+		}
+	}
+}
+
+func TestDateOfDropsTimeOfDay(t *testing.T) {
+	loc := time.FixedZone("UTC-7", -7*60*60)
+	got := DateOf(time.Date(2024, 3, 31, 23, 30, 0, 0, loc))
+	if got.String() != "2024-03-31" {
+		t.Fatalf("got %s", got)
+	}
+}
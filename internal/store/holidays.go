@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Holiday is a day payroll treats as a non-business day, like a weekend,
+// when a schedule moves pay dates to business days.
+type Holiday struct {
+	Date      Date      `json:"date"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// holidaySet holds holiday dates as YYYY-MM-DD strings.
+type holidaySet map[string]bool
+
+// isBusinessDay reports whether day is a weekday that isn't a holiday.
+func (h holidaySet) isBusinessDay(day time.Time) bool {
+	if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return !h[day.Format(dateLayout)]
+}
+
+// loadHolidaysTx reads every holiday.
+func loadHolidaysTx(ctx context.Context, q queryer) (holidaySet, error) {
+	rows, err := q.QueryContext(ctx, `SELECT day FROM holidays`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holidays := holidaySet{}
+	for rows.Next() {
+		var day Date
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		holidays[day.String()] = true
+	}
+	return holidays, rows.Err()
+}
+
+// ListHolidays returns the holiday list, oldest first.
+func (s *Store) ListHolidays(ctx context.Context) ([]Holiday, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT day, name, created_at FROM holidays ORDER BY day`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holidays := []Holiday{}
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.Date, &h.Name, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// SetHoliday adds a holiday, or renames the one already on its date.
+func (s *Store) SetHoliday(ctx context.Context, h Holiday) (Holiday, error) {
+	if h.Date.IsZero() {
+		return Holiday{}, invalidf("date is required")
+	}
+	h.Name = strings.TrimSpace(h.Name)
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO holidays (day, name, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (day) DO UPDATE SET name = EXCLUDED.name
+		RETURNING created_at;
+	`, h.Date, h.Name).Scan(&h.CreatedAt)
+	return h, err
+}
+
+// DeleteHoliday removes the holiday on day.
+func (s *Store) DeleteHoliday(ctx context.Context, day Date) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM holidays WHERE day = $1`, day)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
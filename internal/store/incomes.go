@@ -0,0 +1,723 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Income is a recurring paycheck and the plan that distributes it across
+// budgets. Each deposit pays the fixed allocations first, then the
+// percentage allocations (of the whole paycheck, rounded down to the cent),
+// and sends whatever is left to RemainderBudgetID. Plans are zero-based:
+// without a remainder budget the allocations must add up to the paycheck.
+//
+// With AutoPost set the payroll scheduler deposits Amount on every pay date
+// of Schedule; PaidThrough is the latest pay date it has posted.
+type Income struct {
+	ID                int64              `json:"id"`
+	UserID            *int64             `json:"user_id,omitempty"`
+	Name              string             `json:"name"`
+	Amount            Cents              `json:"amount"`
+	Schedule          PayrollSchedule    `json:"schedule"`
+	AutoPost          bool               `json:"auto_post"`
+	Allocations       []IncomeAllocation `json:"allocations"`
+	RemainderBudgetID *int64             `json:"remainder_budget_id,omitempty"`
+	// Distribution is how a deposit of Amount is split under the plan.
+	Distribution []IncomeShare `json:"distribution"`
+	PaidThrough  *Date         `json:"paid_through,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// IncomeAllocation sends a fixed Amount or a Percent (0.01 to 100, two
+// decimal places) of each paycheck to a budget. Exactly one is set.
+type IncomeAllocation struct {
+	BudgetID int64   `json:"budget_id"`
+	Amount   Cents   `json:"amount,omitempty"`
+	Percent  float64 `json:"percent,omitempty"`
+}
+
+// IncomeShare is one budget's part of a paycheck.
+type IncomeShare struct {
+	BudgetID int64 `json:"budget_id"`
+	Amount   Cents `json:"amount"`
+}
+
+// IncomeInput carries the editable fields of an income. A nil AutoPost means
+// true on create and unchanged on update.
+type IncomeInput struct {
+	Name              string             `json:"name"`
+	Amount            Cents              `json:"amount"`
+	Schedule          PayrollSchedule    `json:"schedule"`
+	AutoPost          *bool              `json:"auto_post"`
+	Allocations       []IncomeAllocation `json:"allocations"`
+	RemainderBudgetID *int64             `json:"remainder_budget_id"`
+}
+
+// IncomeDeposit is one paycheck received for an income and the credits that
+// distributed it. Scheduled deposits were posted by the scheduler on Period.
+type IncomeDeposit struct {
+	ID        int64         `json:"id"`
+	IncomeID  int64         `json:"income_id"`
+	UserID    *int64        `json:"user_id,omitempty"`
+	Period    Date          `json:"period"`
+	Amount    Cents         `json:"amount"`
+	Scheduled bool          `json:"scheduled"`
+	Credits   []Transaction `json:"credits"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+const incomeColumns = `id, user_id, name, amount_cents, frequency, anchor, days, interval_days, time_zone, auto_post, remainder_budget_id, paid_through, created_at, updated_at`
+
+func scanIncome(row rowScanner) (Income, error) {
+	var inc Income
+	err := row.Scan(&inc.ID, &inc.UserID, &inc.Name, &inc.Amount,
+		&inc.Schedule.Frequency, &inc.Schedule.Anchor, (*dayList)(&inc.Schedule.Days), &inc.Schedule.IntervalDays, &inc.Schedule.TimeZone,
+		&inc.AutoPost, &inc.RemainderBudgetID, &inc.PaidThrough, &inc.CreatedAt, &inc.UpdatedAt)
+	return inc, err
+}
+
+// normalize trims and validates the input, checking that the plan
+// distributes a paycheck of Amount.
+func (in IncomeInput) normalize() (IncomeInput, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return IncomeInput{}, invalidf("name is required")
+	}
+	if in.Amount <= 0 {
+		return IncomeInput{}, invalidf("amount must be > 0")
+	}
+	sched, err := in.Schedule.Normalize()
+	if err != nil {
+		return IncomeInput{}, err
+	}
+	if sched.BusinessDay != "" || sched.Prorate {
+		return IncomeInput{}, invalidf("business_day and prorate only apply to budget payroll schedules")
+	}
+	in.Schedule = sched
+	if in.RemainderBudgetID != nil && *in.RemainderBudgetID <= 0 {
+		return IncomeInput{}, invalidf("remainder_budget_id must be a budget id")
+	}
+	if _, err := distributeIncome(in.Amount, in.Allocations, in.RemainderBudgetID); err != nil {
+		return IncomeInput{}, err
+	}
+	return in, nil
+}
+
+// distributeIncome splits a paycheck of amount under a plan: fixed
+// allocations first, then percentages of amount rounded down to the cent,
+// and the rest to the remainder budget. Without one, the rounding leftover of
+// a plan whose percentages cover the paycheck goes to its first percentage
+// allocation; any other leftover is an error. Shares are merged per budget in
+// allocation order and zero shares dropped.
+func distributeIncome(amount Cents, allocs []IncomeAllocation, remainderBudgetID *int64) ([]IncomeShare, error) {
+	if amount <= 0 {
+		return nil, invalidf("amount must be > 0")
+	}
+	if len(allocs) == 0 && remainderBudgetID == nil {
+		return nil, invalidf("at least one allocation or a remainder_budget_id is required")
+	}
+
+	amounts := make([]Cents, len(allocs))
+	var fixed Cents
+	var totalBP int64
+	firstPercent := -1
+	for i, a := range allocs {
+		if a.BudgetID <= 0 {
+			return nil, invalidf("every allocation needs a budget_id")
+		}
+		switch {
+		case a.Amount > 0 && a.Percent == 0:
+			amounts[i] = a.Amount
+			fixed += a.Amount
+		case a.Amount == 0 && a.Percent > 0:
+			bp := percentBasisPoints(a.Percent)
+			if bp < 1 || bp > 10000 {
+				return nil, invalidf("percent must be between 0.01 and 100")
+			}
+			totalBP += bp
+			if firstPercent < 0 {
+				firstPercent = i
+			}
+		default:
+			return nil, invalidf("each allocation needs either an amount or a percent greater than 0")
+		}
+	}
+	if totalBP > 10000 {
+		return nil, invalidf("percentages add up to more than 100")
+	}
+	if fixed > amount {
+		return nil, invalidf("fixed allocations exceed the paycheck by %s", (fixed - amount).String())
+	}
+	allocated := fixed
+	for i, a := range allocs {
+		if a.Percent > 0 {
+			amounts[i] = Cents(int64(amount) * percentBasisPoints(a.Percent) / 10000)
+			allocated += amounts[i]
+		}
+	}
+	leftover := amount - allocated
+	if leftover < 0 {
+		return nil, invalidf("allocations exceed the paycheck by %s", (-leftover).String())
+	}
+
+	var extra *IncomeShare
+	if leftover > 0 {
+		switch {
+		case remainderBudgetID != nil:
+			extra = &IncomeShare{BudgetID: *remainderBudgetID, Amount: leftover}
+		case firstPercent >= 0 && int64(amount-fixed)*10000 == int64(amount)*totalBP:
+			amounts[firstPercent] += leftover
+		default:
+			return nil, invalidf("allocations leave %s unallocated; set remainder_budget_id", leftover.String())
+		}
+	}
+
+	var shares []IncomeShare
+	index := make(map[int64]int, len(allocs)+1)
+	add := func(budgetID int64, amt Cents) {
+		if amt <= 0 {
+			return
+		}
+		if i, ok := index[budgetID]; ok {
+			shares[i].Amount += amt
+			return
+		}
+		index[budgetID] = len(shares)
+		shares = append(shares, IncomeShare{BudgetID: budgetID, Amount: amt})
+	}
+	for i, a := range allocs {
+		add(a.BudgetID, amounts[i])
+	}
+	if extra != nil {
+		add(extra.BudgetID, extra.Amount)
+	}
+	return shares, nil
+}
+
+// percentBasisPoints converts a percentage to hundredths of a percent.
+func percentBasisPoints(percent float64) int64 {
+	return int64(math.Round(percent * 100))
+}
+
+// ListIncomes returns the user's incomes by name.
+func (s *Store) ListIncomes(ctx context.Context, userID *int64) ([]Income, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + incomeColumns + ` FROM incomes`
+	var args []any
+	if userID != nil {
+		query += ` WHERE user_id = $1`
+		args = append(args, *userID)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY LOWER(name), id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	incomes := []Income{}
+	for rows.Next() {
+		inc, err := scanIncome(rows)
+		if err != nil {
+			return nil, err
+		}
+		incomes = append(incomes, inc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range incomes {
+		if err := loadIncomeAllocationsTx(ctx, tx, &incomes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return incomes, tx.Commit()
+}
+
+func (s *Store) GetIncome(ctx context.Context, id int64, userID *int64) (Income, error) {
+	return loadIncomeTx(ctx, s.db, id, userID, false)
+}
+
+// CreateIncome saves an income and its distribution plan. The user needs
+// access to every budget the plan pays.
+func (s *Store) CreateIncome(ctx context.Context, userID *int64, in IncomeInput) (Income, error) {
+	in, err := in.normalize()
+	if err != nil {
+		return Income{}, err
+	}
+	autoPost := in.AutoPost == nil || *in.AutoPost
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Income{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureIncomePlanAccessTx(ctx, tx, in.Allocations, in.RemainderBudgetID, userID); err != nil {
+		return Income{}, err
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO incomes (user_id, name, amount_cents, frequency, anchor, days, interval_days, time_zone, auto_post, remainder_budget_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
+		RETURNING id;
+	`, userID, in.Name, in.Amount, in.Schedule.Frequency, in.Schedule.Anchor, dayList(in.Schedule.Days), in.Schedule.IntervalDays, in.Schedule.TimeZone, autoPost, in.RemainderBudgetID).Scan(&id); err != nil {
+		return Income{}, err
+	}
+	if err := insertIncomeAllocationsTx(ctx, tx, id, in.Allocations); err != nil {
+		return Income{}, err
+	}
+	inc, err := loadIncomeTx(ctx, tx, id, userID, false)
+	if err != nil {
+		return Income{}, err
+	}
+	if err := auditIncomeTx(ctx, tx, userID, auditEvent{entity: AuditIncome, entityID: id, action: AuditCreate, after: inc}, &inc); err != nil {
+		return Income{}, err
+	}
+	return inc, tx.Commit()
+}
+
+// UpdateIncome replaces an income's details and distribution plan. A new
+// schedule only posts pay dates after the income's last posted one.
+func (s *Store) UpdateIncome(ctx context.Context, id int64, userID *int64, in IncomeInput) (Income, error) {
+	in, err := in.normalize()
+	if err != nil {
+		return Income{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Income{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := loadIncomeTx(ctx, tx, id, userID, true)
+	if err != nil {
+		return Income{}, err
+	}
+	if err := ensureIncomePlanAccessTx(ctx, tx, in.Allocations, in.RemainderBudgetID, userID); err != nil {
+		return Income{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE incomes
+		SET name = $1, amount_cents = $2, frequency = $3, anchor = $4, days = $5, interval_days = $6, time_zone = $7,
+			auto_post = COALESCE($8, auto_post), remainder_budget_id = $9, updated_at = NOW()
+		WHERE id = $10
+	`, in.Name, in.Amount, in.Schedule.Frequency, in.Schedule.Anchor, dayList(in.Schedule.Days), in.Schedule.IntervalDays, in.Schedule.TimeZone, in.AutoPost, in.RemainderBudgetID, id); err != nil {
+		return Income{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM income_allocations WHERE income_id = $1`, id); err != nil {
+		return Income{}, err
+	}
+	if err := insertIncomeAllocationsTx(ctx, tx, id, in.Allocations); err != nil {
+		return Income{}, err
+	}
+	inc, err := loadIncomeTx(ctx, tx, id, userID, false)
+	if err != nil {
+		return Income{}, err
+	}
+	if err := auditIncomeTx(ctx, tx, userID, auditEvent{entity: AuditIncome, entityID: id, action: AuditUpdate, before: before, after: inc}, &before, &inc); err != nil {
+		return Income{}, err
+	}
+	return inc, tx.Commit()
+}
+
+// DeleteIncome removes an income with its plan and deposit history. Credits
+// it already posted stay in their budgets.
+func (s *Store) DeleteIncome(ctx context.Context, id int64, userID *int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inc, err := loadIncomeTx(ctx, tx, id, userID, true)
+	if err != nil {
+		return err
+	}
+	deposits, err := incomeDepositsTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM incomes WHERE id = $1`, id); err != nil {
+		return err
+	}
+	// The deposits go with the income, so keep them in the entry.
+	before := struct {
+		Income
+		Deposits []IncomeDeposit `json:"deposits"`
+	}{inc, deposits}
+	if err := auditIncomeTx(ctx, tx, userID, auditEvent{entity: AuditIncome, entityID: id, action: AuditDelete, before: before}, &inc); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListIncomeDeposits returns an income's deposits, newest pay date first,
+// with the credits that distributed each one.
+func (s *Store) ListIncomeDeposits(ctx context.Context, id int64, userID *int64) ([]IncomeDeposit, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := loadIncomeTx(ctx, tx, id, userID, false); err != nil {
+		return nil, err
+	}
+	deposits, err := incomeDepositsTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[int64]int, len(deposits))
+	for i, d := range deposits {
+		index[d.ID] = i
+	}
+
+	credits, err := queryTransactionsTx(ctx, tx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE income_deposit_id IN (SELECT id FROM income_deposits WHERE income_id = $1) AND deleted_at IS NULL
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range credits {
+		if i, ok := index[*t.IncomeDepositID]; ok {
+			deposits[i].Credits = append(deposits[i].Credits, t)
+		}
+	}
+	return deposits, tx.Commit()
+}
+
+// incomeDepositsTx returns an income's deposits, newest pay date first,
+// without their credits.
+func incomeDepositsTx(ctx context.Context, q queryer, incomeID int64) ([]IncomeDeposit, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, income_id, user_id, period, amount_cents, scheduled, created_at
+		FROM income_deposits
+		WHERE income_id = $1
+		ORDER BY period DESC, id DESC
+	`, incomeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deposits := []IncomeDeposit{}
+	for rows.Next() {
+		var d IncomeDeposit
+		if err := rows.Scan(&d.ID, &d.IncomeID, &d.UserID, &d.Period, &d.Amount, &d.Scheduled, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.Credits = []Transaction{}
+		deposits = append(deposits, d)
+	}
+	return deposits, rows.Err()
+}
+
+// RecordIncomeDeposit records a paycheck received for an income on period
+// (today when nil) and credits its distribution to the plan's budgets. A nil
+// amount deposits the income's usual amount; a different amount is split by
+// the same plan. Each pay date can be deposited once, so a paycheck recorded
+// by hand on a pay date replaces the scheduled one.
+func (s *Store) RecordIncomeDeposit(ctx context.Context, id int64, userID *int64, period *Date, amount *Cents) (IncomeDeposit, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return IncomeDeposit{}, err
+	}
+	defer tx.Rollback()
+
+	inc, err := loadIncomeTx(ctx, tx, id, userID, true)
+	if err != nil {
+		return IncomeDeposit{}, err
+	}
+	day := DateOf(time.Now().In(inc.Schedule.Location()))
+	if period != nil {
+		day = *period
+	}
+	amt := inc.Amount
+	if amount != nil {
+		amt = *amount
+	}
+	dep, ok, err := depositIncomeTx(ctx, tx, userID, inc, day, amt, false)
+	if err != nil {
+		return IncomeDeposit{}, err
+	}
+	if !ok {
+		return IncomeDeposit{}, invalidf("a paycheck for %s is already recorded", day.String())
+	}
+	return dep, tx.Commit()
+}
+
+// PostScheduledIncomes deposits every auto-posted income on each of its pay
+// dates on or before now that hasn't been posted yet, catching up missed
+// ones. An income that has never been posted starts with its current pay
+// date. Each income runs under a savepoint, so one that fails is rolled back
+// and reported in the error while the rest go ahead. It returns the number of
+// deposits made.
+func (s *Store) PostScheduledIncomes(ctx context.Context, now time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+incomeColumns+` FROM incomes WHERE auto_post ORDER BY id FOR UPDATE`)
+	if err != nil {
+		return 0, fmt.Errorf("select incomes: %w", err)
+	}
+	defer rows.Close()
+	var incomes []Income
+	for rows.Next() {
+		inc, err := scanIncome(rows)
+		if err != nil {
+			return 0, fmt.Errorf("scan income: %w", err)
+		}
+		incomes = append(incomes, inc)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows err: %w", err)
+	}
+	rows.Close()
+
+	count := 0
+	var failures []string
+	for _, inc := range incomes {
+		if err := loadIncomeAllocationsTx(ctx, tx, &inc); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT income_deposit`); err != nil {
+			return 0, fmt.Errorf("savepoint: %w", err)
+		}
+		posted, err := postIncomePeriodsTx(ctx, tx, inc, now.In(inc.Schedule.Location()))
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT income_deposit`); rbErr != nil {
+				return 0, fmt.Errorf("income %d: %w (rollback: %v)", inc.ID, err, rbErr)
+			}
+			failures = append(failures, fmt.Sprintf("income %d: %v", inc.ID, err))
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT income_deposit`); err != nil {
+			return 0, fmt.Errorf("release savepoint: %w", err)
+		}
+		count += posted
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if len(failures) > 0 {
+		return count, errors.New(strings.Join(failures, "; "))
+	}
+	return count, nil
+}
+
+// nextIncomeDue returns the earliest moment after now at which
+// PostScheduledIncomes has work to do, or ok=false when nothing is
+// auto-posted.
+func nextIncomeDue(ctx context.Context, q queryer, now time.Time) (next time.Time, ok bool, err error) {
+	rows, err := q.QueryContext(ctx, `SELECT `+incomeColumns+` FROM incomes WHERE auto_post`)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		inc, err := scanIncome(rows)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		local := now.In(inc.Schedule.Location())
+		due := inc.Schedule.Next(local)
+		if len(inc.Schedule.pendingSince(inc.PaidThrough, local, nil)) > 0 {
+			due = now
+		}
+		if !ok || due.Before(next) {
+			next, ok = due, true
+		}
+	}
+	return next, ok, rows.Err()
+}
+
+// postIncomePeriodsTx deposits an income's pending pay dates as of now, in
+// the income's time zone, acting as the income's owner.
+func postIncomePeriodsTx(ctx context.Context, tx *sql.Tx, inc Income, now time.Time) (int, error) {
+	posted := 0
+	for _, period := range inc.Schedule.pendingSince(inc.PaidThrough, now, nil) {
+		_, ok, err := depositIncomeTx(ctx, tx, inc.UserID, inc, DateOf(period), inc.Amount, true)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			posted++
+		}
+	}
+	return posted, nil
+}
+
+// depositIncomeTx records one paycheck and credits its distribution. It
+// returns ok=false without crediting anything when period already has a
+// deposit. Scheduled deposits advance the income's paid_through either way,
+// so a period deposited by hand stops coming due.
+func depositIncomeTx(ctx context.Context, tx *sql.Tx, userID *int64, inc Income, period Date, amount Cents, scheduled bool) (IncomeDeposit, bool, error) {
+	shares, err := distributeIncome(amount, inc.Allocations, inc.RemainderBudgetID)
+	if err != nil {
+		return IncomeDeposit{}, false, err
+	}
+	for _, share := range shares {
+		if err := ensureBudgetAccessTx(ctx, tx, share.BudgetID, userID); err != nil {
+			return IncomeDeposit{}, false, fmt.Errorf("budget %d: %w", share.BudgetID, err)
+		}
+	}
+
+	dep := IncomeDeposit{IncomeID: inc.ID, UserID: userID, Period: period, Amount: amount, Scheduled: scheduled, Credits: []Transaction{}}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO income_deposits (income_id, user_id, period, amount_cents, scheduled, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (income_id, period) DO NOTHING
+		RETURNING id, created_at;
+	`, inc.ID, userID, period, amount, scheduled).Scan(&dep.ID, &dep.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		if scheduled {
+			return IncomeDeposit{}, false, markIncomePaidTx(ctx, tx, inc.ID, period)
+		}
+		return IncomeDeposit{}, false, nil
+	}
+	if err != nil {
+		return IncomeDeposit{}, false, err
+	}
+
+	description := fmt.Sprintf("%s %s", inc.Name, period.Format("January 2, 2006"))
+	for _, share := range shares {
+		t, err := scanTransaction(tx.QueryRowContext(ctx, `
+			INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, income_deposit_id, created_at, updated_at)
+			VALUES ($1, $2, $3, TRUE, $4, $5, $6, NOW(), NOW())
+			RETURNING `+transactionColumns+`;
+		`, share.BudgetID, userID, description, share.Amount, period, dep.ID))
+		if err != nil {
+			return IncomeDeposit{}, false, err
+		}
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &t)); err != nil {
+			return IncomeDeposit{}, false, err
+		}
+		dep.Credits = append(dep.Credits, t)
+	}
+
+	if scheduled {
+		if err := markIncomePaidTx(ctx, tx, inc.ID, period); err != nil {
+			return IncomeDeposit{}, false, err
+		}
+	}
+	return dep, true, nil
+}
+
+// markIncomePaidTx records that an income's scheduled deposits ran for period.
+func markIncomePaidTx(ctx context.Context, tx *sql.Tx, incomeID int64, period Date) error {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE incomes SET paid_through = GREATEST(paid_through, $2::DATE) WHERE id = $1
+	`, incomeID, period); err != nil {
+		return fmt.Errorf("update paid_through: %w", err)
+	}
+	return nil
+}
+
+// loadIncomeTx reads an income owned by userID (any income when nil) with
+// its plan. With lock set the income row stays locked until the transaction
+// ends.
+func loadIncomeTx(ctx context.Context, q queryer, id int64, userID *int64, lock bool) (Income, error) {
+	query := `SELECT ` + incomeColumns + ` FROM incomes WHERE id = $1`
+	args := []any{id}
+	if userID != nil {
+		query += ` AND user_id = $2`
+		args = append(args, *userID)
+	}
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	inc, err := scanIncome(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Income{}, ErrNotFound
+	}
+	if err != nil {
+		return Income{}, err
+	}
+	return inc, loadIncomeAllocationsTx(ctx, q, &inc)
+}
+
+// loadIncomeAllocationsTx fills in an income's allocations and its
+// distribution of Amount.
+func loadIncomeAllocationsTx(ctx context.Context, q queryer, inc *Income) error {
+	rows, err := q.QueryContext(ctx, `
+		SELECT budget_id, amount_cents, percent_bp
+		FROM income_allocations
+		WHERE income_id = $1
+		ORDER BY position
+	`, inc.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	inc.Allocations = []IncomeAllocation{}
+	for rows.Next() {
+		var a IncomeAllocation
+		var bp int64
+		if err := rows.Scan(&a.BudgetID, &a.Amount, &bp); err != nil {
+			return err
+		}
+		a.Percent = float64(bp) / 100
+		inc.Allocations = append(inc.Allocations, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// A plan saved before a budget was purged may no longer add up; show it
+	// without a distribution rather than failing to load.
+	inc.Distribution, _ = distributeIncome(inc.Amount, inc.Allocations, inc.RemainderBudgetID)
+	if inc.Distribution == nil {
+		inc.Distribution = []IncomeShare{}
+	}
+	return nil
+}
+
+func insertIncomeAllocationsTx(ctx context.Context, tx *sql.Tx, incomeID int64, allocs []IncomeAllocation) error {
+	for i, a := range allocs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO income_allocations (income_id, position, budget_id, amount_cents, percent_bp)
+			VALUES ($1, $2, $3, $4, $5)
+		`, incomeID, i, a.BudgetID, a.Amount, percentBasisPoints(a.Percent)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureIncomePlanAccessTx(ctx context.Context, tx *sql.Tx, allocs []IncomeAllocation, remainderBudgetID *int64, userID *int64) error {
+	seen := make(map[int64]struct{}, len(allocs)+1)
+	ids := make([]int64, 0, len(allocs)+1)
+	for _, a := range allocs {
+		ids = append(ids, a.BudgetID)
+	}
+	if remainderBudgetID != nil {
+		ids = append(ids, *remainderBudgetID)
+	}
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistributeIncome(t *testing.T) {
+	savings := int64(9)
+	shares, err := distributeIncome(300000, []IncomeAllocation{
+		{BudgetID: 1, Amount: 120000},
+		{BudgetID: 2, Percent: 10},
+		{BudgetID: 3, Percent: 12.5},
+		{BudgetID: 1, Amount: 5000},
+	}, &savings)
+	if err != nil {
+		t.Fatalf("distributeIncome error: %v", err)
+	}
+	want := []IncomeShare{{BudgetID: 1, Amount: 125000}, {BudgetID: 2, Amount: 30000}, {BudgetID: 3, Amount: 37500}, {BudgetID: 9, Amount: 107500}}
+	if len(shares) != len(want) {
+		t.Fatalf("expected %d shares, got %+v", len(want), shares)
+	}
+	for i := range want {
+		if shares[i] != want[i] {
+			t.Fatalf("share %d: expected %+v, got %+v", i, want[i], shares[i])
+		}
+	}
+
+	// Percentages covering the paycheck absorb their rounding leftover.
+	thirds, err := distributeIncome(10000, []IncomeAllocation{
+		{BudgetID: 1, Percent: 33.33},
+		{BudgetID: 2, Percent: 33.33},
+		{BudgetID: 3, Percent: 33.34},
+	}, nil)
+	if err != nil {
+		t.Fatalf("distributeIncome error: %v", err)
+	}
+	if thirds[0].Amount != 3333 || thirds[1].Amount != 3333 || thirds[2].Amount != 3334 {
+		t.Fatalf("unexpected thirds: %+v", thirds)
+	}
+	odd, err := distributeIncome(10001, []IncomeAllocation{{BudgetID: 1, Percent: 50}, {BudgetID: 2, Percent: 50}}, nil)
+	if err != nil || odd[0].Amount != 5001 || odd[1].Amount != 5000 {
+		t.Fatalf("expected rounding cent on the first percentage, got %+v, %v", odd, err)
+	}
+
+	cases := []struct {
+		name      string
+		amount    Cents
+		allocs    []IncomeAllocation
+		remainder *int64
+	}{
+		{"unallocated without remainder", 10000, []IncomeAllocation{{BudgetID: 1, Amount: 5000}}, nil},
+		{"fixed over paycheck", 10000, []IncomeAllocation{{BudgetID: 1, Amount: 12000}}, &savings},
+		{"percent over 100", 10000, []IncomeAllocation{{BudgetID: 1, Percent: 60}, {BudgetID: 2, Percent: 50}}, nil},
+		{"fixed plus percent over paycheck", 10000, []IncomeAllocation{{BudgetID: 1, Amount: 6000}, {BudgetID: 2, Percent: 50}}, nil},
+		{"amount and percent", 10000, []IncomeAllocation{{BudgetID: 1, Amount: 100, Percent: 10}}, &savings},
+		{"missing budget", 10000, []IncomeAllocation{{Amount: 100}}, &savings},
+		{"empty plan", 10000, nil, nil},
+	}
+	for _, tc := range cases {
+		if _, err := distributeIncome(tc.amount, tc.allocs, tc.remainder); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%s: expected invalid input, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestIncomeInputNormalize(t *testing.T) {
+	savings := int64(2)
+	in, err := IncomeInput{Name: "  Paycheck ", Amount: 200000, RemainderBudgetID: &savings}.normalize()
+	if err != nil {
+		t.Fatalf("normalize error: %v", err)
+	}
+	if in.Name != "Paycheck" || in.Schedule.Frequency != PayMonthly || len(in.Schedule.Days) != 1 {
+		t.Fatalf("unexpected normalized input: %+v", in)
+	}
+	if _, err := (IncomeInput{Name: "Paycheck", Amount: 200000, Schedule: PayrollSchedule{Frequency: PayWeekly}, RemainderBudgetID: &savings}).normalize(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected weekly schedule without anchor to be invalid, got %v", err)
+	}
+	if _, err := (IncomeInput{Name: "", Amount: 200000, RemainderBudgetID: &savings}).normalize(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected missing name to be invalid, got %v", err)
+	}
+	if _, err := (IncomeInput{Name: "Paycheck", Amount: 200000, Schedule: PayrollSchedule{BusinessDay: BusinessDayNext}, RemainderBudgetID: &savings}).normalize(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a business-day rule on an income to be invalid, got %v", err)
+	}
+}
+
+func TestScheduledIncomeAfterManualDeposit(t *testing.T) {
+	db := &incomeDB{deposits: map[Date]bool{}}
+	conn := sql.OpenDB(db)
+	defer conn.Close()
+	ctx := context.Background()
+
+	owner, checking := int64(1), int64(7)
+	inc := Income{ID: 3, UserID: &owner, Name: "Paycheck", Amount: 200000, Schedule: PayrollSchedule{Frequency: PayMonthly, Days: []int{1}}, RemainderBudgetID: &checking}
+	now := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	period := DateOf(now)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	if _, ok, err := depositIncomeTx(ctx, tx, &owner, inc, period, 180000, false); err != nil || !ok {
+		t.Fatalf("manual deposit: ok=%v err=%v", ok, err)
+	}
+	if db.paidThrough != nil {
+		t.Fatalf("expected a manual deposit to leave paid_through alone, got %s", db.paidThrough)
+	}
+
+	posted, err := postIncomePeriodsTx(ctx, tx, inc, now)
+	if err != nil {
+		t.Fatalf("post incomes: %v", err)
+	}
+	if posted != 0 || db.credits != 1 {
+		t.Fatalf("expected the manual deposit to replace the scheduled one, got %d posted and %d credit(s)", posted, db.credits)
+	}
+	if db.paidThrough == nil || *db.paidThrough != period {
+		t.Fatalf("expected paid_through %s, got %v", period, db.paidThrough)
+	}
+	if pending := inc.Schedule.pendingSince(db.paidThrough, now, nil); len(pending) != 0 {
+		t.Fatalf("expected nothing pending after the scheduled post, got %v", pending)
+	}
+}
+
+func TestDeleteIncomeIsAudited(t *testing.T) {
+	db := &incomeDB{deposits: map[Date]bool{DateOf(time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)): true}}
+	conn := sql.OpenDB(db)
+	defer conn.Close()
+
+	owner := int64(1)
+	if err := New(conn).DeleteIncome(context.Background(), 3, &owner); err != nil {
+		t.Fatalf("delete income: %v", err)
+	}
+	if !db.deleted {
+		t.Fatalf("expected the income to be deleted")
+	}
+	if len(db.audits) != 2 {
+		t.Fatalf("expected one entry per budget the plan pays, got %d", len(db.audits))
+	}
+	for i, budgetID := range []int64{5, 7} {
+		a := db.audits[i]
+		if a[0] != budgetID || a[1] != AuditIncome || a[2] != int64(3) || a[3] != AuditDelete {
+			t.Fatalf("unexpected audit entry %d: %v", i, a[:4])
+		}
+		before, ok := a[6].(*string)
+		if !ok || before == nil || !strings.Contains(*before, `"deposits":[{`) {
+			t.Fatalf("expected the deleted deposits in the entry, got %v", a[6])
+		}
+	}
+}
+
+// incomeDB is a database/sql driver standing in for the few statements an
+// income deposit or delete runs. It remembers which periods have a deposit,
+// counts credits and records paid_through and audit entries. Its one income,
+// id 3, pays budget 5 and leaves the rest to budget 7.
+type incomeDB struct {
+	deposits    map[Date]bool
+	credits     int
+	paidThrough *Date
+	deleted     bool
+	audits      [][]driver.Value
+}
+
+func (db *incomeDB) Connect(context.Context) (driver.Conn, error) { return incomeConn{db}, nil }
+func (db *incomeDB) Driver() driver.Driver                        { return nil }
+
+type incomeConn struct{ db *incomeDB }
+
+func (c incomeConn) Prepare(query string) (driver.Stmt, error) { return incomeStmt{c.db, query}, nil }
+func (c incomeConn) Close() error                              { return nil }
+func (c incomeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c incomeConn) Commit() error                             { return nil }
+func (c incomeConn) Rollback() error                           { return nil }
+func (c incomeConn) CheckNamedValue(*driver.NamedValue) error  { return nil }
+
+type incomeStmt struct {
+	db    *incomeDB
+	query string
+}
+
+func (s incomeStmt) Close() error  { return nil }
+func (s incomeStmt) NumInput() int { return -1 }
+
+func (s incomeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.Contains(s.query, "UPDATE incomes SET paid_through"):
+		period := args[1].(Date)
+		s.db.paidThrough = &period
+	case strings.Contains(s.query, "DELETE FROM incomes"):
+		s.db.deleted = true
+	case strings.Contains(s.query, "INSERT INTO audit_log"):
+		s.db.audits = append(s.db.audits, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s incomeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	now := time.Now()
+	switch {
+	case strings.Contains(s.query, "FROM users_budgets"):
+		return &incomeRows{cols: []string{"exists"}, rows: [][]driver.Value{{true}}}, nil
+	case strings.Contains(s.query, "FROM incomes WHERE id"):
+		row := []driver.Value{int64(3), int64(1), "Paycheck", int64(200000), "monthly", nil, "1", int64(0), "", true, int64(7), nil, now, now}
+		return &incomeRows{cols: strings.Split(incomeColumns, ", "), rows: [][]driver.Value{row}}, nil
+	case strings.Contains(s.query, "FROM income_allocations"):
+		return &incomeRows{cols: []string{"budget_id", "amount_cents", "percent_bp"}, rows: [][]driver.Value{{int64(5), int64(50000), int64(0)}}}, nil
+	case strings.Contains(s.query, "FROM income_deposits"):
+		var rows [][]driver.Value
+		for period := range s.db.deposits {
+			rows = append(rows, []driver.Value{int64(len(rows) + 1), int64(3), int64(1), period.Time, int64(200000), true, now})
+		}
+		return &incomeRows{cols: []string{"id", "income_id", "user_id", "period", "amount_cents", "scheduled", "created_at"}, rows: rows}, nil
+	case strings.Contains(s.query, "INSERT INTO income_deposits"):
+		period := args[2].(Date)
+		if s.db.deposits[period] {
+			return &incomeRows{cols: []string{"id", "created_at"}}, nil
+		}
+		s.db.deposits[period] = true
+		return &incomeRows{cols: []string{"id", "created_at"}, rows: [][]driver.Value{{int64(len(s.db.deposits)), now}}}, nil
+	case strings.Contains(s.query, "INSERT INTO transacts"):
+		s.db.credits++
+		period := args[4].(Date)
+		row := []driver.Value{int64(s.db.credits), args[0], nil, args[2], true, int64(args[3].(Cents)), period.Time, nil, nil, nil, false, nil, nil, args[5], now, now, nil}
+		return &incomeRows{cols: strings.Split(transactionColumns, ", "), rows: [][]driver.Value{row}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+type incomeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *incomeRows) Columns() []string { return r.cols }
+func (r *incomeRows) Close() error      { return nil }
+
+func (r *incomeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PayrollLease is the lease the payroll scheduler must hold to run.
+const PayrollLease = "payroll"
+
+// Lease is a named, expiring claim that lets one of several API replicas
+// run a background job. Active reports whether it hadn't expired when read.
+type Lease struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Active     bool      `json:"active"`
+}
+
+const leaseColumns = `name, holder, acquired_at, renewed_at, expires_at, expires_at > NOW()`
+
+func scanLease(row rowScanner) (Lease, error) {
+	var l Lease
+	err := row.Scan(&l.Name, &l.Holder, &l.AcquiredAt, &l.RenewedAt, &l.ExpiresAt, &l.Active)
+	return l, err
+}
+
+// AcquireLease claims or renews the lease for holder until ttl from now. It
+// succeeds when the lease is free, expired or already held by holder;
+// otherwise it returns the current lease and false. Expiry is judged by the
+// database clock so replicas with skewed clocks agree.
+func (s *Store) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (Lease, bool, error) {
+	l, err := scanLease(s.db.QueryRowContext(ctx, `
+		INSERT INTO scheduler_leases (name, holder, acquired_at, renewed_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW(), NOW() + $3::BIGINT * INTERVAL '1 millisecond')
+		ON CONFLICT (name) DO UPDATE
+		SET holder = EXCLUDED.holder,
+			acquired_at = CASE WHEN scheduler_leases.holder = EXCLUDED.holder AND scheduler_leases.expires_at > NOW()
+				THEN scheduler_leases.acquired_at ELSE NOW() END,
+			renewed_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE scheduler_leases.holder = EXCLUDED.holder OR scheduler_leases.expires_at <= NOW()
+		RETURNING `+leaseColumns+`;
+	`, name, holder, ttl.Milliseconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		current, err := s.GetLease(ctx, name)
+		return current, false, err
+	}
+	if err != nil {
+		return Lease{}, false, err
+	}
+	return l, true, nil
+}
+
+// ReleaseLease expires holder's lease so another replica can take over
+// without waiting for it to run out. It does nothing if holder lost it.
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE scheduler_leases
+		SET expires_at = NOW()
+		WHERE name = $1 AND holder = $2 AND expires_at > NOW()
+	`, name, holder)
+	return err
+}
+
+func (s *Store) GetLease(ctx context.Context, name string) (Lease, error) {
+	l, err := scanLease(s.db.QueryRowContext(ctx, `SELECT `+leaseColumns+` FROM scheduler_leases WHERE name = $1`, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Lease{}, ErrNotFound
+	}
+	return l, err
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Cents is an exact amount of money in minor units (hundredths of a dollar).
+// It is stored as BIGINT and encodes to JSON as a decimal number so API
+// clients keep sending and receiving dollar amounts like 12.34.
+type Cents int64
+
+// ParseCents converts a decimal string such as "12.34" into Cents. Values with
+// more than two fractional digits are rounded half away from zero.
+func ParseCents(value string) (Cents, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	r.Mul(r, big.NewRat(100, 1))
+
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("amount %q out of range", value)
+	}
+	cents := quo.Int64()
+	if r.Sign() < 0 {
+		cents = -cents
+	}
+	return Cents(cents), nil
+}
+
+// String formats the amount as a plain decimal with two fractional digits.
+func (c Cents) String() string {
+	sign := ""
+	abs := uint64(c)
+	if c < 0 {
+		sign = "-"
+		abs = uint64(-c)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+func (c Cents) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (c *Cents) UnmarshalJSON(data []byte) error {
+	raw := strings.TrimSpace(string(data))
+	if raw == "null" {
+		*c = 0
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		raw = unquoted
+	}
+	parsed, err := ParseCents(raw)
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
+
+func (c Cents) Value() (driver.Value, error) {
+	return int64(c), nil
+}
+
+func (c *Cents) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = 0
+	case int64:
+		*c = Cents(v)
+	case []byte:
+		return c.scanString(string(v))
+	case string:
+		return c.scanString(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Cents", src)
+	}
+	return nil
+}
+
+func (c *Cents) scanString(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("scan cents: %w", err)
+	}
+	*c = Cents(parsed)
+	return nil
+}
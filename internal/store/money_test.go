@@ -0,0 +1,54 @@
+package store
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Cents
+	}{
+		{in: "12.34", want: 1234},
+		{in: "0.1", want: 10},
+		{in: "250", want: 25000},
+		{in: "-3.5", want: -350},
+		{in: "0.30000000000000004", want: 30},
+		{in: "1.005", want: 101},
+		{in: "-1.005", want: -101},
+	}
+	for _, tt := range tests {
+		got, err := ParseCents(tt.in)
+		if err != nil {
+			t.Fatalf("ParseCents(%q) error: %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseCents(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseCents("abc"); err == nil {
+		t.Fatalf("expected error for invalid amount")
+	}
+}
+
+func TestCentsJSON(t *testing.T) {
+	encoded, err := json.Marshal(map[string]Cents{"a": 1234, "b": -5, "c": 0})
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+	if string(encoded) != `{"a":12.34,"b":-0.05,"c":0.00}` {
+		t.Fatalf("unexpected encoding: %s", encoded)
+	}
+
+	var decoded struct {
+		Amount Cents `json:"amount"`
+		Quoted Cents `json:"quoted"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":19.99,"quoted":"7.5"}`), &decoded); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if decoded.Amount != 1999 || decoded.Quoted != 750 {
+		t.Fatalf("unexpected decode: %+v", decoded)
+	}
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Payroll override kinds.
+const (
+	OverrideSkip   = "skip"
+	OverrideAmount = "amount"
+	OverridePause  = "pause"
+)
+
+// PayrollOverride changes one budget's scheduled payroll without touching its
+// usual amount. Skip drops the credit for the pay date Period; amount credits
+// Amount instead of the payroll on Period; pause skips every pay date from
+// From through Until. A pause wins over a skip, and a skip over an amount,
+// when they cover the same pay date. Skipped periods still count as paid and
+// still apply the budget's rollover policy.
+type PayrollOverride struct {
+	ID        int64     `json:"id"`
+	BudgetID  int64     `json:"budget_id"`
+	Kind      string    `json:"kind"`
+	Period    *Date     `json:"period,omitempty"`
+	From      *Date     `json:"from,omitempty"`
+	Until     *Date     `json:"until,omitempty"`
+	Amount    Cents     `json:"amount,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// span returns the first and last pay dates the override covers.
+func (o PayrollOverride) span() (Date, Date) {
+	if o.Kind == OverridePause {
+		return *o.From, *o.Until
+	}
+	return *o.Period, *o.Period
+}
+
+// Normalize validates an override against the budget's schedule. today, in
+// the schedule's time zone, is the default start of a pause.
+func (o PayrollOverride) Normalize(sched PayrollSchedule, today Date) (PayrollOverride, error) {
+	o.Note = strings.TrimSpace(o.Note)
+	switch o.Kind {
+	case OverrideSkip, OverrideAmount:
+		if o.Period == nil {
+			return PayrollOverride{}, invalidf("%s overrides need the pay date in period", o.Kind)
+		}
+		if o.From != nil || o.Until != nil {
+			return PayrollOverride{}, invalidf("from and until only apply to pauses")
+		}
+		day := time.Date(o.Period.Year(), o.Period.Month(), o.Period.Day(), 0, 0, 0, 0, sched.Location())
+		if start, ok := sched.PeriodStart(day); !ok || !start.Equal(day) {
+			return PayrollOverride{}, invalidf("%s is not a pay date; the next one is %s", o.Period.String(), DateOf(sched.Next(day)).String())
+		}
+		if o.Kind == OverrideAmount && o.Amount <= 0 {
+			return PayrollOverride{}, invalidf("amount must be > 0; use a skip to drop the credit")
+		}
+		if o.Kind == OverrideSkip && o.Amount != 0 {
+			return PayrollOverride{}, invalidf("amount only applies to amount overrides")
+		}
+	case OverridePause:
+		if o.Period != nil || o.Amount != 0 {
+			return PayrollOverride{}, invalidf("pauses take from and until, not period or amount")
+		}
+		if o.Until == nil {
+			return PayrollOverride{}, invalidf("pauses need an until date")
+		}
+		if o.From == nil {
+			o.From = &today
+		}
+		if o.Until.Before(o.From.Time) {
+			return PayrollOverride{}, invalidf("until must not be before from")
+		}
+	default:
+		return PayrollOverride{}, invalidf("kind must be one of %s, %s or %s", OverrideSkip, OverrideAmount, OverridePause)
+	}
+	return o, nil
+}
+
+const payrollOverrideColumns = `id, budget_id, kind, starts_on, ends_on, amount_cents, note, user_id, created_at`
+
+func scanPayrollOverride(row rowScanner) (PayrollOverride, error) {
+	var o PayrollOverride
+	var starts, ends Date
+	if err := row.Scan(&o.ID, &o.BudgetID, &o.Kind, &starts, &ends, &o.Amount, &o.Note, &o.UserID, &o.CreatedAt); err != nil {
+		return PayrollOverride{}, err
+	}
+	if o.Kind == OverridePause {
+		o.From, o.Until = &starts, &ends
+	} else {
+		o.Period = &starts
+	}
+	return o, nil
+}
+
+// ListPayrollOverrides returns a budget's overrides, latest pay date first.
+func (s *Store) ListPayrollOverrides(ctx context.Context, budgetID int64, userID *int64) ([]PayrollOverride, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+payrollOverrideColumns+`
+		FROM payroll_overrides
+		WHERE budget_id = $1
+		ORDER BY ends_on DESC, id DESC
+	`, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := []PayrollOverride{}
+	for rows.Next() {
+		o, err := scanPayrollOverride(rows)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// CreatePayrollOverride schedules an override for a budget. Each pay date
+// takes at most one skip or amount override.
+func (s *Store) CreatePayrollOverride(ctx context.Context, budgetID int64, userID *int64, in PayrollOverride) (PayrollOverride, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PayrollOverride{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return PayrollOverride{}, err
+	}
+	budget, err := lockBudgetRowTx(ctx, tx, budgetID)
+	if err != nil {
+		return PayrollOverride{}, err
+	}
+	sched := budget.PayrollSchedule
+	in, err = in.Normalize(sched, DateOf(time.Now().In(sched.Location())))
+	if err != nil {
+		return PayrollOverride{}, err
+	}
+	starts, ends := in.span()
+	o, err := scanPayrollOverride(tx.QueryRowContext(ctx, `
+		INSERT INTO payroll_overrides (budget_id, kind, starts_on, ends_on, amount_cents, note, user_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING `+payrollOverrideColumns+`;
+	`, budgetID, in.Kind, starts, ends, in.Amount, in.Note, userID))
+	if isUniqueViolation(err) {
+		return PayrollOverride{}, invalidf("%s already has an override", starts.String())
+	}
+	if err != nil {
+		return PayrollOverride{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditPayrollOverride, entityID: o.ID, action: AuditCreate, after: o}); err != nil {
+		return PayrollOverride{}, err
+	}
+	return o, tx.Commit()
+}
+
+// DeletePayrollOverride removes an override. Periods it already affected
+// stay as they were paid.
+func (s *Store) DeletePayrollOverride(ctx context.Context, budgetID, id int64, userID *int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return err
+	}
+	o, err := scanPayrollOverride(tx.QueryRowContext(ctx, `
+		DELETE FROM payroll_overrides
+		WHERE id = $1 AND budget_id = $2
+		RETURNING `+payrollOverrideColumns+`;
+	`, id, budgetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditPayrollOverride, entityID: id, action: AuditDelete, before: o}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// payrollOverrideTx returns the override that applies to a budget's pay
+// date, or nil.
+func payrollOverrideTx(ctx context.Context, tx *sql.Tx, budgetID int64, payDate Date) (*PayrollOverride, error) {
+	o, err := scanPayrollOverride(tx.QueryRowContext(ctx, `
+		SELECT `+payrollOverrideColumns+`
+		FROM payroll_overrides
+		WHERE budget_id = $1 AND starts_on <= $2 AND ends_on >= $2
+		ORDER BY CASE kind WHEN 'pause' THEN 0 WHEN 'skip' THEN 1 ELSE 2 END, id DESC
+		LIMIT 1
+	`, budgetID, payDate))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select payroll override: %w", err)
+	}
+	return &o, nil
+}
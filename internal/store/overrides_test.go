@@ -0,0 +1,43 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPayrollOverrideNormalize(t *testing.T) {
+	anchor := mustParseDate(t, "2026-01-02")
+	biweekly := PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor, IntervalDays: 14}
+	today := mustParseDate(t, "2026-02-10")
+	payDay, offDay := mustParseDate(t, "2026-01-30"), mustParseDate(t, "2026-01-31")
+
+	o, err := PayrollOverride{Kind: OverrideSkip, Period: &payDay, Note: "  vacation "}.Normalize(biweekly, today)
+	if err != nil || o.Note != "vacation" {
+		t.Fatalf("expected a valid skip, got %+v, %v", o, err)
+	}
+	o, err = PayrollOverride{Kind: OverridePause, Until: &payDay}.Normalize(biweekly, anchor)
+	if err != nil || o.From == nil || !o.From.Equal(anchor.Time) {
+		t.Fatalf("expected a pause from today, got %+v, %v", o, err)
+	}
+	from, until := o.span()
+	if from.String() != "2026-01-02" || until.String() != "2026-01-30" {
+		t.Fatalf("unexpected pause span %s..%s", from, until)
+	}
+
+	invalid := []PayrollOverride{
+		{Kind: "holiday", Period: &payDay},
+		{Kind: OverrideSkip},
+		{Kind: OverrideSkip, Period: &offDay},
+		{Kind: OverrideSkip, Period: &payDay, Amount: 100},
+		{Kind: OverrideAmount, Period: &payDay},
+		{Kind: OverrideAmount, Period: &payDay, Amount: -100},
+		{Kind: OverridePause},
+		{Kind: OverridePause, Until: &payDay},
+		{Kind: OverridePause, From: &today, Until: &payDay, Amount: 100},
+	}
+	for _, o := range invalid {
+		if _, err := o.Normalize(biweekly, today); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("expected %+v to be invalid, got %v", o, err)
+		}
+	}
+}
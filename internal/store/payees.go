@@ -0,0 +1,491 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Payee is the merchant behind a transaction. Descriptions are matched to
+// payees through their normalized name and aliases, so "Costco", "COSTCO
+// WHOLESALE" and "costco" can all land on the same payee.
+type Payee struct {
+	ID               int64        `json:"id"`
+	Name             string       `json:"name"`
+	Aliases          []PayeeAlias `json:"aliases"`
+	TransactionCount int          `json:"transaction_count"`
+	CreatedAt        time.Time    `json:"created_at"`
+	UpdatedAt        time.Time    `json:"updated_at"`
+}
+
+// PayeeAlias maps another spelling to a payee. Patterns are stored
+// normalized; Match is PayeeMatchExact or PayeeMatchPrefix.
+type PayeeAlias struct {
+	Pattern string `json:"pattern"`
+	Match   string `json:"match"`
+}
+
+const (
+	PayeeMatchExact  = "exact"
+	PayeeMatchPrefix = "prefix"
+)
+
+const maxPayeeName = 128
+
+// normalizePayeeKey lowercases s and reduces it to letters and digits
+// separated by single spaces: "COSTCO WHOLESALE #123" becomes
+// "costco wholesale 123".
+func normalizePayeeKey(s string) string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+func cleanPayeeAliases(aliases []PayeeAlias) ([]PayeeAlias, error) {
+	out := make([]PayeeAlias, 0, len(aliases))
+	seen := make(map[PayeeAlias]struct{}, len(aliases))
+	for _, a := range aliases {
+		a.Pattern = normalizePayeeKey(a.Pattern)
+		if a.Pattern == "" {
+			return nil, invalidf("alias pattern is required")
+		}
+		switch a.Match {
+		case "":
+			a.Match = PayeeMatchExact
+		case PayeeMatchExact, PayeeMatchPrefix:
+		default:
+			return nil, invalidf("alias match must be %q or %q", PayeeMatchExact, PayeeMatchPrefix)
+		}
+		if _, ok := seen[a]; ok {
+			continue
+		}
+		seen[a] = struct{}{}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func cleanPayeeName(name string) (string, string, error) {
+	name = strings.TrimSpace(name)
+	key := normalizePayeeKey(name)
+	if key == "" {
+		return "", "", invalidf("payee name is required")
+	}
+	if len(name) > maxPayeeName {
+		return "", "", invalidf("payee names are limited to %d characters", maxPayeeName)
+	}
+	return name, key, nil
+}
+
+// SearchPayees backs autocomplete: payees whose name or an alias starts with
+// q (or has a word that does), most used across the user's budgets first.
+func (s *Store) SearchPayees(ctx context.Context, userID *int64, q string, limit int) ([]Payee, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.name, p.created_at, p.updated_at,
+			(
+				SELECT COUNT(*)
+				FROM transacts t
+				JOIN budgets b ON b.id = t.budget_id AND b.deleted_at IS NULL
+				WHERE t.payee_id = p.id AND t.deleted_at IS NULL
+					AND ($1::INTEGER IS NULL OR t.budget_id IN (SELECT budget_id FROM users_budgets WHERE user_id = $1))
+			) AS uses
+		FROM payees p
+		WHERE COALESCE(p.user_id, 0) = COALESCE($1::INTEGER, 0)
+			AND (
+				$2::TEXT = ''
+				OR p.name_key LIKE $2 || '%'
+				OR p.name_key LIKE '% ' || $2 || '%'
+				OR EXISTS (SELECT 1 FROM payee_aliases a WHERE a.payee_id = p.id AND a.pattern LIKE $2 || '%')
+			)
+		ORDER BY uses DESC, LOWER(p.name), p.id
+		LIMIT $3;
+	`, userID, normalizePayeeKey(q), limit)
+	if err != nil {
+		return nil, err
+	}
+	var payees []Payee
+	for rows.Next() {
+		var p Payee
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt, &p.TransactionCount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		payees = append(payees, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return payees, loadPayeeAliases(ctx, s.db, payees)
+}
+
+func (s *Store) CreatePayee(ctx context.Context, userID *int64, name string, aliases []PayeeAlias) (Payee, error) {
+	name, key, err := cleanPayeeName(name)
+	if err != nil {
+		return Payee{}, err
+	}
+	if aliases, err = cleanPayeeAliases(aliases); err != nil {
+		return Payee{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Payee{}, err
+	}
+	defer tx.Rollback()
+
+	var p Payee
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO payees (user_id, name, name_key, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, name, created_at, updated_at;
+	`, userID, name, key).Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	if isUniqueViolation(err) {
+		return Payee{}, invalidf("payee %q already exists", name)
+	}
+	if err != nil {
+		return Payee{}, err
+	}
+	if err := insertPayeeAliasesTx(ctx, tx, p.ID, aliases); err != nil {
+		return Payee{}, err
+	}
+	p.Aliases = aliases
+	return p, tx.Commit()
+}
+
+// UpdatePayee renames a payee and, when aliases is non-nil, replaces its
+// alias rules.
+func (s *Store) UpdatePayee(ctx context.Context, id int64, userID *int64, name string, aliases []PayeeAlias) (Payee, error) {
+	name, key, err := cleanPayeeName(name)
+	if err != nil {
+		return Payee{}, err
+	}
+	if aliases != nil {
+		if aliases, err = cleanPayeeAliases(aliases); err != nil {
+			return Payee{}, err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Payee{}, err
+	}
+	defer tx.Rollback()
+
+	var p Payee
+	err = tx.QueryRowContext(ctx, `
+		UPDATE payees
+		SET name = $1, name_key = $2, updated_at = NOW()
+		WHERE id = $3 AND COALESCE(user_id, 0) = COALESCE($4::INTEGER, 0)
+		RETURNING id, name, created_at, updated_at;
+	`, name, key, id, userID).Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Payee{}, ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return Payee{}, invalidf("payee %q already exists", name)
+	}
+	if err != nil {
+		return Payee{}, err
+	}
+	if aliases != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM payee_aliases WHERE payee_id = $1`, id); err != nil {
+			return Payee{}, err
+		}
+		if err := insertPayeeAliasesTx(ctx, tx, id, aliases); err != nil {
+			return Payee{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Payee{}, err
+	}
+	payees := []Payee{p}
+	if err := loadPayeeAliases(ctx, s.db, payees); err != nil {
+		return Payee{}, err
+	}
+	return payees[0], nil
+}
+
+// DeletePayee removes a payee; its transactions keep their descriptions but
+// lose the link.
+func (s *Store) DeletePayee(ctx context.Context, id int64, userID *int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPayeeTx(ctx, tx, id, userID); err != nil {
+		return err
+	}
+	if err := repointPayeeTx(ctx, tx, userID, id, nil); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM payees WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MergePayees folds source into target: source's transactions and aliases
+// move over, its name becomes an exact alias of target, and source is
+// deleted.
+func (s *Store) MergePayees(ctx context.Context, targetID, sourceID int64, userID *int64) (Payee, error) {
+	if targetID == sourceID {
+		return Payee{}, invalidf("cannot merge a payee into itself")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Payee{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPayeeTx(ctx, tx, targetID, userID); err != nil {
+		return Payee{}, err
+	}
+	source, err := lockPayeeTx(ctx, tx, sourceID, userID)
+	if err != nil {
+		return Payee{}, err
+	}
+	if err := repointPayeeTx(ctx, tx, userID, sourceID, &targetID); err != nil {
+		return Payee{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payee_aliases (payee_id, pattern, match, created_at)
+		SELECT $1::INTEGER, pattern, match, NOW() FROM payee_aliases WHERE payee_id = $2
+		UNION
+		SELECT $1::INTEGER, $3::TEXT, $4::TEXT, NOW()
+		ON CONFLICT DO NOTHING;
+	`, targetID, sourceID, normalizePayeeKey(source.Name), PayeeMatchExact); err != nil {
+		return Payee{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM payees WHERE id = $1`, sourceID); err != nil {
+		return Payee{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE payees SET updated_at = NOW() WHERE id = $1`, targetID); err != nil {
+		return Payee{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Payee{}, err
+	}
+	return s.getPayee(ctx, targetID)
+}
+
+func (s *Store) getPayee(ctx context.Context, id int64) (Payee, error) {
+	var p Payee
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, created_at, updated_at,
+			(SELECT COUNT(*) FROM transacts WHERE payee_id = $1 AND deleted_at IS NULL)
+		FROM payees
+		WHERE id = $1;
+	`, id).Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt, &p.TransactionCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Payee{}, ErrNotFound
+	}
+	if err != nil {
+		return Payee{}, err
+	}
+	payees := []Payee{p}
+	if err := loadPayeeAliases(ctx, s.db, payees); err != nil {
+		return Payee{}, err
+	}
+	return payees[0], nil
+}
+
+func lockPayeeTx(ctx context.Context, tx *sql.Tx, id int64, userID *int64) (Payee, error) {
+	var p Payee
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, name, created_at, updated_at
+		FROM payees
+		WHERE id = $1 AND COALESCE(user_id, 0) = COALESCE($2::INTEGER, 0)
+		FOR UPDATE;
+	`, id, userID).Scan(&p.ID, &p.Name, &p.CreatedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Payee{}, ErrNotFound
+	}
+	return p, err
+}
+
+// repointPayeeTx moves every transaction, trashed ones included, from one
+// payee to another (or to none) and records the change in each budget's
+// history.
+func repointPayeeTx(ctx context.Context, tx *sql.Tx, userID *int64, fromID int64, toID *int64) error {
+	before, err := queryTransactionsTx(ctx, tx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE payee_id = $1
+		ORDER BY id
+		FOR UPDATE;
+	`, fromID)
+	if err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+	if err := loadTransactionDetails(ctx, tx, before); err != nil {
+		return err
+	}
+	after, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET payee_id = $1, updated_at = NOW()
+		WHERE payee_id = $2
+		RETURNING `+transactionColumns+`;
+	`, toID, fromID)
+	if err != nil {
+		return err
+	}
+	if err := loadTransactionDetails(ctx, tx, after); err != nil {
+		return err
+	}
+	return auditTransactionPairsTx(ctx, tx, userID, AuditUpdate, before, after)
+}
+
+func insertPayeeAliasesTx(ctx context.Context, tx *sql.Tx, payeeID int64, aliases []PayeeAlias) error {
+	for _, a := range aliases {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO payee_aliases (payee_id, pattern, match, created_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT DO NOTHING;
+		`, payeeID, a.Pattern, a.Match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadPayeeAliases(ctx context.Context, q queryer, payees []Payee) error {
+	if len(payees) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(payees))
+	index := make(map[int64]int, len(payees))
+	for i := range payees {
+		ids[i] = payees[i].ID
+		index[payees[i].ID] = i
+		payees[i].Aliases = []PayeeAlias{}
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT payee_id, pattern, match
+		FROM payee_aliases
+		WHERE payee_id = ANY($1)
+		ORDER BY pattern, match;
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var a PayeeAlias
+		if err := rows.Scan(&id, &a.Pattern, &a.Match); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			payees[i].Aliases = append(payees[i].Aliases, a)
+		}
+	}
+	return rows.Err()
+}
+
+// resolvePayeeTx finds the user's payee for text: an exact name or alias
+// match wins, then the longest matching prefix alias. With create set, an
+// unmatched text becomes a new payee. It returns nil when text is blank or
+// nothing matches.
+func resolvePayeeTx(ctx context.Context, tx *sql.Tx, userID *int64, text string, create bool) (*int64, string, error) {
+	key := normalizePayeeKey(text)
+	if key == "" {
+		return nil, "", nil
+	}
+	var id int64
+	var name string
+	err := tx.QueryRowContext(ctx, `
+		SELECT p.id, p.name
+		FROM (
+			SELECT id AS payee_id, 2 AS rank, LENGTH(name_key) AS len
+			FROM payees
+			WHERE COALESCE(user_id, 0) = COALESCE($1::INTEGER, 0) AND name_key = $2::TEXT
+			UNION ALL
+			SELECT a.payee_id, CASE WHEN a.match = 'exact' THEN 2 ELSE 1 END, LENGTH(a.pattern)
+			FROM payee_aliases a
+			JOIN payees p ON p.id = a.payee_id
+			WHERE COALESCE(p.user_id, 0) = COALESCE($1::INTEGER, 0)
+				AND ((a.match = 'exact' AND a.pattern = $2) OR (a.match = 'prefix' AND $2 LIKE a.pattern || '%'))
+		) m
+		JOIN payees p ON p.id = m.payee_id
+		ORDER BY m.rank DESC, m.len DESC, p.id
+		LIMIT 1;
+	`, userID, key).Scan(&id, &name)
+	if err == nil {
+		return &id, name, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, "", err
+	}
+	if !create {
+		return nil, "", nil
+	}
+
+	name, key, err = cleanPayeeName(text)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payees (user_id, name, name_key, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT DO NOTHING;
+	`, userID, name, key); err != nil {
+		return nil, "", err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id, name FROM payees
+		WHERE COALESCE(user_id, 0) = COALESCE($1::INTEGER, 0) AND name_key = $2;
+	`, userID, key).Scan(&id, &name); err != nil {
+		return nil, "", err
+	}
+	return &id, name, nil
+}
+
+// loadTransactionPayees fills in Payee for transactions linked to one.
+func loadTransactionPayees(ctx context.Context, q queryer, txns []Transaction) error {
+	var ids []int64
+	for _, t := range txns {
+		if t.PayeeID != nil {
+			ids = append(ids, *t.PayeeID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx, `SELECT id, name FROM payees WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	names := make(map[int64]string, len(ids))
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range txns {
+		if txns[i].PayeeID != nil {
+			txns[i].Payee = names[*txns[i].PayeeID]
+		}
+	}
+	return nil
+}
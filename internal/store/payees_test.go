@@ -0,0 +1,40 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePayeeKey(t *testing.T) {
+	cases := map[string]string{
+		"Costco":                "costco",
+		"COSTCO WHOLESALE #123": "costco wholesale 123",
+		"  costco  ":            "costco",
+		"Trader Joe's":          "trader joe s",
+		"---":                   "",
+	}
+	for in, want := range cases {
+		if got := normalizePayeeKey(in); got != want {
+			t.Fatalf("normalizePayeeKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCleanPayeeAliases(t *testing.T) {
+	got, err := cleanPayeeAliases([]PayeeAlias{
+		{Pattern: "COSTCO WHSE"},
+		{Pattern: "costco whse", Match: PayeeMatchExact},
+		{Pattern: "Costco", Match: PayeeMatchPrefix},
+	})
+	if err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+	want := []PayeeAlias{{Pattern: "costco whse", Match: PayeeMatchExact}, {Pattern: "costco", Match: PayeeMatchPrefix}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := cleanPayeeAliases([]PayeeAlias{{Pattern: "costco", Match: "regex"}}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
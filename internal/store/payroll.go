@@ -0,0 +1,450 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Payroll run triggers. Manual runs cover the budgets of the user who started
+// them; admin runs cover every budget.
+const (
+	PayrollTriggerScheduler = "scheduler"
+	PayrollTriggerManual    = "manual"
+	PayrollTriggerAdmin     = "admin"
+	PayrollTriggerBudget    = "budget"
+)
+
+// Payroll run statuses. A partial run credited some budgets while others
+// failed; a failed run credited nothing.
+const (
+	PayrollRunSucceeded = "succeeded"
+	PayrollRunPartial   = "partial"
+	PayrollRunFailed    = "failed"
+)
+
+// Payroll credit statuses. A skipped period was marked paid without a credit
+// because of a skip or pause override.
+const (
+	PayrollCreditCredited = "credited"
+	PayrollCreditSkipped  = "skipped"
+	PayrollCreditFailed   = "failed"
+)
+
+// PayrollCredit is one budget's result in a payroll run: a credited or
+// skipped pay period with the override that applied to it and the rollover
+// and auto-balance moves made just before it, or the error that rolled the
+// budget back. Unfunded is the deficit auto-balance couldn't cover without
+// taking a source below its floor.
+type PayrollCredit struct {
+	BudgetID   int64  `json:"budget_id"`
+	BudgetName string `json:"budget_name"`
+	Period     *Date  `json:"period,omitempty"`
+	Amount     Cents  `json:"amount"`
+	// ProratedFrom is the full payroll when Amount was prorated.
+	ProratedFrom Cents            `json:"prorated_from,omitempty"`
+	Status       string           `json:"status"`
+	Credit       *Transaction     `json:"credit,omitempty"`
+	Override     *PayrollOverride `json:"override,omitempty"`
+	Rollover     []Transaction    `json:"rollover,omitempty"`
+	AutoBalance  []Transaction    `json:"auto_balance,omitempty"`
+	Unfunded     Cents            `json:"unfunded,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// PayrollRun is one execution of the payroll engine. AsOf is the moment the
+// run evaluated schedules at; BudgetID is set for single-budget runs.
+type PayrollRun struct {
+	ID          int64           `json:"id"`
+	Trigger     string          `json:"trigger"`
+	UserID      *int64          `json:"user_id,omitempty"`
+	BudgetID    *int64          `json:"budget_id,omitempty"`
+	AsOf        time.Time       `json:"as_of"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	CreditCount int             `json:"credit_count"`
+	Total       Cents           `json:"total"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Budgets     []PayrollCredit `json:"budgets"`
+}
+
+// PayrollRunQuery pages payroll runs, newest first. BudgetID keeps runs that
+// touched that budget; From and To bound started_at.
+type PayrollRunQuery struct {
+	Limit    int
+	Offset   int
+	BudgetID *int64
+	From     *time.Time
+	To       *time.Time
+}
+
+// executePayrollRun runs the payroll engine over scope and records the run.
+// Scheduler runs with nothing to do aren't recorded, nor are scheduler
+// failures that repeat the last scheduler run. When the run can't complete, a
+// failed run carrying the error is recorded instead.
+func (s *Store) executePayrollRun(ctx context.Context, run PayrollRun, scope payrollScope, force bool) (PayrollRun, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return s.recordFailedPayrollRun(ctx, run, fmt.Errorf("begin tx: %w", err))
+	}
+	defer tx.Rollback()
+
+	credits, err := payrollTx(ctx, tx, run.UserID, clockAt(run.AsOf), scope, force)
+	if err != nil {
+		tx.Rollback()
+		return s.recordFailedPayrollRun(ctx, run, err)
+	}
+	run.Budgets = credits
+	summarizePayrollRun(&run)
+	if run.Trigger == PayrollTriggerScheduler && len(credits) == 0 {
+		return run, tx.Commit()
+	}
+	repeat, err := repeatsSchedulerFailure(ctx, tx, run)
+	if err != nil {
+		tx.Rollback()
+		return s.recordFailedPayrollRun(ctx, run, err)
+	}
+	if repeat {
+		return run, tx.Commit()
+	}
+	if err := insertPayrollRunTx(ctx, tx, &run); err != nil {
+		tx.Rollback()
+		return s.recordFailedPayrollRun(ctx, run, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return s.recordFailedPayrollRun(ctx, run, fmt.Errorf("commit: %w", err))
+	}
+	return run, nil
+}
+
+// summarizePayrollRun fills in the run's status, error and totals from its
+// budgets.
+func summarizePayrollRun(run *PayrollRun) {
+	run.CreditCount, run.Total = 0, 0
+	var failures []string
+	for _, c := range run.Budgets {
+		if c.Status == PayrollCreditFailed {
+			failures = append(failures, fmt.Sprintf("budget %d: %s", c.BudgetID, c.Error))
+			continue
+		}
+		if c.Status != PayrollCreditCredited {
+			continue
+		}
+		run.CreditCount++
+		run.Total += c.Amount
+	}
+	switch {
+	case len(failures) == 0:
+		run.Status = PayrollRunSucceeded
+	case run.CreditCount > 0:
+		run.Status = PayrollRunPartial
+	default:
+		run.Status = PayrollRunFailed
+	}
+	run.Error = strings.Join(failures, "; ")
+}
+
+// recordFailedPayrollRun records a run that couldn't complete and returns the
+// original error. Recording outlives ctx's cancellation so timeouts are
+// recorded too; if it fails as well, only the original error is reported.
+func (s *Store) recordFailedPayrollRun(ctx context.Context, run PayrollRun, cause error) (PayrollRun, error) {
+	run.Status, run.Error = PayrollRunFailed, cause.Error()
+	run.CreditCount, run.Total, run.Budgets = 0, 0, nil
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if repeat, err := repeatsSchedulerFailure(recordCtx, s.db, run); err != nil || repeat {
+		return run, cause
+	}
+	_ = insertPayrollRunTx(recordCtx, s.db, &run)
+	return run, cause
+}
+
+// repeatsSchedulerFailure reports whether run is a scheduler run that failed
+// for every budget with the same error as the last recorded scheduler run.
+// The scheduler retries a failing budget until it succeeds, and recording
+// each identical retry would bury the rest of the run history.
+func repeatsSchedulerFailure(ctx context.Context, q queryer, run PayrollRun) (bool, error) {
+	if run.Trigger != PayrollTriggerScheduler || run.Status != PayrollRunFailed {
+		return false, nil
+	}
+	for _, c := range run.Budgets {
+		if c.Status != PayrollCreditFailed {
+			return false, nil
+		}
+	}
+	var status, lastErr string
+	err := q.QueryRowContext(ctx, `
+		SELECT status, error
+		FROM payroll_runs
+		WHERE triggered_by = $1
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1;
+	`, PayrollTriggerScheduler).Scan(&status, &lastErr)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("select last scheduler run: %w", err)
+	}
+	return status == run.Status && lastErr == run.Error, nil
+}
+
+func insertPayrollRunTx(ctx context.Context, q queryer, run *PayrollRun) error {
+	if err := q.QueryRowContext(ctx, `
+		INSERT INTO payroll_runs (triggered_by, user_id, budget_id, as_of, status, error, credit_count, total_cents, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING id, started_at, finished_at;
+	`, run.Trigger, run.UserID, run.BudgetID, run.AsOf, run.Status, run.Error, run.CreditCount, run.Total).Scan(&run.ID, &run.StartedAt, &run.FinishedAt); err != nil {
+		return fmt.Errorf("insert payroll run: %w", err)
+	}
+	for _, c := range run.Budgets {
+		var credit, override, rollover, moves *string
+		var err error
+		if c.Credit != nil {
+			if credit, err = auditJSON(c.Credit); err != nil {
+				return err
+			}
+		}
+		if c.Override != nil {
+			if override, err = auditJSON(c.Override); err != nil {
+				return err
+			}
+		}
+		if len(c.Rollover) > 0 {
+			if rollover, err = auditJSON(c.Rollover); err != nil {
+				return err
+			}
+		}
+		if len(c.AutoBalance) > 0 {
+			if moves, err = auditJSON(c.AutoBalance); err != nil {
+				return err
+			}
+		}
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO payroll_run_budgets (run_id, budget_id, budget_name, period, amount_cents, prorated_from_cents, status, credit, override, rollover, auto_balance, unfunded_cents, error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::JSONB, $9::JSONB, $10::JSONB, $11::JSONB, $12, $13)
+		`, run.ID, c.BudgetID, c.BudgetName, c.Period, c.Amount, c.ProratedFrom, c.Status, credit, override, rollover, moves, c.Unfunded, c.Error); err != nil {
+			return fmt.Errorf("insert payroll run budget: %w", err)
+		}
+	}
+	return nil
+}
+
+const payrollRunColumns = `r.id, r.triggered_by, r.user_id, r.budget_id, r.as_of, r.status, r.error, r.credit_count, r.total_cents, r.started_at, r.finished_at`
+
+func scanPayrollRun(row rowScanner) (PayrollRun, error) {
+	var r PayrollRun
+	err := row.Scan(&r.ID, &r.Trigger, &r.UserID, &r.BudgetID, &r.AsOf, &r.Status, &r.Error, &r.CreditCount, &r.Total, &r.StartedAt, &r.FinishedAt)
+	return r, err
+}
+
+// payrollRunVisible limits runs to those a user started or that touched one
+// of their budgets; $1 is the user id.
+const payrollRunVisible = `(r.user_id = $1
+	OR r.budget_id IN (SELECT budget_id FROM users_budgets WHERE user_id = $1)
+	OR EXISTS (
+		SELECT 1 FROM payroll_run_budgets i
+		JOIN users_budgets ub ON ub.budget_id = i.budget_id
+		WHERE i.run_id = r.id AND ub.user_id = $1
+	))`
+
+// ListPayrollRuns returns payroll runs, newest first, with each run's budget
+// results. A user only sees runs they started or that touched their budgets,
+// and only their own budgets' results within them.
+func (s *Store) ListPayrollRuns(ctx context.Context, userID *int64, query PayrollRunQuery) ([]PayrollRun, error) {
+	if query.BudgetID != nil {
+		if err := s.ensureBudgetAccess(ctx, *query.BudgetID, userID); err != nil {
+			return nil, err
+		}
+	}
+	limit, offset := query.Limit, query.Offset
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var args []any
+	where := "TRUE"
+	add := func(clause string, value any) {
+		args = append(args, value)
+		where += fmt.Sprintf(" AND "+clause, len(args))
+	}
+	if userID != nil {
+		args = append(args, *userID)
+		where += " AND " + payrollRunVisible
+	}
+	if query.BudgetID != nil {
+		add("(r.budget_id = $%[1]d OR EXISTS (SELECT 1 FROM payroll_run_budgets i WHERE i.run_id = r.id AND i.budget_id = $%[1]d))", *query.BudgetID)
+	}
+	if query.From != nil {
+		add("r.started_at >= $%d", *query.From)
+	}
+	if query.To != nil {
+		add("r.started_at < $%d", *query.To)
+	}
+	args = append(args, limit, offset)
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM payroll_runs r
+		WHERE %s
+		ORDER BY r.started_at DESC, r.id DESC
+		LIMIT $%d OFFSET $%d;
+	`, payrollRunColumns, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	var runs []PayrollRun
+	for rows.Next() {
+		r, err := scanPayrollRun(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadPayrollRunBudgets(ctx, s.db, runs, userID, query.BudgetID); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetPayrollRun returns one payroll run with its budget results.
+func (s *Store) GetPayrollRun(ctx context.Context, id int64, userID *int64) (PayrollRun, error) {
+	args := []any{id}
+	where := "r.id = $1"
+	if userID != nil {
+		args = []any{*userID, id}
+		where = payrollRunVisible + " AND r.id = $2"
+	}
+	r, err := scanPayrollRun(s.db.QueryRowContext(ctx, `
+		SELECT `+payrollRunColumns+`
+		FROM payroll_runs r
+		WHERE `+where+`;
+	`, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PayrollRun{}, ErrNotFound
+	}
+	if err != nil {
+		return PayrollRun{}, err
+	}
+	runs := []PayrollRun{r}
+	if err := loadPayrollRunBudgets(ctx, s.db, runs, userID, nil); err != nil {
+		return PayrollRun{}, err
+	}
+	return runs[0], nil
+}
+
+// loadPayrollRunBudgets attaches budget results to runs, keeping only the
+// user's budgets and, when budgetID is set, only that budget.
+func loadPayrollRunBudgets(ctx context.Context, q queryer, runs []PayrollRun, userID, budgetID *int64) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(runs))
+	index := make(map[int64]int, len(runs))
+	for i, r := range runs {
+		ids[i] = r.ID
+		index[r.ID] = i
+		runs[i].Budgets = []PayrollCredit{}
+	}
+	query := `
+		SELECT i.run_id, i.budget_id, i.budget_name, i.period, i.amount_cents, i.prorated_from_cents, i.status, i.credit, i.override, i.rollover, i.auto_balance, i.unfunded_cents, i.error
+		FROM payroll_run_budgets i
+		WHERE i.run_id = ANY($1)`
+	args := []any{ids}
+	if userID != nil {
+		args = append(args, *userID)
+		query += " AND i.budget_id IN (SELECT budget_id FROM users_budgets WHERE user_id = $2)"
+	}
+	if budgetID != nil {
+		args = append(args, *budgetID)
+		query += fmt.Sprintf(" AND i.budget_id = $%d", len(args))
+	}
+	rows, err := q.QueryContext(ctx, query+" ORDER BY i.run_id, i.id;", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var runID int64
+		var c PayrollCredit
+		var credit, override, rollover, moves []byte
+		if err := rows.Scan(&runID, &c.BudgetID, &c.BudgetName, &c.Period, &c.Amount, &c.ProratedFrom, &c.Status, &credit, &override, &rollover, &moves, &c.Unfunded, &c.Error); err != nil {
+			return err
+		}
+		if len(credit) > 0 {
+			c.Credit = &Transaction{}
+			if err := json.Unmarshal(credit, c.Credit); err != nil {
+				return fmt.Errorf("decode payroll credit: %w", err)
+			}
+		}
+		if len(override) > 0 {
+			c.Override = &PayrollOverride{}
+			if err := json.Unmarshal(override, c.Override); err != nil {
+				return fmt.Errorf("decode payroll override: %w", err)
+			}
+		}
+		if len(rollover) > 0 {
+			if err := json.Unmarshal(rollover, &c.Rollover); err != nil {
+				return fmt.Errorf("decode rollover moves: %w", err)
+			}
+		}
+		if len(moves) > 0 {
+			if err := json.Unmarshal(moves, &c.AutoBalance); err != nil {
+				return fmt.Errorf("decode auto-balance moves: %w", err)
+			}
+		}
+		i := index[runID]
+		runs[i].Budgets = append(runs[i].Budgets, c)
+	}
+	return rows.Err()
+}
+
+// PreviewPayroll runs the payroll engine inside a transaction that is always
+// rolled back, and returns the results it would produce for the user's
+// budgets. Each budget is evaluated on day in its own time zone, or now when
+// day is nil. The planned transactions have no IDs.
+func (s *Store) PreviewPayroll(ctx context.Context, userID *int64, day *Date) ([]PayrollCredit, error) {
+	clock := clockAt(time.Now())
+	if day != nil {
+		clock = clockOn(*day)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	credits, err := payrollTx(ctx, tx, userID, clock, payrollScope{memberID: userID}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]PayrollCredit, 0, len(credits))
+	for _, c := range credits {
+		if c.Credit != nil {
+			c.Credit.ID = 0
+		}
+		for i := range c.Rollover {
+			c.Rollover[i].ID = 0
+		}
+		for i := range c.AutoBalance {
+			c.AutoBalance[i].ID = 0
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import "testing"
+
+func TestSummarizePayrollRun(t *testing.T) {
+	run := PayrollRun{Budgets: []PayrollCredit{
+		{BudgetID: 1, Amount: 1000, Status: PayrollCreditCredited},
+		{BudgetID: 1, Amount: 1000, Status: PayrollCreditCredited},
+		{BudgetID: 2, Amount: 500, Status: PayrollCreditFailed, Error: "boom"},
+	}}
+	summarizePayrollRun(&run)
+	if run.Status != PayrollRunPartial || run.CreditCount != 2 || run.Total != 2000 || run.Error != "budget 2: boom" {
+		t.Fatalf("unexpected summary: %+v", run)
+	}
+
+	run.Budgets = run.Budgets[2:]
+	summarizePayrollRun(&run)
+	if run.Status != PayrollRunFailed || run.CreditCount != 0 {
+		t.Fatalf("expected failed run, got %+v", run)
+	}
+
+	run.Budgets = nil
+	summarizePayrollRun(&run)
+	if run.Status != PayrollRunSucceeded || run.Error != "" {
+		t.Fatalf("expected empty run to succeed, got %+v", run)
+	}
+}
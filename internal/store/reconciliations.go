@@ -0,0 +1,351 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Reconciliation statuses.
+const (
+	ReconciliationOpen      = "open"
+	ReconciliationFinished  = "finished"
+	ReconciliationCancelled = "cancelled"
+)
+
+// Reconciliation checks a budget's cleared transactions against a bank
+// statement. While open, ClearedBalance and Difference are live; once
+// finished they are the values the session closed with.
+type Reconciliation struct {
+	ID               int64      `json:"id"`
+	BudgetID         int64      `json:"budget_id"`
+	StatementDate    Date       `json:"statement_date"`
+	StatementBalance Cents      `json:"statement_balance"`
+	Status           string     `json:"status"`
+	ClearedBalance   Cents      `json:"cleared_balance"`
+	Difference       Cents      `json:"difference"`
+	AdjustmentID     *int64     `json:"adjustment_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+const reconciliationColumns = `id, budget_id, statement_date, statement_balance_cents, status, cleared_balance_cents, adjustment_id, created_at, updated_at, finished_at`
+
+func scanReconciliation(row rowScanner) (Reconciliation, error) {
+	var r Reconciliation
+	err := row.Scan(&r.ID, &r.BudgetID, &r.StatementDate, &r.StatementBalance, &r.Status, &r.ClearedBalance, &r.AdjustmentID, &r.CreatedAt, &r.UpdatedAt, &r.FinishedAt)
+	return r, err
+}
+
+// checkReconciledEdit refuses changes to the amount, direction or date of a
+// reconciled transaction, or un-clearing it. Description, payee and tags stay
+// editable.
+func checkReconciledEdit(t Transaction, credit bool, amount Cents, occurredOn *Date, cleared *bool) error {
+	if t.ReconciliationID == nil {
+		return nil
+	}
+	if credit != t.Credit || amount != t.Amount ||
+		(occurredOn != nil && occurredOn.String() != t.OccurredOn.String()) ||
+		(cleared != nil && !*cleared) {
+		return invalidf("transaction %d is reconciled; only its description, payee and tags can change", t.ID)
+	}
+	return nil
+}
+
+func checkSplitUnreconciled(sp Split) error {
+	for _, line := range sp.Lines {
+		if line.ReconciliationID != nil {
+			return invalidf("split %d has reconciled lines and cannot change", sp.ID)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListReconciliations(ctx context.Context, budgetID int64, userID *int64) ([]Reconciliation, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+reconciliationColumns+`
+		FROM reconciliations
+		WHERE budget_id = $1
+		ORDER BY id DESC;
+	`, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	var out []Reconciliation
+	for rows.Next() {
+		r, err := scanReconciliation(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if err := fillReconciliationTotals(ctx, s.db, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetReconciliation(ctx context.Context, budgetID, id int64, userID *int64) (Reconciliation, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return Reconciliation{}, err
+	}
+	r, err := scanReconciliation(s.db.QueryRowContext(ctx, `
+		SELECT `+reconciliationColumns+`
+		FROM reconciliations
+		WHERE id = $1 AND budget_id = $2;
+	`, id, budgetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reconciliation{}, ErrNotFound
+	}
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	return r, fillReconciliationTotals(ctx, s.db, &r)
+}
+
+// StartReconciliation opens a session for a statement. A budget can only
+// have one open session.
+func (s *Store) StartReconciliation(ctx context.Context, budgetID int64, userID *int64, statementDate Date, statementBalance Cents) (Reconciliation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return Reconciliation{}, err
+	}
+	r, err := scanReconciliation(tx.QueryRowContext(ctx, `
+		INSERT INTO reconciliations (budget_id, user_id, statement_date, statement_balance_cents, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+		RETURNING `+reconciliationColumns+`;
+	`, budgetID, userID, statementDate, statementBalance, ReconciliationOpen))
+	if isUniqueViolation(err) {
+		return Reconciliation{}, invalidf("budget %d already has an open reconciliation", budgetID)
+	}
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if err := fillReconciliationTotals(ctx, tx, &r); err != nil {
+		return Reconciliation{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditReconciliation, entityID: r.ID, action: AuditCreate, after: r}); err != nil {
+		return Reconciliation{}, err
+	}
+	return r, tx.Commit()
+}
+
+// ClearTransactions marks transactions of the session's budget as cleared or
+// uncleared and returns the session with its new difference.
+func (s *Store) ClearTransactions(ctx context.Context, budgetID, id int64, userID *int64, transactionIDs []int64, cleared bool) (Reconciliation, error) {
+	if len(transactionIDs) == 0 {
+		return Reconciliation{}, invalidf("transaction_ids is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	defer tx.Rollback()
+
+	r, err := lockOpenReconciliationTx(ctx, tx, budgetID, id, userID)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	before, err := queryTransactionsTx(ctx, tx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE budget_id = $1 AND id = ANY($2) AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE;
+	`, budgetID, transactionIDs)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	found := make(map[int64]bool, len(before))
+	for _, t := range before {
+		found[t.ID] = true
+		if err := checkReconciledEdit(t, t.Credit, t.Amount, nil, &cleared); err != nil {
+			return Reconciliation{}, err
+		}
+	}
+	for _, tid := range transactionIDs {
+		if !found[tid] {
+			return Reconciliation{}, invalidf("transaction %d is not in budget %d", tid, budgetID)
+		}
+	}
+	if err := loadTransactionDetails(ctx, tx, before); err != nil {
+		return Reconciliation{}, err
+	}
+
+	after, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET cleared = $1, updated_at = NOW()
+		WHERE budget_id = $2 AND id = ANY($3) AND deleted_at IS NULL AND cleared <> $1
+		RETURNING `+transactionColumns+`;
+	`, cleared, budgetID, transactionIDs)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if err := loadTransactionDetails(ctx, tx, after); err != nil {
+		return Reconciliation{}, err
+	}
+	if err := auditTransactionPairsTx(ctx, tx, userID, AuditUpdate, before, after); err != nil {
+		return Reconciliation{}, err
+	}
+	if err := fillReconciliationTotals(ctx, tx, &r); err != nil {
+		return Reconciliation{}, err
+	}
+	return r, tx.Commit()
+}
+
+// FinishReconciliation closes a session and locks every cleared transaction
+// of the budget. A remaining difference is refused unless adjust is set, in
+// which case a cleared adjustment transaction dated on the statement is
+// posted to make up the difference.
+func (s *Store) FinishReconciliation(ctx context.Context, budgetID, id int64, userID *int64, adjust bool) (Reconciliation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOpenReconciliationTx(ctx, tx, budgetID, id, userID)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if err := fillReconciliationTotals(ctx, tx, &before); err != nil {
+		return Reconciliation{}, err
+	}
+
+	var adjustmentID *int64
+	if diff := before.Difference; diff != 0 {
+		if !adjust {
+			return Reconciliation{}, invalidf("cleared balance differs from the statement by %s; finish with adjust to post an adjustment", diff.String())
+		}
+		amount := diff
+		if amount < 0 {
+			amount = -amount
+		}
+		adj, err := scanTransaction(tx.QueryRowContext(ctx, `
+			INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, cleared, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, TRUE, NOW(), NOW())
+			RETURNING `+transactionColumns+`;
+		`, budgetID, userID, "Reconciliation adjustment", diff > 0, amount, before.StatementDate))
+		if err != nil {
+			return Reconciliation{}, err
+		}
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &adj)); err != nil {
+			return Reconciliation{}, err
+		}
+		adjustmentID = &adj.ID
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE transacts
+		SET reconciliation_id = $1, updated_at = NOW()
+		WHERE budget_id = $2 AND cleared AND reconciliation_id IS NULL AND deleted_at IS NULL
+	`, id, budgetID); err != nil {
+		return Reconciliation{}, err
+	}
+	after, err := scanReconciliation(tx.QueryRowContext(ctx, `
+		UPDATE reconciliations
+		SET status = $1, cleared_balance_cents = statement_balance_cents, adjustment_id = $2, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+		RETURNING `+reconciliationColumns+`;
+	`, ReconciliationFinished, adjustmentID, id))
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if err := fillReconciliationTotals(ctx, tx, &after); err != nil {
+		return Reconciliation{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditReconciliation, entityID: id, action: AuditUpdate, before: before, after: after}); err != nil {
+		return Reconciliation{}, err
+	}
+	return after, tx.Commit()
+}
+
+// CancelReconciliation abandons an open session. Cleared flags are kept so
+// the next session can pick up where this one stopped.
+func (s *Store) CancelReconciliation(ctx context.Context, budgetID, id int64, userID *int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOpenReconciliationTx(ctx, tx, budgetID, id, userID)
+	if err != nil {
+		return err
+	}
+	after, err := scanReconciliation(tx.QueryRowContext(ctx, `
+		UPDATE reconciliations
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+reconciliationColumns+`;
+	`, ReconciliationCancelled, id))
+	if err != nil {
+		return err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditReconciliation, entityID: id, action: AuditDelete, before: before, after: after}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockOpenReconciliationTx locks an open session of budgetID. Sessions that
+// are finished or cancelled can no longer change.
+func lockOpenReconciliationTx(ctx context.Context, tx *sql.Tx, budgetID, id int64, userID *int64) (Reconciliation, error) {
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return Reconciliation{}, err
+	}
+	r, err := scanReconciliation(tx.QueryRowContext(ctx, `
+		SELECT `+reconciliationColumns+`
+		FROM reconciliations
+		WHERE id = $1 AND budget_id = $2
+		FOR UPDATE;
+	`, id, budgetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reconciliation{}, ErrNotFound
+	}
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	if r.Status != ReconciliationOpen {
+		return Reconciliation{}, invalidf("reconciliation %d is %s", id, r.Status)
+	}
+	return r, nil
+}
+
+// fillReconciliationTotals computes the live cleared balance of an open
+// session and the difference from the statement. Cancelled sessions report
+// neither.
+func fillReconciliationTotals(ctx context.Context, q queryer, r *Reconciliation) error {
+	if r.Status == ReconciliationCancelled {
+		return nil
+	}
+	if r.Status == ReconciliationOpen {
+		if err := q.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(CASE WHEN credit THEN amount_cents ELSE -amount_cents END), 0)::BIGINT
+			FROM transacts
+			WHERE budget_id = $1 AND cleared AND deleted_at IS NULL;
+		`, r.BudgetID).Scan(&r.ClearedBalance); err != nil {
+			return err
+		}
+	}
+	r.Difference = r.StatementBalance - r.ClearedBalance
+	return nil
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReconciledEdit(t *testing.T) {
+	recID := int64(3)
+	locked := Transaction{ID: 7, Amount: 1000, OccurredOn: mustParseDate(t, "2024-03-02"), ReconciliationID: &recID}
+	yes, no := true, false
+	same := mustParseDate(t, "2024-03-02")
+	moved := mustParseDate(t, "2024-03-05")
+
+	if err := checkReconciledEdit(locked, false, 1000, &same, &yes); err != nil {
+		t.Fatalf("expected description-only edit to pass, got %v", err)
+	}
+	for name, err := range map[string]error{
+		"amount":    checkReconciledEdit(locked, false, 1200, nil, nil),
+		"direction": checkReconciledEdit(locked, true, 1000, nil, nil),
+		"date":      checkReconciledEdit(locked, false, 1000, &moved, nil),
+		"unclear":   checkReconciledEdit(locked, false, 1000, nil, &no),
+	} {
+		if !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+
+	open := Transaction{ID: 8, Amount: 1000}
+	if err := checkReconciledEdit(open, true, 5, &moved, &no); err != nil {
+		t.Fatalf("unreconciled rows are freely editable, got %v", err)
+	}
+}
+
+func mustParseDate(t *testing.T, value string) Date {
+	t.Helper()
+	d, err := ParseDate(value)
+	if err != nil {
+		t.Fatalf("parse %q: %v", value, err)
+	}
+	return d
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Rollover modes.
+const (
+	RolloverCarry = "carry"
+	RolloverReset = "reset"
+	RolloverSweep = "sweep"
+)
+
+// RolloverPolicy says what happens to a budget's balance at each payroll
+// period boundary, just before the period's credit. Carry keeps it; reset
+// takes a positive balance down to zero; sweep moves whatever exceeds Cap to
+// TargetBudgetID. A reset moves the balance to TargetBudgetID when one is
+// set and otherwise writes it off. Negative balances always carry.
+type RolloverPolicy struct {
+	Mode           string `json:"mode"`
+	Cap            Cents  `json:"cap,omitempty"`
+	TargetBudgetID *int64 `json:"target_budget_id,omitempty"`
+}
+
+// Normalize defaults the mode to carry and rejects incomplete policies.
+// budgetID is the budget the policy belongs to, which can't be its target.
+func (p RolloverPolicy) Normalize(budgetID int64) (RolloverPolicy, error) {
+	if p.Mode == "" {
+		p.Mode = RolloverCarry
+	}
+	if p.TargetBudgetID != nil && *p.TargetBudgetID == budgetID {
+		return RolloverPolicy{}, invalidf("a budget can't roll over into itself")
+	}
+	switch p.Mode {
+	case RolloverCarry:
+		if p.Cap != 0 || p.TargetBudgetID != nil {
+			return RolloverPolicy{}, invalidf("carry policies take no cap or target")
+		}
+	case RolloverReset:
+		if p.Cap != 0 {
+			return RolloverPolicy{}, invalidf("cap only applies to sweep policies")
+		}
+	case RolloverSweep:
+		if p.Cap < 0 {
+			return RolloverPolicy{}, invalidf("cap must be >= 0")
+		}
+		if p.TargetBudgetID == nil {
+			return RolloverPolicy{}, invalidf("sweep policies need a target_budget_id")
+		}
+	default:
+		return RolloverPolicy{}, invalidf("mode must be one of %s, %s or %s", RolloverCarry, RolloverReset, RolloverSweep)
+	}
+	return p, nil
+}
+
+// excess is how much of balance the policy moves out at a period boundary.
+func (p RolloverPolicy) excess(balance Cents) Cents {
+	var keep Cents
+	switch p.Mode {
+	case RolloverReset:
+		keep = 0
+	case RolloverSweep:
+		keep = p.Cap
+	default:
+		return 0
+	}
+	if balance <= keep {
+		return 0
+	}
+	return balance - keep
+}
+
+// UpdateRolloverPolicy replaces a budget's rollover policy. The user needs
+// access to the target budget too.
+func (s *Store) UpdateRolloverPolicy(ctx context.Context, budgetID int64, userID *int64, policy RolloverPolicy) (Budget, error) {
+	policy, err := policy.Normalize(budgetID)
+	if err != nil {
+		return Budget{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return Budget{}, err
+	}
+	if policy.TargetBudgetID != nil {
+		if err := ensureBudgetAccessTx(ctx, tx, *policy.TargetBudgetID, userID); err != nil {
+			return Budget{}, err
+		}
+	}
+	before, err := lockBudgetRowTx(ctx, tx, budgetID)
+	if err != nil {
+		return Budget{}, err
+	}
+	after, err := scanBudgetRow(tx.QueryRowContext(ctx, `
+		UPDATE budgets
+		SET rollover_policy = $1, rollover_cap_cents = $2, rollover_target_id = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING `+budgetColumns+`;
+	`, policy.Mode, policy.Cap, policy.TargetBudgetID, budgetID))
+	if err != nil {
+		return Budget{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditBudget, entityID: budgetID, action: AuditUpdate, before: before, after: after}); err != nil {
+		return Budget{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Budget{}, err
+	}
+	return s.GetBudget(ctx, budgetID, userID)
+}
+
+// applyRolloverTx applies a budget's rollover policy at the period boundary
+// payDate and returns the transactions it wrote: a transfer's two legs when
+// the excess moves to a target budget, or a single debit when it's written
+// off. A policy whose target is in the trash carries until it's restored,
+// as does a sweep whose target was purged.
+func applyRolloverTx(ctx context.Context, tx *sql.Tx, userID *int64, pb payrollBudget, payDate Date) ([]Transaction, error) {
+	balance, err := budgetBalanceTx(ctx, tx, pb.id)
+	if err != nil {
+		return nil, err
+	}
+	amount := pb.rollover.excess(balance)
+	if amount <= 0 {
+		return nil, nil
+	}
+	if pb.rollover.Mode == RolloverSweep && pb.rollover.TargetBudgetID == nil {
+		// The target was purged; carry rather than write the surplus off.
+		return nil, nil
+	}
+	description := fmt.Sprintf("Rollover %s", payDate.Format("January 2, 2006"))
+	insert := `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, transfer_id, created_at, updated_at)
+		VALUES ($1, NULL, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING ` + transactionColumns + `;
+	`
+
+	var transferID *int64
+	if target := pb.rollover.TargetBudgetID; target != nil {
+		if err := ensureBudgetAccessTx(ctx, tx, *target, nil); errors.Is(err, ErrNotFound) {
+			// The target is in the trash.
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("rollover target %d: %w", *target, err)
+		}
+		var id int64
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO transfers (from_budget_id, to_budget_id, user_id, created_at, updated_at)
+			VALUES ($1, $2, NULL, NOW(), NOW())
+			RETURNING id;
+		`, pb.id, *target).Scan(&id); err != nil {
+			return nil, fmt.Errorf("insert rollover transfer: %w", err)
+		}
+		transferID = &id
+	}
+
+	debit, err := scanTransaction(tx.QueryRowContext(ctx, insert, pb.id, description, false, amount, payDate, transferID))
+	if err != nil {
+		return nil, fmt.Errorf("insert rollover debit: %w", err)
+	}
+	moves := []Transaction{debit}
+	if transferID != nil {
+		credit, err := scanTransaction(tx.QueryRowContext(ctx, insert, *pb.rollover.TargetBudgetID, fmt.Sprintf("%s from %s", description, pb.name), true, amount, payDate, transferID))
+		if err != nil {
+			return nil, fmt.Errorf("insert rollover credit: %w", err)
+		}
+		moves = append(moves, credit)
+	}
+	for i := range moves {
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &moves[i])); err != nil {
+			return nil, err
+		}
+	}
+	return moves, nil
+}
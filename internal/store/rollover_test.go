@@ -0,0 +1,46 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRolloverPolicy(t *testing.T) {
+	savings := int64(2)
+	p, err := RolloverPolicy{}.Normalize(1)
+	if err != nil || p.Mode != RolloverCarry {
+		t.Fatalf("expected carry default, got %+v, %v", p, err)
+	}
+	invalid := []RolloverPolicy{
+		{Mode: "monthly"},
+		{Mode: RolloverCarry, Cap: 100},
+		{Mode: RolloverReset, Cap: 100},
+		{Mode: RolloverSweep, Cap: 100},
+		{Mode: RolloverSweep, Cap: -1, TargetBudgetID: &savings},
+	}
+	for _, p := range invalid {
+		if _, err := p.Normalize(1); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("expected %+v to be invalid, got %v", p, err)
+		}
+	}
+	if _, err := (RolloverPolicy{Mode: RolloverReset, TargetBudgetID: &savings}).Normalize(2); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected rolling over into itself to be invalid, got %v", err)
+	}
+
+	cases := []struct {
+		policy  RolloverPolicy
+		balance Cents
+		want    Cents
+	}{
+		{RolloverPolicy{Mode: RolloverCarry}, 5000, 0},
+		{RolloverPolicy{Mode: RolloverReset}, 5000, 5000},
+		{RolloverPolicy{Mode: RolloverReset}, -5000, 0},
+		{RolloverPolicy{Mode: RolloverSweep, Cap: 2000, TargetBudgetID: &savings}, 5000, 3000},
+		{RolloverPolicy{Mode: RolloverSweep, Cap: 2000, TargetBudgetID: &savings}, 1500, 0},
+	}
+	for _, tc := range cases {
+		if got := tc.policy.excess(tc.balance); got != tc.want {
+			t.Fatalf("%s with balance %s: expected %s, got %s", tc.policy.Mode, tc.balance, tc.want, got)
+		}
+	}
+}
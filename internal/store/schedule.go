@@ -0,0 +1,469 @@
+package store
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payroll frequencies.
+const (
+	PayMonthly     = "monthly"
+	PaySemimonthly = "semimonthly"
+	PayWeekly      = "weekly"
+	PayBiweekly    = "biweekly"
+	PayCustom      = "custom"
+)
+
+// Business-day rules move a pay date that falls on a weekend or holiday to
+// the business day before or after it.
+const (
+	BusinessDayPrevious = "previous"
+	BusinessDayNext     = "next"
+)
+
+// maxBusinessDayShift bounds how far a business-day rule moves a pay date.
+const maxBusinessDayShift = 14
+
+// PayrollSchedule says when a budget's payroll is due. Monthly and
+// semimonthly schedules pay on Days of the month (clamped to the month's last
+// day); weekly, biweekly and custom schedules pay every 7, 14 or IntervalDays
+// days counting from Anchor. For the day-of-month kinds Anchor is optional and
+// only marks the first date the schedule applies from. Pay dates start at
+// midnight in TimeZone, an IANA zone name; empty means the server's zone.
+// BusinessDay posts each pay date's credit on the previous or next business
+// day instead; the period is still named after the pay date. Prorate scales
+// a budget's first credit to the part of the period after it was created.
+type PayrollSchedule struct {
+	Frequency    string `json:"frequency"`
+	Anchor       *Date  `json:"anchor,omitempty"`
+	Days         []int  `json:"days,omitempty"`
+	IntervalDays int    `json:"interval_days,omitempty"`
+	TimeZone     string `json:"time_zone,omitempty"`
+	BusinessDay  string `json:"business_day,omitempty"`
+	Prorate      bool   `json:"prorate,omitempty"`
+}
+
+// DefaultPayrollSchedule pays on the first of every month.
+func DefaultPayrollSchedule() PayrollSchedule {
+	return PayrollSchedule{Frequency: PayMonthly, Days: []int{1}}
+}
+
+// Normalize fills in defaults, sorts and de-duplicates Days, and rejects
+// schedules that can't produce pay dates.
+func (s PayrollSchedule) Normalize() (PayrollSchedule, error) {
+	if s.Frequency == "" {
+		s.Frequency = PayMonthly
+	}
+	s.TimeZone = strings.TrimSpace(s.TimeZone)
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return PayrollSchedule{}, invalidf("unknown time zone %q", s.TimeZone)
+		}
+	}
+	switch s.BusinessDay = strings.TrimSpace(s.BusinessDay); s.BusinessDay {
+	case "", BusinessDayPrevious, BusinessDayNext:
+	default:
+		return PayrollSchedule{}, invalidf("business_day must be %s, %s or empty", BusinessDayPrevious, BusinessDayNext)
+	}
+	days := make([]int, 0, len(s.Days))
+	seen := make(map[int]bool, len(s.Days))
+	for _, d := range s.Days {
+		if d < 1 || d > 31 {
+			return PayrollSchedule{}, invalidf("days must be between 1 and 31")
+		}
+		if !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+	sort.Ints(days)
+	s.Days = days
+
+	switch s.Frequency {
+	case PayMonthly, PaySemimonthly:
+		if s.IntervalDays != 0 {
+			return PayrollSchedule{}, invalidf("interval_days only applies to custom schedules")
+		}
+		if len(s.Days) == 0 {
+			s.Days = []int{1}
+			if s.Frequency == PaySemimonthly {
+				s.Days = []int{1, 15}
+			}
+		}
+		if s.Frequency == PaySemimonthly && len(s.Days) != 2 {
+			return PayrollSchedule{}, invalidf("semimonthly schedules pay on exactly two days")
+		}
+	case PayWeekly, PayBiweekly, PayCustom:
+		if len(s.Days) != 0 {
+			return PayrollSchedule{}, invalidf("days only apply to monthly and semimonthly schedules")
+		}
+		if s.Anchor == nil {
+			return PayrollSchedule{}, invalidf("%s schedules need an anchor date", s.Frequency)
+		}
+		switch s.Frequency {
+		case PayWeekly:
+			s.IntervalDays = 7
+		case PayBiweekly:
+			s.IntervalDays = 14
+		default:
+			if s.IntervalDays < 1 || s.IntervalDays > 366 {
+				return PayrollSchedule{}, invalidf("interval_days must be between 1 and 366")
+			}
+		}
+	default:
+		return PayrollSchedule{}, invalidf("frequency must be one of %s, %s, %s, %s or %s", PayMonthly, PaySemimonthly, PayWeekly, PayBiweekly, PayCustom)
+	}
+	return s, nil
+}
+
+// UpdatePayrollSchedule replaces a budget's payroll schedule. The new
+// schedule only pays dates after the budget's last credited pay date.
+func (s *Store) UpdatePayrollSchedule(ctx context.Context, budgetID int64, userID *int64, sched PayrollSchedule) (Budget, error) {
+	sched, err := sched.Normalize()
+	if err != nil {
+		return Budget{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return Budget{}, err
+	}
+	before, err := lockBudgetRowTx(ctx, tx, budgetID)
+	if err != nil {
+		return Budget{}, err
+	}
+	after, err := scanBudgetRow(tx.QueryRowContext(ctx, `
+		UPDATE budgets
+		SET payroll_frequency = $1, payroll_anchor = $2, payroll_days = $3, payroll_interval_days = $4, payroll_time_zone = $5,
+			payroll_business_day = $6, payroll_prorate = $7, updated_at = NOW()
+		WHERE id = $8
+		RETURNING `+budgetColumns+`;
+	`, sched.Frequency, sched.Anchor, dayList(sched.Days), sched.IntervalDays, sched.TimeZone, sched.BusinessDay, sched.Prorate, budgetID))
+	if err != nil {
+		return Budget{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditBudget, entityID: budgetID, action: AuditUpdate, before: before, after: after}); err != nil {
+		return Budget{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Budget{}, err
+	}
+	return s.GetBudget(ctx, budgetID, userID)
+}
+
+// NextPayrollDue returns the earliest moment after now at which RunPayroll
+// or PostScheduledIncomes has work to do, or ok=false when no live budget has
+// a payroll and no income is auto-posted.
+func (s *Store) NextPayrollDue(ctx context.Context, now time.Time) (next time.Time, ok bool, err error) {
+	holidays, err := loadHolidaysTx(ctx, s.db)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+payrollBudgetColumns+`
+		FROM budgets
+		WHERE `+payrollActive+` AND deleted_at IS NULL;
+	`)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		pb, err := scanPayrollBudget(rows)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		pb.holidays = holidays
+		local := now.In(pb.schedule.Location())
+		due := pb.schedule.nextDue(local, holidays)
+		if len(pb.pendingPeriods(local)) > 0 {
+			due = now
+		}
+		if !ok || due.Before(next) {
+			next, ok = due, true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+	rows.Close()
+
+	due, incomeOK, err := nextIncomeDue(ctx, s.db, now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if incomeOK && (!ok || due.Before(next)) {
+		next, ok = due, true
+	}
+	return next, ok, nil
+}
+
+// pendingSince lists the pay dates after paidThrough whose credit posts on
+// or before now, oldest first. now must be in the schedule's time zone.
+// Without paidThrough only the current period is due; nothing is back-paid
+// to the anchor. holidays only matter with a business-day rule.
+func (s PayrollSchedule) pendingSince(paidThrough *Date, now time.Time, holidays holidaySet) []time.Time {
+	horizon := now
+	if s.BusinessDay == BusinessDayPrevious {
+		horizon = now.AddDate(0, 0, maxBusinessDayShift)
+	}
+	last, ok := s.PeriodStart(horizon)
+	if !ok {
+		return nil
+	}
+	var first time.Time
+	if paidThrough == nil {
+		if first, ok = s.PeriodStart(now); !ok {
+			first = s.Next(now)
+		}
+	} else {
+		paid := time.Date(paidThrough.Year(), paidThrough.Month(), paidThrough.Day(), 0, 0, 0, 0, now.Location())
+		first = s.Next(paid)
+	}
+	var periods []time.Time
+	for period := first; !period.After(last); period = s.Next(period) {
+		if s.payDay(period, holidays).After(now) {
+			break
+		}
+		periods = append(periods, period)
+	}
+	return periods
+}
+
+// payDay returns the day a pay date's credit posts: the pay date itself, or
+// under a business-day rule the nearest business day before or after it.
+func (s PayrollSchedule) payDay(period time.Time, holidays holidaySet) time.Time {
+	step := 0
+	switch s.BusinessDay {
+	case BusinessDayPrevious:
+		step = -1
+	case BusinessDayNext:
+		step = 1
+	default:
+		return period
+	}
+	day := period
+	for i := 0; i < maxBusinessDayShift && !holidays.isBusinessDay(day); i++ {
+		day = day.AddDate(0, 0, step)
+	}
+	return day
+}
+
+// nextDue returns the first day after now on which a pay date's credit
+// posts. now must be in the schedule's time zone.
+func (s PayrollSchedule) nextDue(now time.Time, holidays holidaySet) time.Time {
+	from := now.AddDate(0, 0, -maxBusinessDayShift)
+	period, ok := s.PeriodStart(from)
+	if !ok {
+		period = s.Next(from)
+	}
+	for ; ; period = s.Next(period) {
+		if day := s.payDay(period, holidays); day.After(now) {
+			return day
+		}
+	}
+}
+
+// prorate scales amount to the part of the period from period to next that
+// falls on or after start, rounding to the nearest cent.
+func prorate(amount Cents, period, next, start time.Time) Cents {
+	total, left := daysBetween(period, next), daysBetween(start, next)
+	switch {
+	case total <= 0 || left >= total:
+		return amount
+	case left <= 0:
+		return 0
+	}
+	return Cents((int64(amount)*int64(left) + int64(total)/2) / int64(total))
+}
+
+// Location returns the schedule's time zone, falling back to the server's
+// zone when it's unset or no longer known.
+func (s PayrollSchedule) Location() *time.Location {
+	if s.TimeZone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// NextAfter returns the first pay date after the instant t, in the
+// schedule's time zone.
+func (s PayrollSchedule) NextAfter(t time.Time) time.Time {
+	return s.Next(t.In(s.Location()))
+}
+
+// payrollClock is the moment a payroll run evaluates a budget's schedule at,
+// given the budget's time zone.
+type payrollClock func(loc *time.Location) time.Time
+
+// clockAt evaluates every budget at the instant now.
+func clockAt(now time.Time) payrollClock {
+	return func(loc *time.Location) time.Time { return now.In(loc) }
+}
+
+// clockOn evaluates each budget on day in its own time zone.
+func clockOn(day Date) payrollClock {
+	return func(loc *time.Location) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// PeriodStart returns the latest pay date on or before t, at midnight in t's
+// location. ok is false when the schedule hasn't started yet.
+func (s PayrollSchedule) PeriodStart(t time.Time) (start time.Time, ok bool) {
+	day := midnight(t)
+	if s.Anchor != nil && day.Before(s.anchorIn(t.Location())) {
+		return time.Time{}, false
+	}
+	if s.isInterval() {
+		anchor := s.anchorIn(t.Location())
+		periods := daysBetween(anchor, day) / s.IntervalDays
+		return anchor.AddDate(0, 0, periods*s.IntervalDays), true
+	}
+
+	dates := s.monthDates(day.Year(), day.Month(), t.Location())
+	for i := len(dates) - 1; i >= 0; i-- {
+		if !dates[i].After(day) {
+			return s.notBeforeAnchor(dates[i])
+		}
+	}
+	prev := day.AddDate(0, 0, -day.Day())
+	dates = s.monthDates(prev.Year(), prev.Month(), t.Location())
+	return s.notBeforeAnchor(dates[len(dates)-1])
+}
+
+// Next returns the first pay date after t, at midnight in t's location.
+func (s PayrollSchedule) Next(t time.Time) time.Time {
+	day := midnight(t)
+	if s.Anchor != nil {
+		if anchor := s.anchorIn(t.Location()); day.Before(anchor) {
+			if s.isInterval() || s.isPayDay(anchor) {
+				return anchor
+			}
+			day = anchor
+		}
+	}
+	if s.isInterval() {
+		start, _ := s.PeriodStart(day)
+		return start.AddDate(0, 0, s.IntervalDays)
+	}
+
+	for _, d := range s.monthDates(day.Year(), day.Month(), t.Location()) {
+		if d.After(day) {
+			return d
+		}
+	}
+	next := time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	return s.monthDates(next.Year(), next.Month(), t.Location())[0]
+}
+
+func (s PayrollSchedule) isInterval() bool {
+	return s.IntervalDays > 0
+}
+
+func (s PayrollSchedule) isPayDay(day time.Time) bool {
+	for _, d := range s.monthDates(day.Year(), day.Month(), day.Location()) {
+		if d.Equal(day) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s PayrollSchedule) anchorIn(loc *time.Location) time.Time {
+	return time.Date(s.Anchor.Year(), s.Anchor.Month(), s.Anchor.Day(), 0, 0, 0, 0, loc)
+}
+
+func (s PayrollSchedule) notBeforeAnchor(day time.Time) (time.Time, bool) {
+	if s.Anchor != nil && day.Before(s.anchorIn(day.Location())) {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// monthDates lists the schedule's pay dates in a month, clamping days past
+// the end of the month to its last day. A schedule without days pays on the
+// 1st.
+func (s PayrollSchedule) monthDates(year int, month time.Month, loc *time.Location) []time.Time {
+	days := s.Days
+	if len(days) == 0 {
+		days = DefaultPayrollSchedule().Days
+	}
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	var dates []time.Time
+	for _, d := range days {
+		if d > last {
+			d = last
+		}
+		date := time.Date(year, month, d, 0, 0, 0, 0, loc)
+		if len(dates) == 0 || !dates[len(dates)-1].Equal(date) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysBetween counts calendar days from a to b, ignoring DST shifts.
+func daysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+// dayList stores PayrollSchedule.Days as comma-separated text.
+type dayList []int
+
+func (d dayList) Value() (driver.Value, error) {
+	parts := make([]string, len(d))
+	for i, day := range d {
+		parts[i] = strconv.Itoa(day)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+func (d *dayList) Scan(src any) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into day list", src)
+	}
+	*d = nil
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		day, err := strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("scan day list: %w", err)
+		}
+		*d = append(*d, day)
+	}
+	return nil
+}
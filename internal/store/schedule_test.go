@@ -0,0 +1,239 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPayrollScheduleNormalize(t *testing.T) {
+	anchor := mustParseDate(t, "2024-01-05")
+	cases := []struct {
+		name    string
+		in      PayrollSchedule
+		want    PayrollSchedule
+		wantErr bool
+	}{
+		{name: "empty defaults to monthly", in: PayrollSchedule{}, want: PayrollSchedule{Frequency: PayMonthly, Days: []int{1}}},
+		{name: "semimonthly default", in: PayrollSchedule{Frequency: PaySemimonthly}, want: PayrollSchedule{Frequency: PaySemimonthly, Days: []int{1, 15}}},
+		{name: "days sorted", in: PayrollSchedule{Frequency: PaySemimonthly, Days: []int{31, 15, 15}}, want: PayrollSchedule{Frequency: PaySemimonthly, Days: []int{15, 31}}},
+		{name: "biweekly interval", in: PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor}, want: PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor, IntervalDays: 14}},
+		{name: "weekly needs anchor", in: PayrollSchedule{Frequency: PayWeekly}, wantErr: true},
+		{name: "custom needs interval", in: PayrollSchedule{Frequency: PayCustom, Anchor: &anchor}, wantErr: true},
+		{name: "semimonthly needs two days", in: PayrollSchedule{Frequency: PaySemimonthly, Days: []int{1, 10, 20}}, wantErr: true},
+		{name: "day out of range", in: PayrollSchedule{Days: []int{32}}, wantErr: true},
+		{name: "unknown frequency", in: PayrollSchedule{Frequency: "yearly"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := tc.in.Normalize()
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("%s: expected invalid input, got %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got.Frequency != tc.want.Frequency || got.IntervalDays != tc.want.IntervalDays || len(got.Days) != len(tc.want.Days) {
+			t.Fatalf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+		for i := range got.Days {
+			if got.Days[i] != tc.want.Days[i] {
+				t.Fatalf("%s: expected days %v, got %v", tc.name, tc.want.Days, got.Days)
+			}
+		}
+	}
+}
+
+func TestPayrollSchedulePeriods(t *testing.T) {
+	anchor := mustParseDate(t, "2024-01-05")
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		name      string
+		sched     PayrollSchedule
+		now       time.Time
+		wantStart time.Time
+		wantNext  time.Time
+	}{
+		{"monthly", DefaultPayrollSchedule(), day(2024, time.March, 15).Add(9 * time.Hour), day(2024, time.March, 1), day(2024, time.April, 1)},
+		{"monthly on pay day", DefaultPayrollSchedule(), day(2024, time.March, 1), day(2024, time.March, 1), day(2024, time.April, 1)},
+		{"semimonthly first half", PayrollSchedule{Frequency: PaySemimonthly, Days: []int{1, 15}}, day(2024, time.March, 10), day(2024, time.March, 1), day(2024, time.March, 15)},
+		{"semimonthly second half", PayrollSchedule{Frequency: PaySemimonthly, Days: []int{1, 15}}, day(2024, time.March, 20), day(2024, time.March, 15), day(2024, time.April, 1)},
+		{"end of month clamps", PayrollSchedule{Frequency: PaySemimonthly, Days: []int{15, 31}}, day(2024, time.February, 20), day(2024, time.February, 15), day(2024, time.February, 29)},
+		{"previous month", PayrollSchedule{Frequency: PaySemimonthly, Days: []int{15, 31}}, day(2024, time.March, 10), day(2024, time.February, 29), day(2024, time.March, 15)},
+		{"biweekly", PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor, IntervalDays: 14}, day(2024, time.January, 25), day(2024, time.January, 19), day(2024, time.February, 2)},
+		{"weekly on pay day", PayrollSchedule{Frequency: PayWeekly, Anchor: &anchor, IntervalDays: 7}, day(2024, time.January, 12), day(2024, time.January, 12), day(2024, time.January, 19)},
+	}
+	for _, tc := range cases {
+		start, ok := tc.sched.PeriodStart(tc.now)
+		if !ok || !start.Equal(tc.wantStart) {
+			t.Fatalf("%s: expected period start %s, got %s (ok=%v)", tc.name, tc.wantStart, start, ok)
+		}
+		if next := tc.sched.Next(tc.now); !next.Equal(tc.wantNext) {
+			t.Fatalf("%s: expected next %s, got %s", tc.name, tc.wantNext, next)
+		}
+	}
+
+	before := day(2024, time.January, 1)
+	biweekly := PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor, IntervalDays: 14}
+	if _, ok := biweekly.PeriodStart(before); ok {
+		t.Fatalf("expected no period before the anchor")
+	}
+	if next := biweekly.Next(before); !next.Equal(day(2024, time.January, 5)) {
+		t.Fatalf("expected first pay date on the anchor, got %s", next)
+	}
+	monthly := PayrollSchedule{Frequency: PayMonthly, Anchor: &anchor, Days: []int{1}}
+	if next := monthly.Next(before); !next.Equal(day(2024, time.February, 1)) {
+		t.Fatalf("expected first monthly pay date after the anchor, got %s", next)
+	}
+}
+
+func TestDayListRoundTrip(t *testing.T) {
+	v, err := dayList{1, 15}.Value()
+	if err != nil || v != "1,15" {
+		t.Fatalf("unexpected value %v (%v)", v, err)
+	}
+	var d dayList
+	if err := d.Scan("1, 15"); err != nil || len(d) != 2 || d[1] != 15 {
+		t.Fatalf("unexpected scan %v (%v)", d, err)
+	}
+	if err := d.Scan(""); err != nil || len(d) != 0 {
+		t.Fatalf("expected empty list, got %v (%v)", d, err)
+	}
+}
+
+func TestPayrollPendingPeriods(t *testing.T) {
+	now := time.Date(2024, time.April, 10, 9, 0, 0, 0, time.UTC)
+	paid := mustParseDate(t, "2024-01-01")
+	pb := payrollBudget{payroll: 100, schedule: DefaultPayrollSchedule(), paidThrough: &paid}
+	periods := pb.pendingPeriods(now)
+	want := []string{"2024-02-01", "2024-03-01", "2024-04-01"}
+	if len(periods) != len(want) {
+		t.Fatalf("expected %v, got %v", want, periods)
+	}
+	for i, p := range periods {
+		if DateOf(p).String() != want[i] {
+			t.Fatalf("expected %v, got %v", want, periods)
+		}
+		if desc := payrollDescription(pb.schedule, p); desc != "Payroll "+p.Format("January 2006") {
+			t.Fatalf("unexpected description %q", desc)
+		}
+	}
+
+	upToDate := mustParseDate(t, "2024-04-01")
+	pb.paidThrough = &upToDate
+	if periods := pb.pendingPeriods(now); len(periods) != 0 {
+		t.Fatalf("expected nothing pending, got %v", periods)
+	}
+
+	pb.paidThrough = nil
+	if periods := pb.pendingPeriods(now); len(periods) != 1 || DateOf(periods[0]).String() != "2024-04-01" {
+		t.Fatalf("expected only the current period for a new budget, got %v", periods)
+	}
+
+	anchor := mustParseDate(t, "2024-03-01")
+	pb.schedule = PayrollSchedule{Frequency: PayBiweekly, Anchor: &anchor, IntervalDays: 14}
+	pb.paidThrough = &anchor
+	periods = pb.pendingPeriods(now)
+	if len(periods) != 2 || DateOf(periods[0]).String() != "2024-03-15" || DateOf(periods[1]).String() != "2024-03-29" {
+		t.Fatalf("unexpected biweekly catch-up: %v", periods)
+	}
+	if desc := payrollDescription(pb.schedule, periods[0]); desc != "Payroll March 15, 2024" {
+		t.Fatalf("unexpected description %q", desc)
+	}
+}
+
+func TestPayrollScheduleTimeZone(t *testing.T) {
+	sched, err := PayrollSchedule{TimeZone: "America/New_York"}.Normalize()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := (PayrollSchedule{TimeZone: "Mars/Olympus"}).Normalize(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected unknown zone to be rejected, got %v", err)
+	}
+
+	// 22:00 UTC on March 31 is still March 31 in New York, and midnight
+	// there is 04:00 UTC.
+	now := time.Date(2024, time.March, 31, 22, 0, 0, 0, time.UTC)
+	next := sched.NextAfter(now)
+	if want := time.Date(2024, time.April, 1, 4, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("expected next pay at %s, got %s", want, next.UTC())
+	}
+	start, ok := sched.PeriodStart(clockAt(now)(sched.Location()))
+	if !ok || DateOf(start).String() != "2024-03-01" {
+		t.Fatalf("expected the March period in New York, got %s", start)
+	}
+	day := mustParseDate(t, "2024-04-01")
+	if on := clockOn(day)(sched.Location()); DateOf(on).String() != "2024-04-01" || on.Location().String() != "America/New_York" {
+		t.Fatalf("expected April 1 in New York, got %s", on)
+	}
+}
+
+func TestPayrollBusinessDay(t *testing.T) {
+	if _, err := (PayrollSchedule{BusinessDay: "nearest"}).Normalize(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected an unknown business-day rule to be rejected, got %v", err)
+	}
+	paid := mustParseDate(t, "2026-07-01")
+	saturday := time.Date(2026, time.August, 1, 0, 0, 0, 0, time.UTC)
+	holidays := holidaySet{"2026-07-31": true}
+
+	previous := PayrollSchedule{Frequency: PayMonthly, Days: []int{1}, TimeZone: "UTC", BusinessDay: BusinessDayPrevious}
+	if day := previous.payDay(saturday, nil); DateOf(day).String() != "2026-07-31" {
+		t.Fatalf("expected Friday, got %s", day)
+	}
+	if day := previous.payDay(saturday, holidays); DateOf(day).String() != "2026-07-30" {
+		t.Fatalf("expected the day before the holiday, got %s", day)
+	}
+	friday := time.Date(2026, time.July, 31, 9, 0, 0, 0, time.UTC)
+	if periods := previous.pendingSince(&paid, friday, nil); len(periods) != 1 || DateOf(periods[0]).String() != "2026-08-01" {
+		t.Fatalf("expected the August period to be due on Friday, got %v", periods)
+	}
+	thursday := friday.AddDate(0, 0, -1)
+	if periods := previous.pendingSince(&paid, thursday, nil); len(periods) != 0 {
+		t.Fatalf("expected nothing due on Thursday, got %v", periods)
+	}
+	if due := previous.nextDue(thursday, nil); DateOf(due).String() != "2026-07-31" {
+		t.Fatalf("expected Friday to be next, got %s", due)
+	}
+
+	next := previous
+	next.BusinessDay = BusinessDayNext
+	if day := next.payDay(saturday, holidays); DateOf(day).String() != "2026-08-03" {
+		t.Fatalf("expected Monday, got %s", day)
+	}
+	sunday := saturday.AddDate(0, 0, 1).Add(12 * time.Hour)
+	if periods := next.pendingSince(&paid, sunday, nil); len(periods) != 0 {
+		t.Fatalf("expected nothing due on Sunday, got %v", periods)
+	}
+	if due := next.nextDue(sunday, nil); DateOf(due).String() != "2026-08-03" {
+		t.Fatalf("expected Monday to be next, got %s", due)
+	}
+	plain := PayrollSchedule{Frequency: PayMonthly, Days: []int{1}, TimeZone: "UTC"}
+	if due := plain.nextDue(sunday, nil); DateOf(due).String() != "2026-09-01" {
+		t.Fatalf("expected the next pay date without a rule, got %s", due)
+	}
+}
+
+func TestProrate(t *testing.T) {
+	period := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	next := time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		start time.Time
+		want  Cents
+	}{
+		{period, 31000},
+		{period.AddDate(0, 0, -3), 31000},
+		{time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC), 22000},
+		{time.Date(2026, time.March, 31, 0, 0, 0, 0, time.UTC), 1000},
+		{next, 0},
+	}
+	for _, tc := range cases {
+		if got := prorate(31000, period, next, tc.start); got != tc.want {
+			t.Fatalf("start %s: expected %d, got %d", tc.start.Format(dateLayout), tc.want, got)
+		}
+	}
+	if got := prorate(1000, period, next, time.Date(2026, time.March, 16, 0, 0, 0, 0, time.UTC)); got != 516 {
+		t.Fatalf("expected rounding to the nearest cent, got %d", got)
+	}
+}
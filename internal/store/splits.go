@@ -0,0 +1,434 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Split is an itemized receipt: one parent total divided into debit lines
+// across budgets. Lines are regular transactions carrying the split's ID.
+type Split struct {
+	ID          int64         `json:"id"`
+	Description string        `json:"description"`
+	Total       Cents         `json:"total"`
+	OccurredOn  Date          `json:"occurred_on"`
+	Lines       []Transaction `json:"lines"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// SplitLine is one requested line of a split.
+type SplitLine struct {
+	BudgetID    int64  `json:"budget_id"`
+	Description string `json:"description"`
+	Amount      Cents  `json:"amount"`
+}
+
+// CreateSplit records a receipt and all of its lines atomically. Whatever the
+// lines leave of total is posted to remainderBudgetID as a catch-all line. A
+// nil occurredOn dates the receipt today in the first line's budget's time
+// zone.
+func (s *Store) CreateSplit(ctx context.Context, userID *int64, description string, total Cents, occurredOn *Date, lines []SplitLine, remainderBudgetID *int64) (Split, error) {
+	lines, err := planSplitLines(description, total, lines, remainderBudgetID)
+	if err != nil {
+		return Split{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Split{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureSplitLineAccessTx(ctx, tx, lines, userID); err != nil {
+		return Split{}, err
+	}
+	rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, splitLineBudgetIDs(lines)...)
+	if err != nil {
+		return Split{}, err
+	}
+	if occurredOn == nil {
+		today, err := budgetTodayTx(ctx, tx, lines[0].BudgetID)
+		if err != nil {
+			return Split{}, err
+		}
+		occurredOn = &today
+	}
+
+	sp := Split{Description: description, Total: total}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO splits (description, total_cents, occurred_on, user_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id, occurred_on, created_at, updated_at;
+	`, description, total, occurredOn, userID).Scan(&sp.ID, &sp.OccurredOn, &sp.CreatedAt, &sp.UpdatedAt); err != nil {
+		return Split{}, err
+	}
+	if sp.Lines, err = insertSplitLinesTx(ctx, tx, sp.ID, userID, sp.OccurredOn, nil, lines); err != nil {
+		return Split{}, err
+	}
+	if err := rebalanceSplitLinesTx(ctx, tx, userID, rebalance, sp.Lines); err != nil {
+		return Split{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Split{}, err
+	}
+	return sp, nil
+}
+
+func (s *Store) GetSplit(ctx context.Context, splitID int64, userID *int64) (Split, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Split{}, err
+	}
+	defer tx.Rollback()
+
+	sp, err := loadSplitTx(ctx, tx, splitID, userID, false)
+	if err != nil {
+		return Split{}, err
+	}
+	return sp, tx.Commit()
+}
+
+// UpdateSplit edits a split's description, total and date and replaces its
+// lines; a nil occurredOn keeps the current date. Lines in a budget the split
+// already had are updated in place, keeping their ID, tags, payee and cleared
+// flag; old lines left over leave the split for the trash and new ones take
+// the payee the old lines shared. The caller needs access to every budget the old and new
+// lines touch.
+func (s *Store) UpdateSplit(ctx context.Context, splitID int64, userID *int64, description string, total Cents, occurredOn *Date, lines []SplitLine, remainderBudgetID *int64) (Split, error) {
+	lines, err := planSplitLines(description, total, lines, remainderBudgetID)
+	if err != nil {
+		return Split{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Split{}, err
+	}
+	defer tx.Rollback()
+
+	previous, err := loadSplitTx(ctx, tx, splitID, userID, true)
+	if err != nil {
+		return Split{}, err
+	}
+	if err := checkSplitUnreconciled(previous); err != nil {
+		return Split{}, err
+	}
+	if err := ensureSplitLineAccessTx(ctx, tx, lines, userID); err != nil {
+		return Split{}, err
+	}
+	rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, splitLineBudgetIDs(lines)...)
+	if err != nil {
+		return Split{}, err
+	}
+
+	sp := Split{ID: splitID}
+	if err := tx.QueryRowContext(ctx, `
+		UPDATE splits
+		SET description = $1, total_cents = $2, occurred_on = COALESCE($3, occurred_on), updated_at = NOW()
+		WHERE id = $4
+		RETURNING description, total_cents, occurred_on, created_at, updated_at;
+	`, description, total, occurredOn, splitID).Scan(&sp.Description, &sp.Total, &sp.OccurredOn, &sp.CreatedAt, &sp.UpdatedAt); err != nil {
+		return Split{}, err
+	}
+	matches, removed := matchSplitLines(previous.Lines, lines)
+	sp.Lines = make([]Transaction, len(lines))
+	var added []SplitLine
+	var addedAt []int
+	for i, line := range lines {
+		if matches[i] < 0 {
+			added = append(added, line)
+			addedAt = append(addedAt, i)
+			continue
+		}
+		before := previous.Lines[matches[i]]
+		after, err := scanTransaction(tx.QueryRowContext(ctx, `
+			UPDATE transacts
+			SET description = $1, amount_cents = $2, occurred_on = $3, updated_at = NOW()
+			WHERE id = $4
+			RETURNING `+transactionColumns+`;
+		`, line.Description, line.Amount, sp.OccurredOn, before.ID))
+		if err != nil {
+			return Split{}, err
+		}
+		after.Tags, after.Payee = before.Tags, before.Payee
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditUpdate, &before, &after)); err != nil {
+			return Split{}, err
+		}
+		sp.Lines[i] = after
+	}
+	if len(removed) > 0 {
+		ids := make([]int64, len(removed))
+		for i, line := range removed {
+			ids[i] = line.ID
+		}
+		// Removed lines leave the split too, so restoring the split later
+		// doesn't bring them back and break its total.
+		deleted, err := queryTransactionsTx(ctx, tx, `
+			UPDATE transacts
+			SET split_id = NULL, deleted_at = NOW(), updated_at = NOW()
+			WHERE id = ANY($1)
+			RETURNING `+transactionColumns+`;
+		`, ids)
+		if err != nil {
+			return Split{}, err
+		}
+		if err := auditTransactionPairsTx(ctx, tx, userID, AuditDelete, removed, deleted); err != nil {
+			return Split{}, err
+		}
+	}
+	inserted, err := insertSplitLinesTx(ctx, tx, splitID, userID, sp.OccurredOn, sharedPayeeID(previous.Lines), added)
+	if err != nil {
+		return Split{}, err
+	}
+	if err := loadTransactionPayees(ctx, tx, inserted); err != nil {
+		return Split{}, err
+	}
+	for k, i := range addedAt {
+		sp.Lines[i] = inserted[k]
+	}
+	if err := rebalanceSplitLinesTx(ctx, tx, userID, rebalance, sp.Lines); err != nil {
+		return Split{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Split{}, err
+	}
+	return sp, nil
+}
+
+// DeleteSplit moves a split and all of its lines to the trash.
+func (s *Store) DeleteSplit(ctx context.Context, splitID int64, userID *int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sp, err := loadSplitTx(ctx, tx, splitID, userID, true)
+	if err != nil {
+		return err
+	}
+	if err := checkSplitUnreconciled(sp); err != nil {
+		return err
+	}
+	deleted, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE split_id = $1 AND deleted_at IS NULL
+		RETURNING `+transactionColumns+`;
+	`, splitID)
+	if err != nil {
+		return err
+	}
+	if err := auditTransactionPairsTx(ctx, tx, userID, AuditDelete, sp.Lines, deleted); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE splits SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1`, splitID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// planSplitLines validates the requested lines against total and appends the
+// catch-all remainder line when the lines don't cover the whole receipt.
+func planSplitLines(description string, total Cents, lines []SplitLine, remainderBudgetID *int64) ([]SplitLine, error) {
+	if total <= 0 {
+		return nil, invalidf("total must be > 0")
+	}
+	if len(lines) == 0 {
+		return nil, invalidf("at least one line is required")
+	}
+	planned := make([]SplitLine, 0, len(lines)+1)
+	var allocated Cents
+	for _, line := range lines {
+		if line.BudgetID <= 0 {
+			return nil, invalidf("every line needs a budget_id")
+		}
+		if line.Amount <= 0 {
+			return nil, invalidf("line amounts must be > 0")
+		}
+		if line.Description == "" {
+			line.Description = description
+		}
+		allocated += line.Amount
+		planned = append(planned, line)
+	}
+	remainder := total - allocated
+	if remainder < 0 {
+		return nil, invalidf("lines exceed the split total by %s", (-remainder).String())
+	}
+	if remainder > 0 {
+		if remainderBudgetID == nil {
+			return nil, invalidf("lines leave %s unallocated; set remainder_budget_id", remainder.String())
+		}
+		planned = append(planned, SplitLine{
+			BudgetID:    *remainderBudgetID,
+			Description: description + " - catch-all",
+			Amount:      remainder,
+		})
+	}
+	return planned, nil
+}
+
+func ensureSplitLineAccessTx(ctx context.Context, tx *sql.Tx, lines []SplitLine, userID *int64) error {
+	seen := make(map[int64]struct{}, len(lines))
+	for _, line := range lines {
+		if _, ok := seen[line.BudgetID]; ok {
+			continue
+		}
+		seen[line.BudgetID] = struct{}{}
+		if err := ensureBudgetAccessTx(ctx, tx, line.BudgetID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLineBudgetIDs lists the budget of every line.
+func splitLineBudgetIDs(lines []SplitLine) []int64 {
+	ids := make([]int64, len(lines))
+	for i, line := range lines {
+		ids[i] = line.BudgetID
+	}
+	return ids
+}
+
+// rebalanceSplitLinesTx runs immediate auto-balance for the budgets
+// lockImmediateAutoBalanceTx returned and reports each budget's moves on its
+// first line.
+func rebalanceSplitLinesTx(ctx context.Context, tx *sql.Tx, userID *int64, rebalance []int64, lines []Transaction) error {
+	for _, id := range rebalance {
+		moves, err := immediateAutoBalanceTx(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		for i := range lines {
+			if lines[i].BudgetID == id {
+				lines[i].AutoBalance = moves
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// matchSplitLines pairs each requested line with an unused old line in the
+// same budget, in order. matches[i] is the index in previous of lines[i]'s
+// line, or -1 for a new line; removed lists the old lines nothing matched.
+func matchSplitLines(previous []Transaction, lines []SplitLine) (matches []int, removed []Transaction) {
+	used := make([]bool, len(previous))
+	matches = make([]int, len(lines))
+	for i, line := range lines {
+		matches[i] = -1
+		for j, old := range previous {
+			if !used[j] && old.BudgetID == line.BudgetID {
+				used[j], matches[i] = true, j
+				break
+			}
+		}
+	}
+	for j, old := range previous {
+		if !used[j] {
+			removed = append(removed, old)
+		}
+	}
+	return matches, removed
+}
+
+// sharedPayeeID returns the payee every line has, or nil when they differ.
+func sharedPayeeID(lines []Transaction) *int64 {
+	if len(lines) == 0 || lines[0].PayeeID == nil {
+		return nil
+	}
+	for _, line := range lines[1:] {
+		if line.PayeeID == nil || *line.PayeeID != *lines[0].PayeeID {
+			return nil
+		}
+	}
+	return lines[0].PayeeID
+}
+
+func insertSplitLinesTx(ctx context.Context, tx *sql.Tx, splitID int64, userID *int64, occurredOn Date, payeeID *int64, lines []SplitLine) ([]Transaction, error) {
+	q := `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, split_id, payee_id, created_at, updated_at)
+		VALUES ($1, $2, $3, FALSE, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING ` + transactionColumns + `;
+	`
+	out := make([]Transaction, 0, len(lines))
+	for _, line := range lines {
+		t, err := scanTransaction(tx.QueryRowContext(ctx, q, line.BudgetID, userID, line.Description, line.Amount, occurredOn, splitID, payeeID))
+		if err != nil {
+			if isForeignKeyError(err) {
+				return nil, ErrNotFound
+			}
+			return nil, err
+		}
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &t)); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// loadSplitTx reads a split and its lines with their details, checking the
+// caller can access every budget involved. With lock set the split row and
+// its lines stay locked until the transaction ends, and none of the budgets
+// may be in the trash.
+func loadSplitTx(ctx context.Context, tx *sql.Tx, splitID int64, userID *int64, lock bool) (Split, error) {
+	suffix := ""
+	if lock {
+		suffix = " FOR UPDATE"
+	}
+	var sp Split
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, description, total_cents, occurred_on, created_at, updated_at
+		FROM splits
+		WHERE id = $1 AND deleted_at IS NULL`+suffix, splitID).Scan(&sp.ID, &sp.Description, &sp.Total, &sp.OccurredOn, &sp.CreatedAt, &sp.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Split{}, ErrNotFound
+	}
+	if err != nil {
+		return Split{}, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE split_id = $1 AND deleted_at IS NULL
+		ORDER BY id`+suffix, splitID)
+	if err != nil {
+		return Split{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return Split{}, err
+		}
+		sp.Lines = append(sp.Lines, t)
+	}
+	if err := rows.Err(); err != nil {
+		return Split{}, err
+	}
+	rows.Close()
+	if err := loadTransactionDetails(ctx, tx, sp.Lines); err != nil {
+		return Split{}, err
+	}
+
+	seen := make(map[int64]struct{}, len(sp.Lines))
+	for _, line := range sp.Lines {
+		if _, ok := seen[line.BudgetID]; ok {
+			continue
+		}
+		seen[line.BudgetID] = struct{}{}
+		if err := ensureGroupBudgetAccessTx(ctx, tx, line.BudgetID, userID, lock); err != nil {
+			return Split{}, err
+		}
+	}
+	return sp, nil
+}
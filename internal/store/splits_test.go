@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlanSplitLines(t *testing.T) {
+	catchAll := int64(9)
+	lines, err := planSplitLines("Costco", 5000, []SplitLine{
+		{BudgetID: 1, Amount: 1250},
+		{BudgetID: 2, Description: "Costco - snacks", Amount: 750},
+	}, &catchAll)
+	if err != nil {
+		t.Fatalf("planSplitLines error: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	if lines[0].Description != "Costco" {
+		t.Fatalf("expected empty description to default, got %q", lines[0].Description)
+	}
+	if lines[2].BudgetID != catchAll || lines[2].Amount != 3000 {
+		t.Fatalf("unexpected remainder line: %+v", lines[2])
+	}
+
+	exact, err := planSplitLines("Costco", 1250, []SplitLine{{BudgetID: 1, Amount: 1250}}, nil)
+	if err != nil || len(exact) != 1 {
+		t.Fatalf("expected single line without remainder, got %v, %v", exact, err)
+	}
+
+	if _, err := planSplitLines("Costco", 1000, []SplitLine{{BudgetID: 1, Amount: 1250}}, &catchAll); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected over-allocation to be invalid, got %v", err)
+	}
+	if _, err := planSplitLines("Costco", 2000, []SplitLine{{BudgetID: 1, Amount: 1250}}, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected missing remainder budget to be invalid, got %v", err)
+	}
+}
+
+func TestMatchSplitLines(t *testing.T) {
+	previous := []Transaction{{ID: 10, BudgetID: 1}, {ID: 11, BudgetID: 2}, {ID: 12, BudgetID: 1}}
+	matches, removed := matchSplitLines(previous, []SplitLine{
+		{BudgetID: 1, Amount: 500},
+		{BudgetID: 3, Amount: 250},
+		{BudgetID: 2, Amount: 100},
+	})
+	if len(matches) != 3 || matches[0] != 0 || matches[1] != -1 || matches[2] != 1 {
+		t.Fatalf("unexpected matches: %v", matches)
+	}
+	if len(removed) != 1 || removed[0].ID != 12 {
+		t.Fatalf("expected the second budget 1 line to be removed, got %+v", removed)
+	}
+
+	payee, other := int64(4), int64(5)
+	if got := sharedPayeeID([]Transaction{{PayeeID: &payee}, {PayeeID: &payee}}); got == nil || *got != payee {
+		t.Fatalf("expected shared payee %d, got %v", payee, got)
+	}
+	if got := sharedPayeeID([]Transaction{{PayeeID: &payee}, {PayeeID: &other}}); got != nil {
+		t.Fatalf("expected no shared payee, got %d", *got)
+	}
+}
@@ -25,32 +25,136 @@ func New(db *sql.DB) *Store {
 }
 
 type Budget struct {
-	ID                 int64      `json:"id"`
-	Name               string     `json:"name"`
-	Payroll            float64    `json:"payroll"`
-	PayrollRunAt       *time.Time `json:"payroll_run_at,omitempty"`
-	AutoBalanceEnabled bool       `json:"auto_balance_enabled"`
-	Credits            float64    `json:"credits"`
-	Debits             float64    `json:"debits"`
-	Balance            float64    `json:"balance"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Payroll is the amount in effect now; ListPayrollAmounts has its
+	// history and any dated changes still to come.
+	Payroll      Cents      `json:"payroll"`
+	PayrollRunAt *time.Time `json:"payroll_run_at,omitempty"`
+	// PayrollPaidThrough is the latest pay date that has been credited.
+	PayrollPaidThrough *Date           `json:"payroll_paid_through,omitempty"`
+	AutoBalanceEnabled bool            `json:"auto_balance_enabled"`
+	AutoBalanceTrigger string          `json:"auto_balance_trigger"`
+	PayrollSchedule    PayrollSchedule `json:"payroll_schedule"`
+	Rollover           RolloverPolicy  `json:"rollover"`
+	Credits            Cents           `json:"credits"`
+	Debits             Cents           `json:"debits"`
+	Balance            Cents           `json:"balance"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+	DeletedAt          *time.Time      `json:"deleted_at,omitempty"`
 }
 
 type Transaction struct {
-	ID          int64     `json:"id"`
-	BudgetID    int64     `json:"budget_id"`
-	UserID      *int64    `json:"user_id,omitempty"`
-	Description string    `json:"description"`
-	Credit      bool      `json:"credit"`
-	Amount      float64   `json:"amount"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64  `json:"id"`
+	BudgetID    int64  `json:"budget_id"`
+	UserID      *int64 `json:"user_id,omitempty"`
+	Description string `json:"description"`
+	Credit      bool   `json:"credit"`
+	Amount      Cents  `json:"amount"`
+	OccurredOn  Date   `json:"occurred_on"`
+	TransferID  *int64 `json:"transfer_id,omitempty"`
+	SplitID     *int64 `json:"split_id,omitempty"`
+	PayeeID     *int64 `json:"payee_id,omitempty"`
+	Payee       string `json:"payee,omitempty"`
+	Cleared     bool   `json:"cleared"`
+	// ReconciliationID is set once a finished reconciliation has locked the
+	// transaction's amount, direction and date.
+	ReconciliationID *int64 `json:"reconciliation_id,omitempty"`
+	// PayrollPeriod is the pay date a scheduled payroll credit covers.
+	PayrollPeriod *Date `json:"payroll_period,omitempty"`
+	// IncomeDepositID links a credit to the paycheck it distributed.
+	IncomeDepositID *int64     `json:"income_deposit_id,omitempty"`
+	Tags            []string   `json:"tags,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+	// AutoBalance holds the moves an immediate auto-balance made because
+	// this transaction left its budget negative.
+	AutoBalance []Transaction `json:"auto_balance,omitempty"`
 }
 
+// TransactionInput carries the editable fields of a transaction. A nil
+// OccurredOn means today on create and "leave unchanged" on update; likewise
+// nil Tags means none on create and unchanged on update, while an empty slice
+// clears them. Unknown tag names are created for the user.
+//
+// Payee names the merchant and goes through the user's alias rules, creating
+// a payee when nothing matches; an empty name clears it. When Payee is nil a
+// new transaction is matched against the rules by its description and an
+// update leaves the payee alone. A nil Cleared means uncleared on create and
+// unchanged on update.
+type TransactionInput struct {
+	Description string
+	Credit      bool
+	Amount      Cents
+	OccurredOn  *Date
+	Tags        []string
+	Payee       *string
+	Cleared     *bool
+}
+
+// TransactionQuery filters and pages a budget's transactions. From and To
+// bound occurred_on inclusively; Tag matches a tag name case-insensitively.
+// Search also matches the payee's name.
+type TransactionQuery struct {
+	Limit   int
+	Offset  int
+	Search  string
+	From    *Date
+	To      *Date
+	Tag     string
+	PayeeID *int64
+}
+
+// Auto-balance source modes. Priority sources are drained in ascending
+// Priority order, each only down to its Floor; weighted sources then
+// share whatever deficit is left in proportion to Weight.
+const (
+	AutoBalanceWeighted = "weighted"
+	AutoBalancePriority = "priority"
+)
+
+// When auto-balance covers a budget's deficit: at each payroll run, or also
+// as soon as a transaction leaves the budget negative.
+const (
+	AutoBalanceAtPayroll = "payroll"
+	AutoBalanceImmediate = "immediate"
+)
+
+// AutoBalanceSource is a budget that covers another budget's deficit. For
+// priority sources Weight only splits the deficit between sources sharing a
+// priority. Auto-balance never takes a source below Floor.
 type AutoBalanceSource struct {
-	SourceBudgetID int64 `json:"source_budget_id"`
-	Weight         int   `json:"weight"`
+	SourceBudgetID int64  `json:"source_budget_id"`
+	Weight         int    `json:"weight"`
+	Mode           string `json:"mode"`
+	Priority       int    `json:"priority"`
+	Floor          Cents  `json:"floor"`
+}
+
+// normalize defaults the mode to weighted and rejects out-of-range values.
+func (s AutoBalanceSource) normalize() (AutoBalanceSource, error) {
+	if s.Weight < 0 || s.Weight > 100 {
+		return AutoBalanceSource{}, invalidf("weight must be between 0 and 100")
+	}
+	switch s.Mode = strings.TrimSpace(s.Mode); s.Mode {
+	case "":
+		s.Mode = AutoBalanceWeighted
+	case AutoBalanceWeighted, AutoBalancePriority:
+	default:
+		return AutoBalanceSource{}, invalidf("mode must be %s or %s", AutoBalanceWeighted, AutoBalancePriority)
+	}
+	if s.Priority < 0 || s.Priority > 1000 {
+		return AutoBalanceSource{}, invalidf("priority must be between 0 and 1000")
+	}
+	if s.Mode == AutoBalanceWeighted && s.Priority != 0 {
+		return AutoBalanceSource{}, invalidf("priority only applies to priority sources")
+	}
+	if s.Floor < 0 {
+		return AutoBalanceSource{}, invalidf("floor must be >= 0")
+	}
+	return s, nil
 }
 
 type User struct {
@@ -81,23 +185,88 @@ type APIKey struct {
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 }
 
-var ErrNotFound = errors.New("not found")
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// invalidf reports a request the store refuses to apply. Handlers surface the
+// message to clients as a 400.
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidInput}, args...)...)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const transactionColumns = `id, budget_id, user_id, description, credit, amount_cents, occurred_on, transfer_id, split_id, payee_id, cleared, reconciliation_id, payroll_period, income_deposit_id, created_at, updated_at, deleted_at`
+
+func scanTransaction(row rowScanner) (Transaction, error) {
+	var t Transaction
+	err := row.Scan(&t.ID, &t.BudgetID, &t.UserID, &t.Description, &t.Credit, &t.Amount, &t.OccurredOn, &t.TransferID, &t.SplitID, &t.PayeeID, &t.Cleared, &t.ReconciliationID, &t.PayrollPeriod, &t.IncomeDepositID, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt)
+	return t, err
+}
+
+// queryTransactionsTx runs a query returning transactionColumns and reads
+// every row, closing the result set before returning so the caller can keep
+// using the transaction.
+func queryTransactionsTx(ctx context.Context, q queryer, query string, args ...any) ([]Transaction, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var txns []Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		txns = append(txns, t)
+	}
+	return txns, rows.Err()
+}
+
+// loadTransactionDetails fills in the tags and payee names of txns.
+func loadTransactionDetails(ctx context.Context, q queryer, txns []Transaction) error {
+	if err := loadTransactionTags(ctx, q, txns); err != nil {
+		return err
+	}
+	return loadTransactionPayees(ctx, q, txns)
+}
 
+// ListBudgets returns the live budgets the user can access. Budgets in the
+// trash are only returned by ListTrash.
 func (s *Store) ListBudgets(ctx context.Context, userID *int64) ([]Budget, error) {
+	return s.listBudgets(ctx, userID, false)
+}
+
+func (s *Store) listBudgets(ctx context.Context, userID *int64, deleted bool) ([]Budget, error) {
 	base := `
-		SELECT b.id, b.name, b.payroll, b.payroll_run_at, b.auto_balance_enabled, b.created_at, b.updated_at,
-			COALESCE(SUM(CASE WHEN t.credit THEN t.amount ELSE 0 END), 0) AS credits,
-			COALESCE(SUM(CASE WHEN t.credit THEN 0 ELSE t.amount END), 0) AS debits
+		SELECT ` + qualifiedBudgetColumns + `,
+			COALESCE(SUM(CASE WHEN t.credit THEN t.amount_cents ELSE 0 END), 0)::BIGINT AS credits,
+			COALESCE(SUM(CASE WHEN t.credit THEN 0 ELSE t.amount_cents END), 0)::BIGINT AS debits
 		FROM budgets b
 	`
 	var args []any
-	var where string
+	where := "WHERE b.deleted_at IS NULL"
+	if deleted {
+		where = "WHERE b.deleted_at IS NOT NULL"
+	}
 	if userID != nil {
 		base += "JOIN users_budgets ub ON ub.budget_id = b.id "
-		where = "WHERE ub.user_id = $1"
+		where += " AND ub.user_id = $1"
 		args = append(args, *userID)
 	}
-	base += "LEFT JOIN transacts t ON t.budget_id = b.id "
+	base += "LEFT JOIN transacts t ON t.budget_id = b.id AND t.deleted_at IS NULL "
 	query := base + where + " GROUP BY b.id ORDER BY b.id;"
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
@@ -109,7 +278,7 @@ func (s *Store) ListBudgets(ctx context.Context, userID *int64) ([]Budget, error
 	var budgets []Budget
 	for rows.Next() {
 		var b Budget
-		if err := rows.Scan(&b.ID, &b.Name, &b.Payroll, &b.PayrollRunAt, &b.AutoBalanceEnabled, &b.CreatedAt, &b.UpdatedAt, &b.Credits, &b.Debits); err != nil {
+		if err := rows.Scan(append(budgetDest(&b), &b.Credits, &b.Debits)...); err != nil {
 			return nil, err
 		}
 		b.Balance = b.Credits - b.Debits
@@ -120,23 +289,23 @@ func (s *Store) ListBudgets(ctx context.Context, userID *int64) ([]Budget, error
 
 func (s *Store) GetBudget(ctx context.Context, id int64, userID *int64) (Budget, error) {
 	query := `
-		SELECT b.id, b.name, b.payroll, b.payroll_run_at, b.auto_balance_enabled, b.created_at, b.updated_at,
-			COALESCE(SUM(CASE WHEN t.credit THEN t.amount ELSE 0 END), 0) AS credits,
-			COALESCE(SUM(CASE WHEN t.credit THEN 0 ELSE t.amount END), 0) AS debits
+		SELECT ` + qualifiedBudgetColumns + `,
+			COALESCE(SUM(CASE WHEN t.credit THEN t.amount_cents ELSE 0 END), 0)::BIGINT AS credits,
+			COALESCE(SUM(CASE WHEN t.credit THEN 0 ELSE t.amount_cents END), 0)::BIGINT AS debits
 		FROM budgets b
 	`
 	var args []any
-	var where = "WHERE b.id = $1"
+	var where = "WHERE b.id = $1 AND b.deleted_at IS NULL"
 	args = append(args, id)
 	if userID != nil {
 		query += "JOIN users_budgets ub ON ub.budget_id = b.id "
 		where += " AND ub.user_id = $2"
 		args = append(args, *userID)
 	}
-	query += "LEFT JOIN transacts t ON t.budget_id = b.id " + where + " GROUP BY b.id;"
+	query += "LEFT JOIN transacts t ON t.budget_id = b.id AND t.deleted_at IS NULL " + where + " GROUP BY b.id;"
 
 	var b Budget
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(&b.ID, &b.Name, &b.Payroll, &b.PayrollRunAt, &b.AutoBalanceEnabled, &b.CreatedAt, &b.UpdatedAt, &b.Credits, &b.Debits)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(append(budgetDest(&b), &b.Credits, &b.Debits)...)
 	if errors.Is(err, sql.ErrNoRows) {
 		return Budget{}, ErrNotFound
 	}
@@ -147,11 +316,11 @@ func (s *Store) GetBudget(ctx context.Context, id int64, userID *int64) (Budget,
 	return b, nil
 }
 
-func (s *Store) CreateBudget(ctx context.Context, userID *int64, name string, payroll float64) (Budget, error) {
+func (s *Store) CreateBudget(ctx context.Context, userID *int64, name string, payroll Cents) (Budget, error) {
 	const q = `
-		INSERT INTO budgets (name, payroll, payroll_run_at, auto_balance_enabled, created_at, updated_at)
+		INSERT INTO budgets (name, payroll_cents, payroll_run_at, auto_balance_enabled, created_at, updated_at)
 		VALUES ($1, $2, NULL, FALSE, NOW(), NOW())
-		RETURNING id, name, payroll, payroll_run_at, auto_balance_enabled, created_at, updated_at;
+		RETURNING ` + budgetColumns + `;
 	`
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -159,8 +328,8 @@ func (s *Store) CreateBudget(ctx context.Context, userID *int64, name string, pa
 	}
 	defer tx.Rollback()
 
-	var b Budget
-	if err := tx.QueryRowContext(ctx, q, name, payroll).Scan(&b.ID, &b.Name, &b.Payroll, &b.PayrollRunAt, &b.AutoBalanceEnabled, &b.CreatedAt, &b.UpdatedAt); err != nil {
+	b, err := scanBudgetRow(tx.QueryRowContext(ctx, q, name, payroll))
+	if err != nil {
 		return Budget{}, err
 	}
 	if userID != nil {
@@ -168,82 +337,175 @@ func (s *Store) CreateBudget(ctx context.Context, userID *int64, name string, pa
 			return Budget{}, err
 		}
 	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO payroll_amounts (budget_id, amount_cents, effective_on, user_id, created_at)
+		VALUES ($1, $2, NULL, $3, NOW())
+	`, b.ID, payroll, userID); err != nil {
+		return Budget{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: b.ID, entity: AuditBudget, entityID: b.ID, action: AuditCreate, after: b}); err != nil {
+		return Budget{}, err
+	}
 	if err := tx.Commit(); err != nil {
 		return Budget{}, err
 	}
 	return b, nil
 }
 
-func (s *Store) UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll float64) (Budget, error) {
-	if err := s.ensureBudgetAccess(ctx, id, userID); err != nil {
+// UpdateBudget renames a budget and sets its payroll. A new payroll takes
+// effect today and is added to the budget's payroll history; use
+// SetPayrollAmount to date the change.
+func (s *Store) UpdateBudget(ctx context.Context, id int64, userID *int64, name string, payroll Cents) (Budget, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
+		return Budget{}, err
+	}
+	before, err := lockBudgetRowTx(ctx, tx, id)
+	if err != nil {
 		return Budget{}, err
 	}
 
 	const q = `
 		UPDATE budgets
-		SET name = $1, payroll = $2, updated_at = NOW()
+		SET name = $1, payroll_cents = $2, updated_at = NOW()
 		WHERE id = $3
-		RETURNING id, name, payroll, payroll_run_at, auto_balance_enabled, created_at, updated_at;
+		RETURNING ` + budgetColumns + `;
 	`
-	var b Budget
-	err := s.db.QueryRowContext(ctx, q, name, payroll, id).Scan(&b.ID, &b.Name, &b.Payroll, &b.PayrollRunAt, &b.AutoBalanceEnabled, &b.CreatedAt, &b.UpdatedAt)
+	b, err := scanBudgetRow(tx.QueryRowContext(ctx, q, name, payroll, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return Budget{}, ErrNotFound
 	}
 	if err != nil {
 		return Budget{}, err
 	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: id, entity: AuditBudget, entityID: id, action: AuditUpdate, before: before, after: b}); err != nil {
+		return Budget{}, err
+	}
+	if payroll != before.Payroll {
+		today := DateOf(time.Now().In(b.PayrollSchedule.Location()))
+		if _, err := setPayrollAmountTx(ctx, tx, id, userID, payroll, today); err != nil {
+			return Budget{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Budget{}, err
+	}
 	return b, nil
 }
 
-func (s *Store) GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (bool, []AutoBalanceSource, error) {
+// budgetColumns are the stored budget fields; credits, debits and balance are
+// computed by the list queries.
+const budgetColumns = `id, name, payroll_cents, payroll_run_at, payroll_paid_through, auto_balance_enabled, auto_balance_trigger, payroll_frequency, payroll_anchor, payroll_days, payroll_interval_days, payroll_time_zone, payroll_business_day, payroll_prorate, rollover_policy, rollover_cap_cents, rollover_target_id, created_at, updated_at, deleted_at`
+
+// qualifiedBudgetColumns is budgetColumns for queries that alias budgets as b.
+const qualifiedBudgetColumns = `b.id, b.name, b.payroll_cents, b.payroll_run_at, b.payroll_paid_through, b.auto_balance_enabled, b.auto_balance_trigger, b.payroll_frequency, b.payroll_anchor, b.payroll_days, b.payroll_interval_days, b.payroll_time_zone, b.payroll_business_day, b.payroll_prorate, b.rollover_policy, b.rollover_cap_cents, b.rollover_target_id, b.created_at, b.updated_at, b.deleted_at`
+
+// budgetDest returns the scan destinations for budgetColumns.
+func budgetDest(b *Budget) []any {
+	return []any{
+		&b.ID, &b.Name, &b.Payroll, &b.PayrollRunAt, &b.PayrollPaidThrough, &b.AutoBalanceEnabled, &b.AutoBalanceTrigger,
+		&b.PayrollSchedule.Frequency, &b.PayrollSchedule.Anchor, (*dayList)(&b.PayrollSchedule.Days), &b.PayrollSchedule.IntervalDays, &b.PayrollSchedule.TimeZone, &b.PayrollSchedule.BusinessDay, &b.PayrollSchedule.Prorate,
+		&b.Rollover.Mode, &b.Rollover.Cap, &b.Rollover.TargetBudgetID,
+		&b.CreatedAt, &b.UpdatedAt, &b.DeletedAt,
+	}
+}
+
+func scanBudgetRow(row rowScanner) (Budget, error) {
+	var b Budget
+	err := row.Scan(budgetDest(&b)...)
+	return b, err
+}
+
+// lockBudgetRowTx loads a budget row, trashed or not, and locks it until the
+// surrounding transaction ends.
+func lockBudgetRowTx(ctx context.Context, tx *sql.Tx, id int64) (Budget, error) {
+	b, err := scanBudgetRow(tx.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = $1 FOR UPDATE`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Budget{}, ErrNotFound
+	}
+	return b, err
+}
+
+func (s *Store) GetAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64) (AutoBalanceConfig, error) {
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
-		return false, nil, err
+		return AutoBalanceConfig{}, err
 	}
-	var enabled bool
-	if err := s.db.QueryRowContext(ctx, `SELECT auto_balance_enabled FROM budgets WHERE id = $1`, budgetID).Scan(&enabled); err != nil {
+	return autoBalanceConfigTx(ctx, s.db, budgetID)
+}
+
+// AutoBalanceConfig is a budget's auto-balance settings. Trigger is
+// AutoBalanceAtPayroll or AutoBalanceImmediate; left empty on update, it
+// keeps the budget's current trigger.
+type AutoBalanceConfig struct {
+	Enabled bool                `json:"enabled"`
+	Trigger string              `json:"trigger"`
+	Sources []AutoBalanceSource `json:"sources"`
+}
+
+func autoBalanceConfigTx(ctx context.Context, q queryer, budgetID int64) (AutoBalanceConfig, error) {
+	var cfg AutoBalanceConfig
+	if err := q.QueryRowContext(ctx, `SELECT auto_balance_enabled, auto_balance_trigger FROM budgets WHERE id = $1`, budgetID).Scan(&cfg.Enabled, &cfg.Trigger); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return false, nil, ErrNotFound
+			return cfg, ErrNotFound
 		}
-		return false, nil, err
+		return cfg, err
 	}
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT source_budget_id, weight
-		FROM budget_auto_balance_sources
-		WHERE budget_id = $1
-		ORDER BY source_budget_id;
+	sources, err := autoBalanceSourcesTx(ctx, q, budgetID)
+	cfg.Sources = sources
+	return cfg, err
+}
+
+// autoBalanceSourcesTx lists a budget's live auto-balance sources, priority
+// sources first in the order they are drained.
+func autoBalanceSourcesTx(ctx context.Context, q queryer, budgetID int64) ([]AutoBalanceSource, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT abs.source_budget_id, abs.weight, abs.mode, abs.priority, abs.floor_cents
+		FROM budget_auto_balance_sources abs
+		JOIN budgets src ON src.id = abs.source_budget_id
+		WHERE abs.budget_id = $1 AND src.deleted_at IS NULL
+		ORDER BY abs.mode = 'priority' DESC, abs.priority, abs.source_budget_id;
 	`, budgetID)
 	if err != nil {
-		return false, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 	var sources []AutoBalanceSource
 	for rows.Next() {
 		var s AutoBalanceSource
-		if err := rows.Scan(&s.SourceBudgetID, &s.Weight); err != nil {
-			return false, nil, err
+		if err := rows.Scan(&s.SourceBudgetID, &s.Weight, &s.Mode, &s.Priority, &s.Floor); err != nil {
+			return nil, err
 		}
 		sources = append(sources, s)
 	}
-	if err := rows.Err(); err != nil {
-		return false, nil, err
-	}
-	return enabled, sources, nil
+	return sources, rows.Err()
 }
 
-func (s *Store) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, enabled bool, sources []AutoBalanceSource) error {
+func (s *Store) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, userID *int64, cfg AutoBalanceConfig) error {
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
 		return err
 	}
+	switch cfg.Trigger = strings.TrimSpace(cfg.Trigger); cfg.Trigger {
+	case "", AutoBalanceAtPayroll, AutoBalanceImmediate:
+	default:
+		return invalidf("trigger must be %s or %s", AutoBalanceAtPayroll, AutoBalanceImmediate)
+	}
+	sources := cfg.Sources
 
 	seen := make(map[int64]struct{}, len(sources))
-	for _, source := range sources {
+	for i, source := range sources {
 		if source.SourceBudgetID == budgetID {
 			return fmt.Errorf("source budget cannot match target")
 		}
-		if source.Weight < 0 || source.Weight > 100 {
-			return fmt.Errorf("weight must be between 0 and 100")
+		source, err := source.normalize()
+		if err != nil {
+			return err
 		}
+		sources[i] = source
 		if _, ok := seen[source.SourceBudgetID]; ok {
 			return fmt.Errorf("duplicate source budget")
 		}
@@ -259,11 +521,19 @@ func (s *Store) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, use
 	}
 	defer tx.Rollback()
 
+	before, err := autoBalanceConfigTx(ctx, tx, budgetID)
+	if err != nil {
+		return err
+	}
+	if cfg.Trigger == "" {
+		cfg.Trigger = before.Trigger
+	}
+
 	res, err := tx.ExecContext(ctx, `
 		UPDATE budgets
-		SET auto_balance_enabled = $1, updated_at = NOW()
-		WHERE id = $2
-	`, enabled, budgetID)
+		SET auto_balance_enabled = $1, auto_balance_trigger = $2, updated_at = NOW()
+		WHERE id = $3
+	`, cfg.Enabled, cfg.Trigger, budgetID)
 	if err != nil {
 		return err
 	}
@@ -276,48 +546,56 @@ func (s *Store) UpdateAutoBalanceConfig(ctx context.Context, budgetID int64, use
 	}
 
 	for _, source := range sources {
-		if source.Weight <= 0 {
+		if source.Weight <= 0 && source.Mode != AutoBalancePriority {
 			continue
 		}
 		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO budget_auto_balance_sources (budget_id, source_budget_id, weight)
-			VALUES ($1, $2, $3)
-		`, budgetID, source.SourceBudgetID, source.Weight); err != nil {
+			INSERT INTO budget_auto_balance_sources (budget_id, source_budget_id, weight, mode, priority, floor_cents)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, budgetID, source.SourceBudgetID, source.Weight, source.Mode, source.Priority, source.Floor); err != nil {
 			return err
 		}
 	}
 
+	after, err := autoBalanceConfigTx(ctx, tx, budgetID)
+	if err != nil {
+		return err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: budgetID, entity: AuditAutoBalance, entityID: budgetID, action: AuditUpdate, before: before, after: after}); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
+// DeleteBudget moves a budget to the trash. Its transactions, shares and
+// auto-balance settings stay in place so RestoreBudget can bring it back
+// whole; PurgeTrash removes them for good once the retention window passes.
 func (s *Store) DeleteBudget(ctx context.Context, id int64, userID *int64) error {
-	if err := s.ensureBudgetAccess(ctx, id, userID); err != nil {
-		return err
-	}
-
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.ExecContext(ctx, `DELETE FROM transacts WHERE budget_id = $1`, id); err != nil {
+	if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
 		return err
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM budget_auto_balance_sources WHERE budget_id = $1 OR source_budget_id = $1`, id); err != nil {
+	before, err := lockBudgetRowTx(ctx, tx, id)
+	if err != nil {
 		return err
 	}
-	if _, err := tx.ExecContext(ctx, `DELETE FROM users_budgets WHERE budget_id = $1`, id); err != nil {
-		return err
+	if before.DeletedAt != nil {
+		return ErrNotFound
 	}
-
-	res, err := tx.ExecContext(ctx, `DELETE FROM budgets WHERE id = $1`, id)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE budgets
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, id); err != nil {
 		return err
 	}
-	count, _ := res.RowsAffected()
-	if count == 0 {
-		return ErrNotFound
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: id, entity: AuditBudget, entityID: id, action: AuditDelete, before: before}); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
@@ -329,34 +607,25 @@ func (s *Store) ListTransactions(ctx context.Context, budgetID int64, userID *in
 	if limit <= 0 || limit > 500 {
 		limit = 100
 	}
-	const q = `
-		SELECT id, budget_id, user_id, description, credit, amount, created_at, updated_at
+	q := `
+		SELECT ` + transactionColumns + `
 		FROM transacts
-		WHERE budget_id = $1
-		ORDER BY created_at DESC
+		WHERE budget_id = $1 AND deleted_at IS NULL
+		ORDER BY occurred_on DESC, created_at DESC, id DESC
 		LIMIT $2;
 	`
-	rows, err := s.db.QueryContext(ctx, q, budgetID, limit)
+	txns, err := queryTransactionsTx(ctx, s.db, q, budgetID, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var txns []Transaction
-	for rows.Next() {
-		var t Transaction
-		if err := rows.Scan(&t.ID, &t.BudgetID, &t.UserID, &t.Description, &t.Credit, &t.Amount, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			return nil, err
-		}
-		txns = append(txns, t)
-	}
-	return txns, rows.Err()
+	return txns, loadTransactionDetails(ctx, s.db, txns)
 }
 
-func (s *Store) ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, limit, offset int, search string) ([]Transaction, error) {
+func (s *Store) ListTransactionsPaged(ctx context.Context, budgetID int64, userID *int64, query TransactionQuery) ([]Transaction, error) {
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
 		return nil, err
 	}
+	limit, offset := query.Limit, query.Offset
 	if limit <= 0 || limit > 500 {
 		limit = 100
 	}
@@ -366,115 +635,293 @@ func (s *Store) ListTransactionsPaged(ctx context.Context, budgetID int64, userI
 
 	var args []any
 	args = append(args, budgetID)
-	where := "budget_id = $1"
-	if search != "" {
-		args = append(args, "%"+search+"%")
-		where += fmt.Sprintf(" AND (CAST(amount AS TEXT) ILIKE $%d OR description ILIKE $%d)", len(args), len(args))
+	where := "budget_id = $1 AND deleted_at IS NULL"
+	if query.Search != "" {
+		args = append(args, "%"+query.Search+"%")
+		where += fmt.Sprintf(" AND (CAST(amount_cents / 100.0 AS NUMERIC(14, 2))::TEXT ILIKE $%d OR description ILIKE $%d OR TO_CHAR(occurred_on, 'YYYY-MM-DD') ILIKE $%d OR payee_id IN (SELECT id FROM payees WHERE name ILIKE $%d))", len(args), len(args), len(args), len(args))
+	}
+	if query.From != nil {
+		args = append(args, *query.From)
+		where += fmt.Sprintf(" AND occurred_on >= $%d", len(args))
+	}
+	if query.To != nil {
+		args = append(args, *query.To)
+		where += fmt.Sprintf(" AND occurred_on <= $%d", len(args))
+	}
+	if query.PayeeID != nil {
+		args = append(args, *query.PayeeID)
+		where += fmt.Sprintf(" AND payee_id = $%d", len(args))
+	}
+	if query.Tag != "" {
+		args = append(args, query.Tag)
+		where += fmt.Sprintf(" AND id IN (SELECT tt.transact_id FROM transacts_tags tt JOIN tags tg ON tg.id = tt.tag_id WHERE LOWER(tg.name) = LOWER($%d))", len(args))
 	}
 	args = append(args, limit, offset)
 
-	query := fmt.Sprintf(`
-		SELECT id, budget_id, user_id, description, credit, amount, created_at, updated_at
+	q := fmt.Sprintf(`
+		SELECT %s
 		FROM transacts
 		WHERE %s
-		ORDER BY created_at DESC
+		ORDER BY occurred_on DESC, created_at DESC, id DESC
 		LIMIT $%d OFFSET $%d;
-	`, where, len(args)-1, len(args))
+	`, transactionColumns, where, len(args)-1, len(args))
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	txns, err := queryTransactionsTx(ctx, s.db, q, args...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return txns, loadTransactionDetails(ctx, s.db, txns)
+}
 
-	var txns []Transaction
-	for rows.Next() {
-		var t Transaction
-		if err := rows.Scan(&t.ID, &t.BudgetID, &t.UserID, &t.Description, &t.Credit, &t.Amount, &t.CreatedAt, &t.UpdatedAt); err != nil {
-			return nil, err
-		}
-		txns = append(txns, t)
+func (s *Store) CreateTransaction(ctx context.Context, budgetID int64, userID *int64, in TransactionInput) (Transaction, error) {
+	if in.Amount <= 0 {
+		return Transaction{}, invalidf("amount must be > 0")
 	}
-	return txns, rows.Err()
-}
 
-func (s *Store) CreateTransaction(ctx context.Context, budgetID int64, userID *int64, description string, credit bool, amount float64) (Transaction, error) {
-	if amount <= 0 {
-		return Transaction{}, fmt.Errorf("amount must be > 0")
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Transaction{}, err
 	}
+	defer tx.Rollback()
 
-	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+	if err := ensureBudgetAccessTx(ctx, tx, budgetID, userID); err != nil {
+		return Transaction{}, err
+	}
+	rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, budgetID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if in.OccurredOn == nil {
+		today, err := budgetTodayTx(ctx, tx, budgetID)
+		if err != nil {
+			return Transaction{}, err
+		}
+		in.OccurredOn = &today
+	}
+
+	payeeText, createPayee := in.Description, false
+	if in.Payee != nil {
+		payeeText, createPayee = *in.Payee, true
+	}
+	payeeID, payeeName, err := resolvePayeeTx(ctx, tx, userID, payeeText, createPayee)
+	if err != nil {
 		return Transaction{}, err
 	}
 
-	const q = `
-		INSERT INTO transacts (budget_id, user_id, description, credit, amount, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
-		RETURNING id, budget_id, user_id, description, credit, amount, created_at, updated_at;
+	q := `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, payee_id, cleared, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, FALSE), NOW(), NOW())
+		RETURNING ` + transactionColumns + `;
 	`
-	var t Transaction
-	err := s.db.QueryRowContext(ctx, q, budgetID, userID, description, credit, amount).Scan(
-		&t.ID, &t.BudgetID, &t.UserID, &t.Description, &t.Credit, &t.Amount, &t.CreatedAt, &t.UpdatedAt,
-	)
+	t, err := scanTransaction(tx.QueryRowContext(ctx, q, budgetID, userID, in.Description, in.Credit, in.Amount, in.OccurredOn, payeeID, in.Cleared))
 	if err != nil {
 		if isForeignKeyError(err) {
 			return Transaction{}, ErrNotFound
 		}
 		return Transaction{}, err
 	}
+	t.Payee = payeeName
+	if in.Tags != nil {
+		if t.Tags, err = setTransactionTagsTx(ctx, tx, userID, t.ID, in.Tags); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &t)); err != nil {
+		return Transaction{}, err
+	}
+	for _, id := range rebalance {
+		if t.AutoBalance, err = immediateAutoBalanceTx(ctx, tx, userID, id); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, err
+	}
 	return t, nil
 }
 
-func (s *Store) UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, description string, credit bool, amount float64) (Transaction, error) {
-	if amount <= 0 {
-		return Transaction{}, fmt.Errorf("amount must be > 0")
+func (s *Store) UpdateTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64, in TransactionInput) (Transaction, error) {
+	if in.Amount <= 0 {
+		return Transaction{}, invalidf("amount must be > 0")
 	}
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
 		return Transaction{}, err
 	}
 
-	const q = `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Transaction{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := lockTransactionTx(ctx, tx, budgetID, transactionID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if current.SplitID != nil && (in.Credit != current.Credit || in.Amount != current.Amount) {
+		return Transaction{}, invalidf("split lines are re-split through their split")
+	}
+	if err := checkReconciledEdit(current, in.Credit, in.Amount, in.OccurredOn, in.Cleared); err != nil {
+		return Transaction{}, err
+	}
+	if current.TransferID != nil {
+		if in.Credit != current.Credit {
+			return Transaction{}, invalidf("the direction of a transfer leg cannot change")
+		}
+		legs, err := updateTransferLegsTx(ctx, tx, *current.TransferID, transactionID, userID, in)
+		if err != nil {
+			return Transaction{}, err
+		}
+		// Editing the legs doesn't touch their budget_id, so no budget row
+		// was share-locked and the budgets can still be locked here.
+		ids := make([]int64, len(legs))
+		for i, leg := range legs {
+			ids[i] = leg.BudgetID
+		}
+		rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, ids...)
+		if err != nil {
+			return Transaction{}, err
+		}
+		moves := make(map[int64][]Transaction, len(rebalance))
+		for _, id := range rebalance {
+			if moves[id], err = immediateAutoBalanceTx(ctx, tx, userID, id); err != nil {
+				return Transaction{}, err
+			}
+		}
+		for _, leg := range legs {
+			if leg.ID == transactionID {
+				leg.AutoBalance = moves[leg.BudgetID]
+				return leg, tx.Commit()
+			}
+		}
+		return Transaction{}, ErrNotFound
+	}
+	rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, budgetID)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	payeeID, payeeName := current.PayeeID, current.Payee
+	if in.Payee != nil {
+		if payeeID, payeeName, err = resolvePayeeTx(ctx, tx, userID, *in.Payee, true); err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	q := `
 		UPDATE transacts
-		SET description = $1, credit = $2, amount = $3, updated_at = NOW()
-		WHERE id = $4 AND budget_id = $5
-		RETURNING id, budget_id, user_id, description, credit, amount, created_at, updated_at;
+		SET description = $1, credit = $2, amount_cents = $3, occurred_on = COALESCE($4, occurred_on), payee_id = $5,
+			cleared = COALESCE($6, cleared), updated_at = NOW()
+		WHERE id = $7 AND budget_id = $8
+		RETURNING ` + transactionColumns + `;
 	`
-	var t Transaction
-	err := s.db.QueryRowContext(ctx, q, description, credit, amount, transactionID, budgetID).Scan(
-		&t.ID, &t.BudgetID, &t.UserID, &t.Description, &t.Credit, &t.Amount, &t.CreatedAt, &t.UpdatedAt,
-	)
+	t, err := scanTransaction(tx.QueryRowContext(ctx, q, in.Description, in.Credit, in.Amount, in.OccurredOn, payeeID, in.Cleared, transactionID, budgetID))
 	if errors.Is(err, sql.ErrNoRows) {
 		return Transaction{}, ErrNotFound
 	}
-	return t, err
+	if err != nil {
+		return Transaction{}, err
+	}
+	t.Payee = payeeName
+	t.Tags = current.Tags
+	if in.Tags != nil {
+		if t.Tags, err = setTransactionTagsTx(ctx, tx, userID, t.ID, in.Tags); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditUpdate, &current, &t)); err != nil {
+		return Transaction{}, err
+	}
+	for _, id := range rebalance {
+		if t.AutoBalance, err = immediateAutoBalanceTx(ctx, tx, userID, id); err != nil {
+			return Transaction{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, err
+	}
+	return t, nil
 }
 
 func (s *Store) DeleteTransaction(ctx context.Context, budgetID, transactionID int64, userID *int64) error {
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
 		return err
 	}
-	res, err := s.db.ExecContext(ctx, `DELETE FROM transacts WHERE id = $1 AND budget_id = $2`, transactionID, budgetID)
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	affected, _ := res.RowsAffected()
-	if affected == 0 {
+	defer tx.Rollback()
+
+	current, err := lockTransactionTx(ctx, tx, budgetID, transactionID)
+	if err != nil {
+		return err
+	}
+	if current.SplitID != nil {
+		return invalidf("split lines are deleted through their split")
+	}
+	if current.ReconciliationID != nil {
+		return invalidf("transaction %d is reconciled and cannot be deleted", current.ID)
+	}
+	if current.TransferID != nil {
+		if err := deleteTransferTx(ctx, tx, *current.TransferID, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	deleted, err := scanTransaction(tx.QueryRowContext(ctx, `
+		UPDATE transacts
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND budget_id = $2
+		RETURNING `+transactionColumns+`;
+	`, transactionID, budgetID))
+	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNotFound
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+	if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditDelete, &current, &deleted)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockTransactionTx loads a live transaction row with its details and holds a
+// row lock on it until the surrounding transaction ends.
+func lockTransactionTx(ctx context.Context, tx *sql.Tx, budgetID, transactionID int64) (Transaction, error) {
+	q := `
+		SELECT ` + transactionColumns + `
+		FROM transacts
+		WHERE id = $1 AND budget_id = $2 AND deleted_at IS NULL
+		FOR UPDATE;
+	`
+	txns, err := queryTransactionsTx(ctx, tx, q, transactionID, budgetID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if len(txns) == 0 {
+		return Transaction{}, ErrNotFound
+	}
+	if err := loadTransactionDetails(ctx, tx, txns); err != nil {
+		return Transaction{}, err
+	}
+	return txns[0], nil
 }
 
-func (s *Store) BudgetBalance(ctx context.Context, budgetID int64, userID *int64) (float64, error) {
+func (s *Store) BudgetBalance(ctx context.Context, budgetID int64, userID *int64) (Cents, error) {
 	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
 		return 0, err
 	}
 
 	const q = `
-		SELECT COALESCE(SUM(CASE WHEN credit THEN amount ELSE -amount END), 0)
+		SELECT COALESCE(SUM(CASE WHEN credit THEN amount_cents ELSE -amount_cents END), 0)::BIGINT
 		FROM transacts
-		WHERE budget_id = $1;
+		WHERE budget_id = $1 AND deleted_at IS NULL;
 	`
-	var balance float64
+	var balance Cents
 	err := s.db.QueryRowContext(ctx, q, budgetID).Scan(&balance)
 	if errors.Is(err, sql.ErrNoRows) {
 		return 0, ErrNotFound
@@ -557,12 +1004,35 @@ func (s *Store) AddBudgetShare(ctx context.Context, budgetID int64, ownerID *int
 	if err != nil {
 		return User{}, err
 	}
-	_, err = s.db.ExecContext(ctx, `
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
 		INSERT INTO users_budgets (user_id, budget_id)
 		VALUES ($1, $2)
 		ON CONFLICT DO NOTHING;
 	`, user.ID, budgetID)
-	return user, err
+	if err != nil {
+		return User{}, err
+	}
+	if added, _ := res.RowsAffected(); added > 0 {
+		ev := auditEvent{budgetID: budgetID, entity: AuditShare, entityID: user.ID, action: AuditCreate, after: shareAudit{UserID: user.ID, Email: user.Email}}
+		if err := recordAuditTx(ctx, tx, ownerID, ev); err != nil {
+			return User{}, err
+		}
+	}
+	return user, tx.Commit()
+}
+
+// shareAudit is how a share appears in the audit log; it leaves out the
+// user's credentials.
+type shareAudit struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
 }
 
 func (s *Store) RemoveBudgetShare(ctx context.Context, budgetID int64, ownerID *int64, email string) error {
@@ -577,8 +1047,24 @@ func (s *Store) RemoveBudgetShare(ctx context.Context, budgetID int64, ownerID *
 	if err != nil {
 		return err
 	}
-	_, err = s.db.ExecContext(ctx, `DELETE FROM users_budgets WHERE user_id = $1 AND budget_id = $2`, userID, budgetID)
-	return err
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM users_budgets WHERE user_id = $1 AND budget_id = $2`, userID, budgetID)
+	if err != nil {
+		return err
+	}
+	if removed, _ := res.RowsAffected(); removed > 0 {
+		ev := auditEvent{budgetID: budgetID, entity: AuditShare, entityID: userID, action: AuditDelete, before: shareAudit{UserID: userID, Email: email}}
+		if err := recordAuditTx(ctx, tx, ownerID, ev); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *Store) ListAPIKeys(ctx context.Context, userID int64) ([]APIKey, error) {
@@ -744,17 +1230,73 @@ func (s *Store) UpdatePasskeySignCount(ctx context.Context, credentialID string,
 }
 
 func (s *Store) ensureBudgetAccess(ctx context.Context, budgetID int64, userID *int64) error {
+	return ensureBudgetAccessTx(ctx, s.db, budgetID, userID)
+}
+
+// ensureBudgetAccessTx reports ErrNotFound unless the budget is live and, for
+// a non-nil userID, shared with that user.
+func ensureBudgetAccessTx(ctx context.Context, q queryer, budgetID int64, userID *int64) error {
+	var exists bool
+	var err error
 	if userID == nil {
-		return nil
+		err = q.QueryRowContext(ctx, `SELECT TRUE FROM budgets WHERE id = $1 AND deleted_at IS NULL`, budgetID).Scan(&exists)
+	} else {
+		err = q.QueryRowContext(ctx, `
+			SELECT TRUE
+			FROM users_budgets ub
+			JOIN budgets b ON b.id = ub.budget_id
+			WHERE ub.budget_id = $1 AND ub.user_id = $2 AND b.deleted_at IS NULL
+		`, budgetID, *userID).Scan(&exists)
 	}
-	var exists bool
-	err := s.db.QueryRowContext(ctx, `SELECT TRUE FROM users_budgets WHERE budget_id = $1 AND user_id = $2`, budgetID, *userID).Scan(&exists)
 	if errors.Is(err, sql.ErrNoRows) {
 		return ErrNotFound
 	}
 	return err
 }
 
+// ensureGroupBudgetAccessTx checks the caller can access a budget holding
+// another part of a transfer or split. Such a budget may be in the trash,
+// which only stops changes to the group: with change set, a trashed budget
+// must be restored first.
+func ensureGroupBudgetAccessTx(ctx context.Context, q queryer, budgetID int64, userID *int64, change bool) error {
+	var trashed bool
+	var err error
+	if userID == nil {
+		err = q.QueryRowContext(ctx, `SELECT deleted_at IS NOT NULL FROM budgets WHERE id = $1`, budgetID).Scan(&trashed)
+	} else {
+		err = q.QueryRowContext(ctx, `
+			SELECT b.deleted_at IS NOT NULL
+			FROM users_budgets ub
+			JOIN budgets b ON b.id = ub.budget_id
+			WHERE ub.budget_id = $1 AND ub.user_id = $2
+		`, budgetID, *userID).Scan(&trashed)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if trashed && change {
+		return invalidf("budget %d must be restored first", budgetID)
+	}
+	return nil
+}
+
+// budgetTodayTx returns today's date in the budget's payroll time zone, the
+// default date of anything recorded against the budget.
+func budgetTodayTx(ctx context.Context, q queryer, budgetID int64) (Date, error) {
+	var sched PayrollSchedule
+	err := q.QueryRowContext(ctx, `SELECT payroll_time_zone FROM budgets WHERE id = $1`, budgetID).Scan(&sched.TimeZone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Date{}, ErrNotFound
+	}
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(time.Now().In(sched.Location())), nil
+}
+
 func isForeignKeyError(err error) bool {
 	// pgx returns errors containing "foreign key violation"
 	return err != nil && strings.Contains(err.Error(), "foreign key violation")
@@ -769,217 +1311,496 @@ func (s *Store) Ping(ctx context.Context) error {
 	return s.db.PingContext(ctx)
 }
 
-// RunMonthlyPayroll inserts a payroll credit transaction for each budget that
-// hasn't been processed in the current month. It updates payroll_run_at to
-// prevent duplicate credits within the same month. Returns the number of
-// transactions created.
-func (s *Store) RunMonthlyPayroll(ctx context.Context, now time.Time) (int, error) {
-	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+// RunPayroll inserts a payroll credit for every pay date of each budget's
+// schedule that falls after the budget's last credited pay date and on or
+// before now, so periods missed while the server was down are caught up one
+// credit each. Budgets are locked while they are processed and every credit
+// records the pay date it covers, so concurrent runs can't credit a period
+// twice. A budget that fails is rolled back on its own and reported in the
+// returned run, whose status is then partial or failed; the error return is
+// for runs that couldn't complete at all. The run is recorded in the payroll
+// history. RunPayroll covers every budget; userID only records who started
+// it.
+func (s *Store) RunPayroll(ctx context.Context, trigger string, userID *int64, now time.Time) (PayrollRun, error) {
+	return s.executePayrollRun(ctx, PayrollRun{Trigger: trigger, UserID: userID, AsOf: now}, payrollScope{}, false)
+}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+// RunUserPayroll is RunPayroll restricted to the budgets userID belongs to.
+func (s *Store) RunUserPayroll(ctx context.Context, userID int64, now time.Time) (PayrollRun, error) {
+	return s.executePayrollRun(ctx, PayrollRun{Trigger: PayrollTriggerManual, UserID: &userID, AsOf: now}, payrollScope{memberID: &userID}, false)
+}
+
+// payrollDescription names a payroll credit after its pay period: the month
+// for schedules that pay once a month, the pay date otherwise.
+func payrollDescription(sched PayrollSchedule, period time.Time) string {
+	if sched.Frequency == PayMonthly && len(sched.Days) <= 1 {
+		return fmt.Sprintf("Payroll %s", period.Format("January 2006"))
+	}
+	return fmt.Sprintf("Payroll %s", period.Format("January 2, 2006"))
+}
+
+// RunBudgetPayroll catches up one budget's missed pay periods. With force set
+// and nothing due it credits the current period again as an extra payment.
+// It returns the number of credits posted.
+func (s *Store) RunBudgetPayroll(ctx context.Context, budgetID int64, userID *int64, now time.Time, force bool) (int, error) {
+	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
+		return 0, err
+	}
+	run, err := s.executePayrollRun(ctx, PayrollRun{Trigger: PayrollTriggerBudget, UserID: userID, BudgetID: &budgetID, AsOf: now}, payrollScope{budgetID: &budgetID}, force)
 	if err != nil {
-		return 0, fmt.Errorf("begin tx: %w", err)
+		return 0, err
 	}
-	defer tx.Rollback()
+	if run.Status != PayrollRunSucceeded {
+		return run.CreditCount, fmt.Errorf("payroll budget %d: %s", budgetID, run.Error)
+	}
+	return run.CreditCount, nil
+}
 
-	rows, err := tx.QueryContext(ctx, `
-		SELECT id, name, payroll, auto_balance_enabled, payroll_run_at
+// payrollScope narrows a payroll run to one budget, to the budgets a user
+// belongs to, or both. The zero scope covers every budget.
+type payrollScope struct {
+	budgetID *int64
+	memberID *int64
+}
+
+// payrollTx credits the due pay periods of every live budget with a payroll
+// within scope, evaluating each budget's schedule in its own time zone. Each
+// budget runs under a savepoint: one that fails is rolled back and reported
+// with its error while the rest go ahead.
+func payrollTx(ctx context.Context, tx *sql.Tx, userID *int64, clock payrollClock, scope payrollScope, force bool) ([]PayrollCredit, error) {
+	query := `
+		SELECT ` + payrollBudgetColumns + `
 		FROM budgets
-		WHERE payroll > 0
-			AND (payroll_run_at IS NULL OR payroll_run_at < $1)
-		FOR UPDATE;
-	`, monthStart)
+		WHERE ` + payrollActive + `
+			AND deleted_at IS NULL`
+	var args []any
+	if scope.budgetID != nil {
+		args = append(args, *scope.budgetID)
+		query += fmt.Sprintf(" AND id = $%d", len(args))
+	}
+	if scope.memberID != nil {
+		args = append(args, *scope.memberID)
+		query += fmt.Sprintf(" AND id IN (SELECT budget_id FROM users_budgets WHERE user_id = $%d)", len(args))
+	}
+	holidays, err := loadHolidaysTx(ctx, tx)
 	if err != nil {
-		return 0, fmt.Errorf("select budgets: %w", err)
+		return nil, fmt.Errorf("select holidays: %w", err)
+	}
+	rows, err := tx.QueryContext(ctx, query+" ORDER BY id FOR UPDATE;", args...)
+	if err != nil {
+		return nil, fmt.Errorf("select budgets: %w", err)
 	}
 	defer rows.Close()
 
 	var pending []payrollBudget
-	created := 0
 	for rows.Next() {
-		var pb payrollBudget
-		if err := rows.Scan(&pb.id, &pb.name, &pb.payroll, &pb.autoBalanceEnabled, &pb.payrollRunAt); err != nil {
-			return 0, fmt.Errorf("scan budget: %w", err)
+		pb, err := scanPayrollBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan budget: %w", err)
 		}
+		pb.holidays = holidays
 		pending = append(pending, pb)
 	}
 	if err := rows.Err(); err != nil {
-		return 0, fmt.Errorf("rows err: %w", err)
+		return nil, fmt.Errorf("rows err: %w", err)
 	}
+	rows.Close()
 
+	var credits []PayrollCredit
 	for _, pb := range pending {
-		if err := runPayrollForBudgetTx(ctx, tx, pb, now, monthStart, false); err != nil {
-			return 0, err
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT payroll_budget`); err != nil {
+			return nil, fmt.Errorf("savepoint: %w", err)
 		}
-		created++
-	}
-
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit: %w", err)
+		budgetCredits, err := creditBudgetTx(ctx, tx, userID, pb, clock(pb.schedule.Location()), force)
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT payroll_budget`); rbErr != nil {
+				return nil, fmt.Errorf("payroll budget %d: %w (rollback: %v)", pb.id, err, rbErr)
+			}
+			credits = append(credits, PayrollCredit{BudgetID: pb.id, BudgetName: pb.name, Amount: pb.payroll, Status: PayrollCreditFailed, Error: err.Error()})
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT payroll_budget`); err != nil {
+			return nil, fmt.Errorf("release savepoint: %w", err)
+		}
+		credits = append(credits, budgetCredits...)
 	}
-	return created, nil
-}
-
-func payrollDescription(now time.Time) string {
-	return fmt.Sprintf("Payroll %s", now.Format("January 2006"))
+	return credits, nil
 }
 
-func (s *Store) RunBudgetPayroll(ctx context.Context, budgetID int64, userID *int64, now time.Time, force bool) (int, error) {
-	if err := s.ensureBudgetAccess(ctx, budgetID, userID); err != nil {
-		return 0, err
-	}
-	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
-
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, fmt.Errorf("begin tx: %w", err)
+// creditBudgetTx credits one budget's pending pay periods, or with force and
+// nothing pending, the current period once more, each with the payroll amount
+// in effect on its pay date. now is in the budget's time zone.
+func creditBudgetTx(ctx context.Context, tx *sql.Tx, userID *int64, pb payrollBudget, now time.Time, force bool) ([]PayrollCredit, error) {
+	if err := syncPayrollAmountTx(ctx, tx, pb, DateOf(now)); err != nil {
+		return nil, err
 	}
-	defer tx.Rollback()
-
-	var pb payrollBudget
-	if err := tx.QueryRowContext(ctx, `
-		SELECT id, name, payroll, auto_balance_enabled, payroll_run_at
-		FROM budgets
-		WHERE id = $1
-		FOR UPDATE;
-	`, budgetID).Scan(&pb.id, &pb.name, &pb.payroll, &pb.autoBalanceEnabled, &pb.payrollRunAt); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return 0, ErrNotFound
+	var credits []PayrollCredit
+	for _, period := range pb.pendingPeriods(now) {
+		credit, err := runPayrollForBudgetTx(ctx, tx, userID, pb, period, true)
+		if err != nil {
+			return nil, err
+		}
+		if credit != nil {
+			credits = append(credits, *credit)
 		}
-		return 0, fmt.Errorf("select budget: %w", err)
-	}
-	if pb.payroll <= 0 {
-		return 0, nil
-	}
-	if !force && pb.payrollRunAt != nil && !pb.payrollRunAt.Before(monthStart) {
-		return 0, nil
-	}
-
-	if err := runPayrollForBudgetTx(ctx, tx, pb, now, monthStart, force); err != nil {
-		return 0, err
 	}
-
-	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit: %w", err)
+	if len(credits) == 0 && force {
+		period, ok := pb.schedule.PeriodStart(now)
+		if !ok {
+			period = midnight(now)
+		}
+		credit, err := runPayrollForBudgetTx(ctx, tx, userID, pb, period, false)
+		if err != nil {
+			return nil, err
+		}
+		if credit != nil {
+			credits = append(credits, *credit)
+		}
 	}
-	return 1, nil
+	return credits, nil
 }
 
+// payrollActive keeps the budgets with a payroll now, a positive amount
+// taking effect after their last paid pay date, an amount override for a pay
+// date after it, or a rollover policy that acts at each pay date.
+const payrollActive = `(payroll_cents > 0 OR rollover_policy <> 'carry' OR EXISTS (
+	SELECT 1 FROM payroll_amounts a
+	WHERE a.budget_id = budgets.id AND a.amount_cents > 0
+		AND (budgets.payroll_paid_through IS NULL OR a.effective_on > budgets.payroll_paid_through)
+) OR EXISTS (
+	SELECT 1 FROM payroll_overrides o
+	WHERE o.budget_id = budgets.id AND o.kind = 'amount'
+		AND (budgets.payroll_paid_through IS NULL OR o.starts_on > budgets.payroll_paid_through)
+))`
+
 type payrollBudget struct {
 	id                 int64
 	name               string
-	payroll            float64
+	payroll            Cents
 	autoBalanceEnabled bool
 	payrollRunAt       *time.Time
+	paidThrough        *Date
+	schedule           PayrollSchedule
+	rollover           RolloverPolicy
+	createdAt          time.Time
+	// holidays are the non-business days of the run.
+	holidays holidaySet
 }
 
+const payrollBudgetColumns = `id, name, payroll_cents, auto_balance_enabled, payroll_run_at, payroll_paid_through, payroll_frequency, payroll_anchor, payroll_days, payroll_interval_days, payroll_time_zone, payroll_business_day, payroll_prorate, rollover_policy, rollover_cap_cents, rollover_target_id, created_at`
+
+func scanPayrollBudget(row rowScanner) (payrollBudget, error) {
+	var pb payrollBudget
+	err := row.Scan(&pb.id, &pb.name, &pb.payroll, &pb.autoBalanceEnabled, &pb.payrollRunAt, &pb.paidThrough,
+		&pb.schedule.Frequency, &pb.schedule.Anchor, (*dayList)(&pb.schedule.Days), &pb.schedule.IntervalDays, &pb.schedule.TimeZone, &pb.schedule.BusinessDay, &pb.schedule.Prorate,
+		&pb.rollover.Mode, &pb.rollover.Cap, &pb.rollover.TargetBudgetID, &pb.createdAt)
+	return pb, err
+}
+
+// pendingPeriods lists the pay dates that haven't been credited yet and post
+// on or before now, oldest first. now must be in the schedule's time zone.
+func (pb payrollBudget) pendingPeriods(now time.Time) []time.Time {
+	return pb.schedule.pendingSince(pb.paidThrough, now, pb.holidays)
+}
+
+// runPayrollForBudgetTx credits one pay period. A scheduled credit records
+// the period it covers and is skipped if that period already has one; an
+// extra (forced) credit doesn't claim the period. Each scheduled pay date
+// applies the budget's rollover policy first, since it starts a new period
+// whether or not it is credited, and then honors the period's override: a
+// skip or pause marks the period paid without crediting it, and an amount
+// override replaces the payroll. The payroll is the amount in effect on the
+// pay date, prorated for a budget's first period when its schedule asks; a
+// scheduled period whose amount is zero, with no amount override, is marked
+// paid without a credit and reported as skipped when its rollover moved
+// money. Scheduled credits post on the schedule's business day. It returns
+// nil when nothing was written.
 func runPayrollForBudgetTx(
 	ctx context.Context,
 	tx *sql.Tx,
+	userID *int64,
 	pb payrollBudget,
-	now time.Time,
-	monthStart time.Time,
-	force bool,
-) error {
-	if pb.payroll <= 0 {
-		return nil
+	period time.Time,
+	scheduled bool,
+) (*PayrollCredit, error) {
+	payDate := DateOf(period)
+	amount, err := payrollAmountTx(ctx, tx, pb, payDate)
+	if err != nil {
+		return nil, err
 	}
-	if !force && pb.payrollRunAt != nil && !pb.payrollRunAt.Before(monthStart) {
-		return nil
+	full := amount
+	if scheduled && pb.paidThrough == nil && pb.schedule.Prorate {
+		created := midnight(pb.createdAt.In(period.Location()))
+		amount = prorate(amount, period, pb.schedule.Next(period), created)
+	}
+	out := &PayrollCredit{BudgetID: pb.id, BudgetName: pb.name, Period: &payDate, Amount: amount, Status: PayrollCreditCredited}
+	if amount != full {
+		out.ProratedFrom = full
+	}
+	var claim *Date
+	postedOn := payDate
+	if scheduled {
+		claim = &payDate
+		postedOn = DateOf(pb.schedule.payDay(period, pb.holidays))
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM transacts WHERE budget_id = $1 AND payroll_period = $2)
+		`, pb.id, payDate).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("check payroll period: %w", err)
+		}
+		if exists {
+			return nil, nil
+		}
+
+		// Every scheduled pay date starts a new period, credited or not.
+		moves, err := applyRolloverTx(ctx, tx, userID, pb, postedOn)
+		if err != nil {
+			return nil, fmt.Errorf("rollover budget %d: %w", pb.id, err)
+		}
+		out.Rollover = moves
+		if out.Override, err = payrollOverrideTx(ctx, tx, pb.id, payDate); err != nil {
+			return nil, err
+		}
+		switch {
+		case out.Override == nil && amount > 0:
+		case out.Override != nil && out.Override.Kind == OverrideAmount:
+			out.Amount, out.ProratedFrom = out.Override.Amount, 0
+		default:
+			if err := markPayrollPaidTx(ctx, tx, pb.id, payDate); err != nil {
+				return nil, err
+			}
+			if out.Override == nil && len(moves) == 0 {
+				return nil, nil
+			}
+			out.Status, out.Amount, out.ProratedFrom = PayrollCreditSkipped, 0, 0
+			return out, nil
+		}
+	} else if amount <= 0 {
+		return nil, nil
 	}
 	if pb.autoBalanceEnabled {
-		if err := applyAutoBalanceTx(ctx, tx, pb.id, pb.name); err != nil {
-			return fmt.Errorf("auto-balance budget %d: %w", pb.id, err)
+		moves, unfunded, err := applyAutoBalanceTx(ctx, tx, userID, pb.id, pb.name)
+		if err != nil {
+			return nil, fmt.Errorf("auto-balance budget %d: %w", pb.id, err)
 		}
+		out.AutoBalance, out.Unfunded = moves, unfunded
 	}
-	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO transacts (budget_id, user_id, description, credit, amount, created_at, updated_at)
-		VALUES ($1, NULL, $2, TRUE, $3, NOW(), NOW())
-	`, pb.id, payrollDescription(now), pb.payroll); err != nil {
-		return fmt.Errorf("insert payroll txn: %w", err)
+	credit, err := scanTransaction(tx.QueryRowContext(ctx, `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, payroll_period, created_at, updated_at)
+		VALUES ($1, NULL, $2, TRUE, $3, $4, $5, NOW(), NOW())
+		RETURNING `+transactionColumns+`;
+	`, pb.id, payrollDescription(pb.schedule, period), out.Amount, postedOn, claim))
+	if err != nil {
+		return nil, fmt.Errorf("insert payroll txn: %w", err)
+	}
+	if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &credit)); err != nil {
+		return nil, err
 	}
+	if err := markPayrollPaidTx(ctx, tx, pb.id, payDate); err != nil {
+		return nil, err
+	}
+	out.Credit = &credit
+	return out, nil
+}
+
+// markPayrollPaidTx records that a budget's payroll ran for payDate.
+func markPayrollPaidTx(ctx context.Context, tx *sql.Tx, budgetID int64, payDate Date) error {
 	if _, err := tx.ExecContext(ctx, `
 		UPDATE budgets
-		SET payroll_run_at = NOW(), updated_at = NOW()
+		SET payroll_run_at = NOW(),
+			payroll_paid_through = GREATEST(payroll_paid_through, $2::DATE),
+			updated_at = NOW()
 		WHERE id = $1
-	`, pb.id); err != nil {
+	`, budgetID, payDate); err != nil {
 		return fmt.Errorf("update payroll_run_at: %w", err)
 	}
 	return nil
 }
 
-func applyAutoBalanceTx(ctx context.Context, tx *sql.Tx, budgetID int64, budgetName string) error {
-	var balance float64
-	if err := tx.QueryRowContext(ctx, `
-		SELECT COALESCE(SUM(CASE WHEN credit THEN amount ELSE -amount END), 0)
-		FROM transacts
-		WHERE budget_id = $1;
-	`, budgetID).Scan(&balance); err != nil {
-		return fmt.Errorf("select balance: %w", err)
+// lockImmediateAutoBalanceTx finds the budgets among budgetIDs whose
+// auto-balance runs immediately and locks them with their sources, in id
+// order, so concurrent writes don't rebalance the same deficit twice. It must
+// run before the transaction inserts into those budgets: the insert's foreign
+// key takes a share lock on the budget row, and two writers upgrading it to
+// the rebalance's lock would deadlock. It returns the budgets to pass to
+// immediateAutoBalanceTx.
+func lockImmediateAutoBalanceTx(ctx context.Context, tx *sql.Tx, budgetIDs ...int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id
+		FROM budgets
+		WHERE id = ANY($1) AND auto_balance_enabled AND auto_balance_trigger = $2 AND deleted_at IS NULL
+		ORDER BY id;
+	`, budgetIDs, AutoBalanceImmediate)
+	if err != nil {
+		return nil, fmt.Errorf("select immediate auto-balance: %w", err)
 	}
-	if balance >= 0 {
-		return nil
+	var targets []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		targets = append(targets, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	deficitCents := int64(math.Round(math.Abs(balance) * 100))
-	if deficitCents <= 0 {
-		return nil
+	locks := append([]int64(nil), targets...)
+	for _, id := range targets {
+		sources, err := autoBalanceSourcesTx(ctx, tx, id)
+		if err != nil {
+			return nil, fmt.Errorf("select sources: %w", err)
+		}
+		for _, source := range sources {
+			locks = append(locks, source.SourceBudgetID)
+		}
+	}
+	if err := lockBudgetsTx(ctx, tx, locks); err != nil {
+		return nil, err
 	}
+	return targets, nil
+}
 
-	rows, err := tx.QueryContext(ctx, `
-		SELECT source_budget_id, weight
-		FROM budget_auto_balance_sources
-		WHERE budget_id = $1
-		ORDER BY source_budget_id;
-	`, budgetID)
+// immediateAutoBalanceTx covers a budget's deficit right away when its
+// auto-balance is enabled with the immediate trigger. budgetID must have been
+// locked by lockImmediateAutoBalanceTx.
+func immediateAutoBalanceTx(ctx context.Context, tx *sql.Tx, userID *int64, budgetID int64) ([]Transaction, error) {
+	budget, err := lockBudgetRowTx(ctx, tx, budgetID)
 	if err != nil {
-		return fmt.Errorf("select sources: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
+	if !budget.AutoBalanceEnabled || budget.AutoBalanceTrigger != AutoBalanceImmediate {
+		return nil, nil
+	}
+	moves, _, err := applyAutoBalanceTx(ctx, tx, userID, budgetID, budget.Name)
+	if err != nil {
+		return nil, fmt.Errorf("auto-balance budget %d: %w", budgetID, err)
+	}
+	return moves, nil
+}
 
-	var sources []AutoBalanceSource
-	for rows.Next() {
-		var source AutoBalanceSource
-		if err := rows.Scan(&source.SourceBudgetID, &source.Weight); err != nil {
-			return fmt.Errorf("scan source: %w", err)
-		}
-		sources = append(sources, source)
+// applyAutoBalanceTx covers a budget's deficit from its auto-balance sources,
+// taking each source no lower than its floor. The sources are locked in id
+// order before their balances are read, so concurrent rebalances or debits
+// can't spend the same spare amount twice. It returns the moves made and the
+// part of the deficit the sources couldn't cover.
+func applyAutoBalanceTx(ctx context.Context, tx *sql.Tx, userID *int64, budgetID int64, budgetName string) ([]Transaction, Cents, error) {
+	balance, err := budgetBalanceTx(ctx, tx, budgetID)
+	if err != nil {
+		return nil, 0, err
 	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("sources err: %w", err)
+	if balance >= 0 {
+		return nil, 0, nil
 	}
-	if len(sources) == 0 {
-		return nil
+
+	deficitCents := -int64(balance)
+
+	sources, err := autoBalanceSourcesTx(ctx, tx, budgetID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("select sources: %w", err)
+	}
+	ids := make([]int64, len(sources))
+	for i, source := range sources {
+		ids[i] = source.SourceBudgetID
+	}
+	balances, err := lockBudgetBalancesTx(ctx, tx, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("lock sources: %w", err)
+	}
+	available := make([]int64, len(sources))
+	for i, source := range sources {
+		if spare := int64(balances[source.SourceBudgetID] - source.Floor); spare > 0 {
+			available[i] = spare
+		}
 	}
 
-	allocations := allocateWeightedCents(deficitCents, sources)
+	allocations := allocateAutoBalanceCents(deficitCents, sources, available)
 	var totalAllocated int64
+	var moves []Transaction
 	description := fmt.Sprintf("Auto-balance for %s", budgetName)
+	insert := func(budgetID int64, credit bool, amount int64) error {
+		t, err := scanTransaction(tx.QueryRowContext(ctx, `
+			INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, created_at, updated_at)
+			VALUES ($1, NULL, $2, $3, $4, NOW(), NOW())
+			RETURNING `+transactionColumns+`;
+		`, budgetID, description, credit, Cents(amount)))
+		if err != nil {
+			return err
+		}
+		moves = append(moves, t)
+		return recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &t))
+	}
 	for i, source := range sources {
 		if allocations[i] <= 0 {
 			continue
 		}
-		amount := float64(allocations[i]) / 100
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO transacts (budget_id, user_id, description, credit, amount, created_at, updated_at)
-			VALUES ($1, NULL, $2, FALSE, $3, NOW(), NOW())
-		`, source.SourceBudgetID, description, amount); err != nil {
-			return fmt.Errorf("insert source debit: %w", err)
+		if err := insert(source.SourceBudgetID, false, allocations[i]); err != nil {
+			return nil, 0, fmt.Errorf("insert source debit: %w", err)
 		}
 		totalAllocated += allocations[i]
 	}
+	unfunded := Cents(deficitCents - totalAllocated)
 
 	if totalAllocated <= 0 {
-		return nil
+		return nil, unfunded, nil
 	}
 
-	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO transacts (budget_id, user_id, description, credit, amount, created_at, updated_at)
-		VALUES ($1, NULL, $2, TRUE, $3, NOW(), NOW())
-	`, budgetID, description, float64(totalAllocated)/100); err != nil {
-		return fmt.Errorf("insert target credit: %w", err)
+	if err := insert(budgetID, true, totalAllocated); err != nil {
+		return nil, 0, fmt.Errorf("insert target credit: %w", err)
 	}
-	return nil
+	return moves, unfunded, nil
+}
+
+// allocateAutoBalanceCents splits a deficit of totalCents between sources,
+// giving no source more than its available amount. Priority sources are
+// drained first, lowest Priority first; sources sharing a priority split their
+// tier by weight, counting a zero weight as 1. Weighted sources share whatever
+// is left, a source's unmet share moving to the others. sources must be
+// ordered as autoBalanceSourcesTx lists them.
+func allocateAutoBalanceCents(totalCents int64, sources []AutoBalanceSource, available []int64) []int64 {
+	allocations := make([]int64, len(sources))
+	remaining := totalCents
+	var weighted []int
+	for start := 0; start < len(sources); {
+		if sources[start].Mode != AutoBalancePriority {
+			weighted = append(weighted, start)
+			start++
+			continue
+		}
+		end := start
+		for end < len(sources) && sources[end].Mode == AutoBalancePriority && sources[end].Priority == sources[start].Priority {
+			end++
+		}
+		tier := make([]AutoBalanceSource, 0, end-start)
+		caps := make([]int64, 0, end-start)
+		for i := start; i < end; i++ {
+			source := sources[i]
+			if source.Weight <= 0 {
+				source.Weight = 1
+			}
+			tier = append(tier, source)
+			caps = append(caps, available[i])
+		}
+		for k, give := range allocateCappedCents(remaining, tier, caps) {
+			allocations[start+k] = give
+			remaining -= give
+		}
+		start = end
+	}
+
+	subset := make([]AutoBalanceSource, len(weighted))
+	caps := make([]int64, len(weighted))
+	for k, idx := range weighted {
+		subset[k] = sources[idx]
+		caps[k] = available[idx]
+	}
+	for k, give := range allocateCappedCents(remaining, subset, caps) {
+		allocations[weighted[k]] = give
+	}
+	return allocations
 }
 
 func allocateWeightedCents(totalCents int64, sources []AutoBalanceSource) []int64 {
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransactionAmountIsInvalidInput(t *testing.T) {
+	s := New(nil)
+	ctx := context.Background()
+	if _, err := s.CreateTransaction(ctx, 1, nil, TransactionInput{Amount: 0}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a zero amount to be invalid on create, got %v", err)
+	}
+	if _, err := s.UpdateTransaction(ctx, 1, 2, nil, TransactionInput{Amount: -100}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a negative amount to be invalid on update, got %v", err)
+	}
+}
+
+func TestCreateTransferRebalancesImmediateBudget(t *testing.T) {
+	db := newLedgerDB()
+	conn := sql.OpenDB(db)
+	defer conn.Close()
+
+	day := DateOf(time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC))
+	tr, err := New(conn).CreateTransfer(context.Background(), 2, 3, nil, "Dinner out", 2500, &day)
+	if err != nil {
+		t.Fatalf("create transfer: %v", err)
+	}
+	if len(tr.Debit.AutoBalance) != 2 || len(tr.Credit.AutoBalance) != 0 {
+		t.Fatalf("expected the overdrawn debit leg to carry the moves, got %+v / %+v", tr.Debit.AutoBalance, tr.Credit.AutoBalance)
+	}
+	db.checkRebalanced(t, 2500)
+}
+
+func TestCreateSplitRebalancesImmediateBudget(t *testing.T) {
+	db := newLedgerDB()
+	conn := sql.OpenDB(db)
+	defer conn.Close()
+
+	day := DateOf(time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC))
+	sp, err := New(conn).CreateSplit(context.Background(), nil, "Market", 5000, &day, []SplitLine{{BudgetID: 3, Amount: 1000}, {BudgetID: 2, Amount: 4000}}, nil)
+	if err != nil {
+		t.Fatalf("create split: %v", err)
+	}
+	if len(sp.Lines) != 2 || len(sp.Lines[0].AutoBalance) != 0 || len(sp.Lines[1].AutoBalance) != 2 {
+		t.Fatalf("expected the overdrawn line to carry the moves, got %+v", sp.Lines)
+	}
+	db.checkRebalanced(t, 4000)
+}
+
+// ledgerDB is a database/sql driver standing in for the statements a write
+// with immediate auto-balance runs. Budget 2 rebalances immediately from
+// budget 1, which holds 100.00; budget 3 has no auto-balance. It keeps the
+// transactions written and the order budgets were locked and written in.
+type ledgerDB struct {
+	immediate map[int64][]int64
+	txns      []Transaction
+	events    []string
+}
+
+func newLedgerDB() *ledgerDB {
+	return &ledgerDB{
+		immediate: map[int64][]int64{2: {1}},
+		txns:      []Transaction{{BudgetID: 1, Credit: true, Amount: 10000}},
+	}
+}
+
+// checkRebalanced verifies that budget 2 was covered for deficit from budget
+// 1, and that every budget was locked before anything was inserted.
+func (db *ledgerDB) checkRebalanced(t *testing.T, deficit Cents) {
+	t.Helper()
+	if got := db.balance(2); got != 0 {
+		t.Fatalf("expected budget 2 rebalanced to zero, got %s", got)
+	}
+	if got := db.balance(1); got != 10000-deficit {
+		t.Fatalf("expected budget 1 to fund %s, got balance %s", deficit, got)
+	}
+	firstInsert := -1
+	for i, ev := range db.events {
+		if strings.HasPrefix(ev, "insert") {
+			firstInsert = i
+			break
+		}
+	}
+	if firstInsert < 2 || db.events[0] != "lock 1" || db.events[1] != "lock 2" {
+		t.Fatalf("expected budgets 1 and 2 locked before the first insert, got %v", db.events)
+	}
+}
+
+func (db *ledgerDB) balance(budgetID int64) Cents {
+	var total Cents
+	for _, t := range db.txns {
+		if t.BudgetID != budgetID {
+			continue
+		}
+		if t.Credit {
+			total += t.Amount
+		} else {
+			total -= t.Amount
+		}
+	}
+	return total
+}
+
+func (db *ledgerDB) Connect(context.Context) (driver.Conn, error) { return ledgerConn{db}, nil }
+func (db *ledgerDB) Driver() driver.Driver                        { return nil }
+
+type ledgerConn struct{ db *ledgerDB }
+
+func (c ledgerConn) Prepare(query string) (driver.Stmt, error) { return ledgerStmt{c.db, query}, nil }
+func (c ledgerConn) Close() error                              { return nil }
+func (c ledgerConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c ledgerConn) Commit() error                             { return nil }
+func (c ledgerConn) Rollback() error                           { return nil }
+func (c ledgerConn) CheckNamedValue(*driver.NamedValue) error  { return nil }
+
+type ledgerStmt struct {
+	db    *ledgerDB
+	query string
+}
+
+func (s ledgerStmt) Close() error  { return nil }
+func (s ledgerStmt) NumInput() int { return -1 }
+
+func (s ledgerStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "INSERT INTO audit_log") {
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec: %s", s.query)
+}
+
+func (s ledgerStmt) Query(args []driver.Value) (driver.Rows, error) {
+	now := time.Now()
+	one := func(cols []string, row ...driver.Value) driver.Rows {
+		return &incomeRows{cols: cols, rows: [][]driver.Value{row}}
+	}
+	switch {
+	case strings.Contains(s.query, "WHERE id = $1 AND deleted_at IS NULL"):
+		return one([]string{"exists"}, true), nil
+	case strings.Contains(s.query, "auto_balance_trigger = $2"):
+		var ids []int64
+		for _, id := range args[0].([]int64) {
+			if _, ok := s.db.immediate[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		rows := &incomeRows{cols: []string{"id"}}
+		for i, id := range ids {
+			if i == 0 || id != ids[i-1] {
+				rows.rows = append(rows.rows, []driver.Value{id})
+			}
+		}
+		return rows, nil
+	case strings.Contains(s.query, "FROM budget_auto_balance_sources"):
+		rows := &incomeRows{cols: []string{"source_budget_id", "weight", "mode", "priority", "floor_cents"}}
+		for _, source := range s.db.immediate[args[0].(int64)] {
+			rows.rows = append(rows.rows, []driver.Value{source, int64(1), AutoBalanceWeighted, int64(0), int64(0)})
+		}
+		return rows, nil
+	case strings.Contains(s.query, "SELECT id FROM budgets WHERE id = $1 FOR UPDATE"):
+		s.db.events = append(s.db.events, fmt.Sprintf("lock %d", args[0]))
+		return one([]string{"id"}, args[0]), nil
+	case strings.Contains(s.query, "SELECT "+budgetColumns+" FROM budgets"):
+		id := args[0].(int64)
+		_, immediate := s.db.immediate[id]
+		return one(strings.Split(budgetColumns, ", "), id, fmt.Sprintf("Budget %d", id), int64(0), nil, nil, immediate, AutoBalanceImmediate,
+			PayMonthly, nil, "1", int64(0), "", "", false, RolloverCarry, int64(0), nil, now, now, nil), nil
+	case strings.Contains(s.query, "COALESCE(SUM("):
+		return one([]string{"balance"}, int64(s.db.balance(args[0].(int64)))), nil
+	case strings.Contains(s.query, "INSERT INTO transfers"):
+		return one([]string{"id", "created_at"}, int64(1), now), nil
+	case strings.Contains(s.query, "INSERT INTO splits"):
+		return one([]string{"id", "occurred_on", "created_at", "updated_at"}, int64(1), args[2].(*Date).Time, now, now), nil
+	case strings.Contains(s.query, "INSERT INTO transacts"):
+		t := Transaction{ID: int64(len(s.db.txns) + 1), BudgetID: args[0].(int64)}
+		switch {
+		case strings.Contains(s.query, "transfer_id, created_at"):
+			t.Credit, t.Amount = args[3].(bool), args[4].(Cents)
+		case strings.Contains(s.query, "split_id, payee_id, created_at"):
+			t.Amount = args[3].(Cents)
+		default:
+			t.Credit, t.Amount = args[2].(bool), args[3].(Cents)
+		}
+		s.db.txns = append(s.db.txns, t)
+		s.db.events = append(s.db.events, fmt.Sprintf("insert %d", t.BudgetID))
+		return one(strings.Split(transactionColumns, ", "), t.ID, t.BudgetID, nil, "", t.Credit, int64(t.Amount), now,
+			nil, nil, nil, false, nil, nil, nil, now, now, nil), nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
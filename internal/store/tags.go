@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tag labels transactions across budgets, e.g. "Dining" inside "Fun money".
+// Tags belong to the user who created them and names are case-insensitively
+// unique per user.
+type Tag struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const maxTagName = 64
+
+func (s *Store) ListTags(ctx context.Context, userID *int64) ([]Tag, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, created_at, updated_at
+		FROM tags
+		WHERE user_id IS NOT DISTINCT FROM $1
+		ORDER BY LOWER(name);
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []Tag
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *Store) CreateTag(ctx context.Context, userID *int64, name string) (Tag, error) {
+	name, err := cleanTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	var t Tag
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO tags (user_id, name, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, name, created_at, updated_at;
+	`, userID, name).Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt)
+	if isUniqueViolation(err) {
+		return Tag{}, invalidf("tag %q already exists", name)
+	}
+	return t, err
+}
+
+func (s *Store) RenameTag(ctx context.Context, id int64, userID *int64, name string) (Tag, error) {
+	name, err := cleanTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	var t Tag
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE tags
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2 AND user_id IS NOT DISTINCT FROM $3
+		RETURNING id, name, created_at, updated_at;
+	`, name, id, userID).Scan(&t.ID, &t.Name, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return Tag{}, invalidf("tag %q already exists", name)
+	}
+	return t, err
+}
+
+// DeleteTag removes a tag and detaches it from every transaction.
+func (s *Store) DeleteTag(ctx context.Context, id int64, userID *int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM tags WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func cleanTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", invalidf("tag name is required")
+	}
+	if len(name) > maxTagName {
+		return "", invalidf("tag names are limited to %d characters", maxTagName)
+	}
+	return name, nil
+}
+
+// normalizeTagNames trims, drops blanks and removes case-insensitive
+// duplicates, keeping the first spelling seen.
+func normalizeTagNames(names []string) ([]string, error) {
+	out := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		clean, err := cleanTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(clean)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		out = append(out, clean)
+	}
+	return out, nil
+}
+
+// setTransactionTagsTx replaces a transaction's tags with names, creating any
+// of the user's tags that don't exist yet. It returns the names as stored.
+func setTransactionTagsTx(ctx context.Context, tx *sql.Tx, userID *int64, transactionID int64, names []string) ([]string, error) {
+	names, err := normalizeTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM transacts_tags WHERE transact_id = $1`, transactionID); err != nil {
+		return nil, err
+	}
+	stored := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO tags (user_id, name, created_at, updated_at)
+			VALUES ($1, $2, NOW(), NOW())
+			ON CONFLICT DO NOTHING;
+		`, userID, name); err != nil {
+			return nil, err
+		}
+		var tagID int64
+		var tagName string
+		if err := tx.QueryRowContext(ctx, `
+			SELECT id, name
+			FROM tags
+			WHERE COALESCE(user_id, 0) = COALESCE($1, 0) AND LOWER(name) = LOWER($2);
+		`, userID, name).Scan(&tagID, &tagName); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO transacts_tags (transact_id, tag_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING;
+		`, transactionID, tagID); err != nil {
+			return nil, err
+		}
+		stored = append(stored, tagName)
+	}
+	sort.Slice(stored, func(i, j int) bool { return strings.ToLower(stored[i]) < strings.ToLower(stored[j]) })
+	return stored, nil
+}
+
+// loadTransactionTags fills in Tags for each transaction with one query.
+func loadTransactionTags(ctx context.Context, q queryer, txns []Transaction) error {
+	if len(txns) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(txns))
+	index := make(map[int64]int, len(txns))
+	for i, t := range txns {
+		ids[i] = t.ID
+		index[t.ID] = i
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT tt.transact_id, tg.name
+		FROM transacts_tags tt
+		JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.transact_id = ANY($1)
+		ORDER BY LOWER(tg.name);
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			txns[i].Tags = append(txns[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTagNames(t *testing.T) {
+	got, err := normalizeTagNames([]string{" Dining ", "", "dining", "Fun", "  "})
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if strings.Join(got, ",") != "Dining,Fun" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestNormalizeTagNamesRejectsLongNames(t *testing.T) {
+	_, err := normalizeTagNames([]string{strings.Repeat("x", maxTagName+1)})
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Transfer moves money between two budgets. It is recorded as a debit leg in
+// the source budget and a credit leg in the destination, both carrying the
+// transfer's ID so edits and deletes keep the pair in sync.
+type Transfer struct {
+	ID           int64       `json:"id"`
+	FromBudgetID int64       `json:"from_budget_id"`
+	ToBudgetID   int64       `json:"to_budget_id"`
+	Description  string      `json:"description"`
+	Amount       Cents       `json:"amount"`
+	OccurredOn   Date        `json:"occurred_on"`
+	Debit        Transaction `json:"debit"`
+	Credit       Transaction `json:"credit"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// CreateTransfer writes both legs of a transfer in one database transaction.
+// The caller must have access to both budgets. A nil occurredOn means today in
+// the source budget's time zone.
+func (s *Store) CreateTransfer(ctx context.Context, fromBudgetID, toBudgetID int64, userID *int64, description string, amount Cents, occurredOn *Date) (Transfer, error) {
+	if amount <= 0 {
+		return Transfer{}, invalidf("amount must be > 0")
+	}
+	if fromBudgetID == toBudgetID {
+		return Transfer{}, invalidf("cannot transfer to the same budget")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Transfer{}, err
+	}
+	defer tx.Rollback()
+
+	for _, id := range []int64{fromBudgetID, toBudgetID} {
+		if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
+			return Transfer{}, err
+		}
+	}
+	rebalance, err := lockImmediateAutoBalanceTx(ctx, tx, fromBudgetID, toBudgetID)
+	if err != nil {
+		return Transfer{}, err
+	}
+	if occurredOn == nil {
+		today, err := budgetTodayTx(ctx, tx, fromBudgetID)
+		if err != nil {
+			return Transfer{}, err
+		}
+		occurredOn = &today
+	}
+
+	t := Transfer{FromBudgetID: fromBudgetID, ToBudgetID: toBudgetID, Description: description, Amount: amount}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO transfers (from_budget_id, to_budget_id, user_id, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, created_at;
+	`, fromBudgetID, toBudgetID, userID).Scan(&t.ID, &t.CreatedAt); err != nil {
+		if isForeignKeyError(err) {
+			return Transfer{}, ErrNotFound
+		}
+		return Transfer{}, err
+	}
+
+	q := `
+		INSERT INTO transacts (budget_id, user_id, description, credit, amount_cents, occurred_on, transfer_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING ` + transactionColumns + `;
+	`
+	if t.Debit, err = scanTransaction(tx.QueryRowContext(ctx, q, fromBudgetID, userID, description, false, amount, occurredOn, t.ID)); err != nil {
+		return Transfer{}, err
+	}
+	if t.Credit, err = scanTransaction(tx.QueryRowContext(ctx, q, toBudgetID, userID, description, true, amount, occurredOn, t.ID)); err != nil {
+		return Transfer{}, err
+	}
+	for _, leg := range []Transaction{t.Debit, t.Credit} {
+		if err := recordAuditTx(ctx, tx, userID, transactionAudit(AuditCreate, nil, &leg)); err != nil {
+			return Transfer{}, err
+		}
+	}
+	t.OccurredOn = t.Debit.OccurredOn
+	for _, id := range rebalance {
+		moves, err := immediateAutoBalanceTx(ctx, tx, userID, id)
+		if err != nil {
+			return Transfer{}, err
+		}
+		if id == fromBudgetID {
+			t.Debit.AutoBalance = moves
+		} else {
+			t.Credit.AutoBalance = moves
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transfer{}, err
+	}
+	return t, nil
+}
+
+// lockTransferLegsTx locks every live leg of a transfer, with its details, and
+// checks the caller can access each leg's budget and that none is in the
+// trash.
+func lockTransferLegsTx(ctx context.Context, tx *sql.Tx, transferID int64, userID *int64) ([]Transaction, error) {
+	legs, err := queryTransactionsTx(ctx, tx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE transfer_id = $1 AND deleted_at IS NULL
+		ORDER BY id
+		FOR UPDATE;
+	`, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadTransactionDetails(ctx, tx, legs); err != nil {
+		return nil, err
+	}
+	for _, leg := range legs {
+		if err := ensureGroupBudgetAccessTx(ctx, tx, leg.BudgetID, userID, true); err != nil {
+			return nil, err
+		}
+	}
+	return legs, nil
+}
+
+// updateTransferLegsTx applies an edit to every leg of a transfer and returns
+// the updated legs. Tags and Payee, when given, are set on both legs; Cleared
+// only applies to editedID, since each leg clears against its own statement.
+func updateTransferLegsTx(ctx context.Context, tx *sql.Tx, transferID, editedID int64, userID *int64, in TransactionInput) ([]Transaction, error) {
+	before, err := lockTransferLegsTx(ctx, tx, transferID, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, leg := range before {
+		cleared := in.Cleared
+		if leg.ID != editedID {
+			cleared = nil
+		}
+		if err := checkReconciledEdit(leg, leg.Credit, in.Amount, in.OccurredOn, cleared); err != nil {
+			return nil, err
+		}
+	}
+	var payeeID *int64
+	if in.Payee != nil {
+		if payeeID, _, err = resolvePayeeTx(ctx, tx, userID, *in.Payee, true); err != nil {
+			return nil, err
+		}
+	}
+	after, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET description = $1, amount_cents = $2, occurred_on = COALESCE($3, occurred_on),
+			cleared = CASE WHEN id = $4 THEN COALESCE($5, cleared) ELSE cleared END,
+			payee_id = CASE WHEN $6 THEN $7 ELSE payee_id END, updated_at = NOW()
+		WHERE transfer_id = $8 AND deleted_at IS NULL
+		RETURNING `+transactionColumns+`;
+	`, in.Description, in.Amount, in.OccurredOn, editedID, in.Cleared, in.Payee != nil, payeeID, transferID)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadTransactionPayees(ctx, tx, after); err != nil {
+		return nil, err
+	}
+	previous := make(map[int64][]string, len(before))
+	for _, leg := range before {
+		previous[leg.ID] = leg.Tags
+	}
+	for i := range after {
+		after[i].Tags = previous[after[i].ID]
+		if in.Tags != nil {
+			if after[i].Tags, err = setTransactionTagsTx(ctx, tx, userID, after[i].ID, in.Tags); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := auditTransactionPairsTx(ctx, tx, userID, AuditUpdate, before, after); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE transfers SET updated_at = NOW() WHERE id = $1`, transferID); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+func deleteTransferTx(ctx context.Context, tx *sql.Tx, transferID int64, userID *int64) error {
+	before, err := lockTransferLegsTx(ctx, tx, transferID, userID)
+	if err != nil {
+		return err
+	}
+	for _, leg := range before {
+		if leg.ReconciliationID != nil {
+			return invalidf("transaction %d is reconciled and cannot be deleted", leg.ID)
+		}
+	}
+	after, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE transfer_id = $1 AND deleted_at IS NULL
+		RETURNING `+transactionColumns+`;
+	`, transferID)
+	if err != nil {
+		return err
+	}
+	return auditTransactionPairsTx(ctx, tx, userID, AuditDelete, before, after)
+}
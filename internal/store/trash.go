@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Trash lists what a user has deleted but can still restore. Transactions of
+// a trashed budget come back with the budget and are not listed separately.
+type Trash struct {
+	Budgets      []Budget      `json:"budgets"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+func (s *Store) ListTrash(ctx context.Context, userID *int64) (Trash, error) {
+	budgets, err := s.listBudgets(ctx, userID, true)
+	if err != nil {
+		return Trash{}, err
+	}
+
+	q := `
+		SELECT ` + transactionColumns + `
+		FROM transacts
+		WHERE deleted_at IS NOT NULL
+			AND budget_id IN (SELECT id FROM budgets WHERE deleted_at IS NULL)
+	`
+	var args []any
+	if userID != nil {
+		q += " AND budget_id IN (SELECT budget_id FROM users_budgets WHERE user_id = $1)"
+		args = append(args, *userID)
+	}
+	q += " ORDER BY deleted_at DESC, id DESC;"
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return Trash{}, err
+	}
+	defer rows.Close()
+
+	trash := Trash{Budgets: budgets}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return Trash{}, err
+		}
+		trash.Transactions = append(trash.Transactions, t)
+	}
+	return trash, rows.Err()
+}
+
+// RestoreBudget takes a budget out of the trash along with everything that
+// was attached to it when it was deleted.
+func (s *Store) RestoreBudget(ctx context.Context, id int64, userID *int64) (Budget, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer tx.Rollback()
+
+	if userID != nil {
+		var shared bool
+		err := tx.QueryRowContext(ctx, `SELECT TRUE FROM users_budgets WHERE budget_id = $1 AND user_id = $2`, id, *userID).Scan(&shared)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Budget{}, ErrNotFound
+		}
+		if err != nil {
+			return Budget{}, err
+		}
+	}
+	before, err := lockBudgetRowTx(ctx, tx, id)
+	if err != nil {
+		return Budget{}, err
+	}
+	if before.DeletedAt == nil {
+		return Budget{}, ErrNotFound
+	}
+	after, err := scanBudgetRow(tx.QueryRowContext(ctx, `
+		UPDATE budgets
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+budgetColumns+`;
+	`, id))
+	if err != nil {
+		return Budget{}, err
+	}
+	if err := recordAuditTx(ctx, tx, userID, auditEvent{budgetID: id, entity: AuditBudget, entityID: id, action: AuditRestore, before: before, after: after}); err != nil {
+		return Budget{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Budget{}, err
+	}
+	return s.GetBudget(ctx, id, userID)
+}
+
+// RestoreTransaction takes a transaction out of the trash. Transfer legs come
+// back as a pair and split lines bring back their whole split, so a restore
+// never leaves half of a group behind.
+func (s *Store) RestoreTransaction(ctx context.Context, transactionID int64, userID *int64) (Transaction, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Transaction{}, err
+	}
+	defer tx.Rollback()
+
+	t, err := scanTransaction(tx.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transacts
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		FOR UPDATE;
+	`, transactionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, ErrNotFound
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	where, groupID := "id = $1", t.ID
+	switch {
+	case t.TransferID != nil:
+		where, groupID = "transfer_id = $1", *t.TransferID
+	case t.SplitID != nil:
+		where, groupID = "split_id = $1", *t.SplitID
+	}
+
+	budgetIDs, err := trashedBudgetIDsTx(ctx, tx, where, groupID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	for _, id := range budgetIDs {
+		if err := ensureBudgetAccessTx(ctx, tx, id, userID); err != nil {
+			if errors.Is(err, ErrNotFound) && id != t.BudgetID {
+				return Transaction{}, invalidf("budget %d must be restored first", id)
+			}
+			return Transaction{}, err
+		}
+	}
+
+	restored, err := queryTransactionsTx(ctx, tx, `
+		UPDATE transacts
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE deleted_at IS NOT NULL AND `+where+`
+		RETURNING `+transactionColumns+`;
+	`, groupID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := auditTransactionPairsTx(ctx, tx, userID, AuditRestore, nil, restored); err != nil {
+		return Transaction{}, err
+	}
+	if t.SplitID != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE splits SET deleted_at = NULL, updated_at = NOW() WHERE id = $1`, *t.SplitID); err != nil {
+			return Transaction{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Transaction{}, err
+	}
+	for _, r := range restored {
+		if r.ID == t.ID {
+			return r, nil
+		}
+	}
+	return t, nil
+}
+
+// trashedBudgetIDsTx locks the trashed rows matching where and returns the
+// distinct budgets they belong to.
+func trashedBudgetIDsTx(ctx context.Context, tx *sql.Tx, where string, arg int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT budget_id
+		FROM transacts
+		WHERE deleted_at IS NOT NULL AND `+where+`
+		FOR UPDATE;
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	seen := make(map[int64]struct{})
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	return ids, rows.Err()
+}
+
+// purgeLockKey is the advisory lock PurgeTrash holds, so replicas purging at
+// the same time don't both log the same rows as purged.
+const purgeLockKey = 7_041_202_601
+
+// purgeableBudgets selects the budgets deleted before $1 that PurgeTrash may
+// remove. A budget an income plan still pays stays in the trash, since
+// purging it would leave the plan unable to deposit; it goes once the plan
+// stops naming it.
+const purgeableBudgets = `
+	SELECT b.id FROM budgets b
+	WHERE b.deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM income_allocations ia WHERE ia.budget_id = b.id)
+		AND NOT EXISTS (SELECT 1 FROM incomes i WHERE i.remainder_budget_id = b.id)`
+
+// PurgeTrash permanently removes budgets, transactions and splits that were
+// deleted before cutoff, except budgets an income plan pays. A live split
+// losing lines with a purged budget keeps the rest, its total reduced to
+// match. It returns how many budgets and transactions went; when another
+// replica is already purging it does nothing.
+func (s *Store) PurgeTrash(ctx context.Context, cutoff time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, int64(purgeLockKey)).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("lock purge: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	// Leave a purge entry in each affected budget's history before the rows
+	// disappear.
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_log (budget_id, entity, entity_id, action, created_at)
+		SELECT id, $2::TEXT, id, $3::TEXT, NOW() FROM (`+purgeableBudgets+`) p
+		UNION ALL
+		SELECT budget_id, $4::TEXT, id, $3::TEXT, NOW() FROM transacts WHERE deleted_at < $1
+	`, cutoff, AuditBudget, AuditPurge, AuditTransaction); err != nil {
+		return 0, fmt.Errorf("audit purge: %w", err)
+	}
+
+	steps := []struct {
+		query string
+		count bool
+	}{
+		{`UPDATE splits sp
+			SET total_cents = sp.total_cents - p.amount_cents, updated_at = NOW()
+			FROM (
+				SELECT split_id, SUM(amount_cents) AS amount_cents
+				FROM transacts
+				WHERE split_id IS NOT NULL AND budget_id IN (` + purgeableBudgets + `)
+				GROUP BY split_id
+			) p
+			WHERE sp.id = p.split_id`, false},
+		{`DELETE FROM transacts WHERE budget_id IN (` + purgeableBudgets + `)`, true},
+		{`DELETE FROM budget_auto_balance_sources WHERE budget_id IN (` + purgeableBudgets + `) OR source_budget_id IN (` + purgeableBudgets + `)`, false},
+		{`DELETE FROM users_budgets WHERE budget_id IN (` + purgeableBudgets + `)`, false},
+		{`DELETE FROM budgets WHERE id IN (` + purgeableBudgets + `)`, true},
+		{`DELETE FROM transacts WHERE deleted_at < $1`, true},
+		{`DELETE FROM splits WHERE deleted_at < $1`, false},
+	}
+	purged := 0
+	for _, step := range steps {
+		res, err := tx.ExecContext(ctx, step.query, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("purge trash: %w", err)
+		}
+		if step.count {
+			n, _ := res.RowsAffected()
+			purged += int(n)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM transfers tr
+		WHERE NOT EXISTS (SELECT 1 FROM transacts t WHERE t.transfer_id = tr.id)
+	`); err != nil {
+		return 0, fmt.Errorf("purge transfers: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM splits sp
+		WHERE NOT EXISTS (SELECT 1 FROM transacts t WHERE t.split_id = sp.id)
+	`); err != nil {
+		return 0, fmt.Errorf("purge splits: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,50 @@
+package trash
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"my-personal-budget/internal/store"
+)
+
+// purgeInterval is how often the purger looks for expired trash. Retention is
+// measured in days, so a few runs a day is plenty.
+const purgeInterval = 6 * time.Hour
+
+// StartPurger launches a background loop that permanently removes budgets and
+// transactions that have been in the trash longer than retention. A zero
+// retention keeps trash forever. The provided context cancels the loop.
+func StartPurger(ctx context.Context, s *store.Store, retention time.Duration, logger *log.Logger) {
+	if retention <= 0 {
+		return
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	go run(ctx, s, retention, logger)
+}
+
+func run(ctx context.Context, s *store.Store, retention time.Duration, logger *log.Logger) {
+	// Let the payroll scheduler have the database first after startup.
+	wait := 30 * time.Second
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		count, err := s.PurgeTrash(runCtx, time.Now().Add(-retention))
+		cancel()
+		if err != nil {
+			logger.Printf("trash: purge failed: %v", err)
+		} else if count > 0 {
+			logger.Printf("trash: purged %d deleted row(s) older than %s", count, retention)
+		}
+		wait = purgeInterval
+	}
+}